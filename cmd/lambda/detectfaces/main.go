@@ -3,33 +3,51 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"os"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/keitakn/aws-rekognition-sandbox/imagerequest"
+	"github.com/keitakn/aws-rekognition-sandbox/internal/rekognitionclient"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
 	"github.com/keitakn/aws-rekognition-sandbox/usecase/detectfaces"
 	"github.com/pkg/errors"
 )
 
-var detectFacesUseCase *detectfaces.UseCase
+var (
+	logger             *logging.Logger
+	detectFacesUseCase *detectfaces.UseCase
+)
 
 //nolint:gochecknoinits
 func init() {
+	logger = logging.NewFromEnv()
+	recorder := metrics.NewFromEnv()
+
 	region := os.Getenv("REGION")
 
 	ctx := context.Background()
 	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
 	if err != nil {
-		// TODO ここでエラーが発生した場合、致命的な問題が起きているのでちゃんとしたログを出すように改修する
-		log.Fatalln(err)
+		logger.Fatal(ctx, "failed to config.LoadDefaultConfig", err)
 	}
 
-	rekognitionClient := rekognition.NewFromConfig(cfg)
+	if _, err := tracing.NewProviderFromEnv(ctx); err != nil {
+		logger.Fatal(ctx, "failed to tracing.NewProviderFromEnv", err)
+	}
 
-	detectFacesUseCase = &detectfaces.UseCase{RekognitionClient: rekognitionClient}
+	rekognitionClient, err := rekognitionclient.NewFromEnv(cfg, logger, recorder)
+	if err != nil {
+		logger.Fatal(ctx, "failed to rekognitionclient.NewFromEnv", err)
+	}
+
+	detectFacesUseCase = &detectfaces.UseCase{
+		RekognitionClient: rekognitionClient,
+		Logger:            logger,
+	}
 }
 
 func createApiGatewayV2Response(statusCode int, resBodyJson []byte) events.APIGatewayV2HTTPResponse {
@@ -62,8 +80,18 @@ func createErrorResponse(statusCode int, message string) events.APIGatewayV2HTTP
 }
 
 func Handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	var reqBody detectfaces.Request
-	if err := json.Unmarshal([]byte(req.Body), &reqBody); err != nil {
+	defer tracing.Flush(ctx)
+
+	ctx, span := tracing.Start(ctx, "detectFaces.Handler")
+	defer span.End()
+
+	ctx = logging.WithApiGatewayRequestId(logging.WithLambdaRequestId(ctx), req.RequestContext.RequestID)
+
+	// JSON（Base64エンコードした画像）、multipart/form-data、画像そのもの（image/jpeg 等）のどれでも受け付ける
+	reqBody, err := imagerequest.DecodeAPIGatewayV2Request(req)
+	if err != nil {
+		logger.Warn(ctx, "invalid request", logging.Fields{"error": err.Error()})
+
 		statusCode := 400
 
 		res := createErrorResponse(statusCode, "Bad Request")
@@ -71,9 +99,12 @@ func Handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.AP
 		return res, err
 	}
 
-	useCaseRes, err := detectFacesUseCase.DetectFaces(ctx, reqBody)
+	useCaseRes, err := detectFacesUseCase.DetectFaces(ctx, detectfaces.Request{Image: reqBody.Image})
 
 	if err != nil {
+		logger.Error(ctx, "failed to detectFacesUseCase.DetectFaces", err)
+		tracing.RecordError(span, err)
+
 		statusCode := 500
 
 		//nolint:errorlint
@@ -81,6 +112,10 @@ func Handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.AP
 		case detectfaces.ErrBase64Decode:
 			res := createErrorResponse(statusCode, detectfaces.ErrBase64Decode.Error())
 			return res, nil
+		case detectfaces.ErrImagePreprocessing:
+			// 画像として読み込めない場合は何度実行しても結果は変わらないのでクライアントのエラーとして扱う
+			res := createErrorResponse(400, detectfaces.ErrImagePreprocessing.Error())
+			return res, nil
 		case detectfaces.ErrUnexpected:
 			res := createErrorResponse(statusCode, detectfaces.ErrUnexpected.Error())
 			return res, nil
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/keitakn/aws-rekognition-sandbox/test"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/detectfaces"
+)
+
+//nolint:funlen
+func TestHandler(t *testing.T) {
+	img, err := os.ReadFile("../../../test/images/abyssinian-cat.jpg")
+	if err != nil {
+		t.Fatal("Error failed to os.ReadFile", err)
+	}
+
+	multipartBody, multipartContentType, err := test.CreateMultipartBody("image", "abyssinian-cat.jpg", "image/jpeg", img)
+	if err != nil {
+		t.Fatal("Error failed to test.CreateMultipartBody", err)
+	}
+
+	jsonBody, err := json.Marshal(map[string]string{"image": base64.StdEncoding.EncodeToString(img)})
+	if err != nil {
+		t.Fatal("Error failed to json.Marshal", err)
+	}
+
+	tests := []struct {
+		name string
+		req  events.APIGatewayV2HTTPRequest
+	}{
+		{
+			name: "json",
+			req: events.APIGatewayV2HTTPRequest{
+				Headers: map[string]string{"content-type": "application/json"},
+				Body:    string(jsonBody),
+			},
+		},
+		{
+			name: "multipart/form-data",
+			req: events.APIGatewayV2HTTPRequest{
+				Headers:         map[string]string{"content-type": multipartContentType},
+				Body:            base64.StdEncoding.EncodeToString(multipartBody),
+				IsBase64Encoded: true,
+			},
+		},
+		{
+			name: "raw binary",
+			req: events.APIGatewayV2HTTPRequest{
+				Headers:         map[string]string{"content-type": "image/jpeg"},
+				Body:            base64.StdEncoding.EncodeToString(img),
+				IsBase64Encoded: true,
+			},
+		},
+	}
+
+	detectFacesOutput := &rekognition.DetectFacesOutput{
+		FaceDetails: []types.FaceDetail{{Confidence: aws.Float32(12.7)}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Successful detect faces in the image sent as "+tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+
+			params := &rekognition.DetectFacesInput{
+				Image: &types.Image{Bytes: img},
+			}
+
+			mockClient := mock.NewMockRekognitionClient(ctrl)
+			mockClient.EXPECT().DetectFaces(ctx, params).Return(detectFacesOutput, nil)
+
+			detectFacesUseCase = &detectfaces.UseCase{RekognitionClient: mockClient}
+
+			res, err := Handler(ctx, tt.req)
+			if err != nil {
+				t.Fatal("Error failed to Handler", err)
+			}
+
+			if res.StatusCode != 200 {
+				t.Error("\nActually: ", res.StatusCode, res.Body, "\nExpected: ", 200)
+			}
+
+			var actual detectfaces.Response
+			if err := json.Unmarshal([]byte(res.Body), &actual); err != nil {
+				t.Fatal("Error failed to json.Unmarshal", err)
+			}
+
+			if reflect.DeepEqual(actual.DetectFacesOutput.FaceDetails, detectFacesOutput.FaceDetails) == false {
+				t.Error("\nActually: ", actual.DetectFacesOutput, "\nExpected: ", detectFacesOutput)
+			}
+		})
+	}
+}
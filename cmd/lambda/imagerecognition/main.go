@@ -3,52 +3,70 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"os"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/rekognition"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/imagerequest"
 	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/internal/rekognitionclient"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
 	"github.com/keitakn/aws-rekognition-sandbox/usecase/imagerecognition"
 	"github.com/pkg/errors"
 )
 
-var imageRecognitionUseCase *imagerecognition.UseCase
+var (
+	logger                  *logging.Logger
+	imageRecognitionUseCase *imagerecognition.UseCase
+)
 
 //nolint:gochecknoinits
 func init() {
+	logger = logging.NewFromEnv()
+	recorder := metrics.NewFromEnv()
+
 	region := os.Getenv("REGION")
 
 	ctx := context.Background()
 	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
 	if err != nil {
-		// TODO ここでエラーが発生した場合、致命的な問題が起きているのでちゃんとしたログを出すように改修する
-		log.Fatalln(err)
+		logger.Fatal(ctx, "failed to config.LoadDefaultConfig", err)
+	}
+
+	if _, err := tracing.NewProviderFromEnv(ctx); err != nil {
+		logger.Fatal(ctx, "failed to tracing.NewProviderFromEnv", err)
 	}
 
 	s3Client := s3.NewFromConfig(cfg)
-	uploader := manager.NewUploader(s3Client)
+	uploader := &infrastructure.TracingS3Uploader{Uploader: manager.NewUploader(s3Client)}
 
-	rekognitionClient := rekognition.NewFromConfig(cfg)
+	rekognitionClient, err := rekognitionclient.NewFromEnv(cfg, logger, recorder)
+	if err != nil {
+		logger.Fatal(ctx, "failed to rekognitionclient.NewFromEnv", err)
+	}
 
 	imageRecognitionUseCase = &imagerecognition.UseCase{
 		RekognitionClient: rekognitionClient,
 		S3Uploader:        uploader,
 		UniqueIdGenerator: &infrastructure.UuidGenerator{},
+		ImageRecordRepository: &infrastructure.S3ImageRecordRepository{
+			S3Client:   &infrastructure.TracingS3Client{Client: s3Client},
+			BucketName: os.Getenv("TRIGGER_BUCKET_NAME"),
+		},
+		Logger:  logger,
+		Metrics: recorder,
 	}
 }
 
-type RequestBody struct {
-	Image          string `json:"image"`
-	ImageExtension string `json:"imageExtension"`
-}
-
 type ResponseErrorBody struct {
 	Message string `json:"message"`
+	// ImageId はアップロードした後にエラーになった場合に設定される、GET /images/{id} で判定結果を確認出来る
+	ImageId string `json:"imageId,omitempty"`
 }
 
 func createApiGatewayV2Response(statusCode int, resBodyJson []byte) events.APIGatewayV2HTTPResponse {
@@ -81,8 +99,18 @@ func createErrorResponse(statusCode int, message string) events.APIGatewayV2HTTP
 }
 
 func Handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	var reqBody RequestBody
-	if err := json.Unmarshal([]byte(req.Body), &reqBody); err != nil {
+	defer tracing.Flush(ctx)
+
+	ctx, span := tracing.Start(ctx, "imageRecognition.Handler")
+	defer span.End()
+
+	ctx = logging.WithApiGatewayRequestId(logging.WithLambdaRequestId(ctx), req.RequestContext.RequestID)
+
+	// JSON（Base64エンコードした画像）、multipart/form-data、画像そのもの（image/jpeg 等）のどれでも受け付ける
+	reqBody, err := imagerequest.DecodeAPIGatewayV2Request(req)
+	if err != nil {
+		logger.Warn(ctx, "invalid request", logging.Fields{"error": err.Error()})
+
 		statusCode := 400
 
 		res := createErrorResponse(statusCode, "Bad Request")
@@ -99,8 +127,25 @@ func Handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.AP
 	)
 
 	if err != nil {
+		logger.Error(ctx, "failed to imageRecognitionUseCase.ImageRecognition", err)
+		tracing.RecordError(span, err)
+
 		statusCode := 500
-		resp := createErrorResponse(statusCode, errors.Cause(err).Error())
+
+		//nolint:errorlint
+		if cause := errors.Cause(err); cause == imagerecognition.ErrNotAllowedImageFormat ||
+			cause == imagerecognition.ErrImagePreprocessing {
+			statusCode = 400
+		}
+
+		resBody := &ResponseErrorBody{Message: errors.Cause(err).Error()}
+		if res != nil {
+			resBody.ImageId = res.ImageId
+		}
+
+		resBodyJson, _ := json.Marshal(resBody)
+
+		resp := createApiGatewayV2Response(statusCode, resBodyJson)
 
 		return resp, nil
 	}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/keitakn/aws-rekognition-sandbox/test"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/imagerecognition"
+)
+
+//nolint:funlen
+func TestHandler(t *testing.T) {
+	const mockUuid = "adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a"
+
+	img, err := os.ReadFile("../../../test/images/moko-cat.jpg")
+	if err != nil {
+		t.Fatal("Error failed to os.ReadFile", err)
+	}
+
+	multipartBody, multipartContentType, err := test.CreateMultipartBody("image", "moko-cat.jpg", "image/jpeg", img)
+	if err != nil {
+		t.Fatal("Error failed to test.CreateMultipartBody", err)
+	}
+
+	jsonBody, err := json.Marshal(map[string]string{
+		"image":          base64.StdEncoding.EncodeToString(img),
+		"imageExtension": ".jpg",
+	})
+	if err != nil {
+		t.Fatal("Error failed to json.Marshal", err)
+	}
+
+	tests := []struct {
+		name string
+		req  events.APIGatewayV2HTTPRequest
+	}{
+		{
+			name: "json",
+			req: events.APIGatewayV2HTTPRequest{
+				Headers: map[string]string{"content-type": "application/json"},
+				Body:    string(jsonBody),
+			},
+		},
+		{
+			name: "multipart/form-data",
+			req: events.APIGatewayV2HTTPRequest{
+				Headers:         map[string]string{"content-type": multipartContentType},
+				Body:            base64.StdEncoding.EncodeToString(multipartBody),
+				IsBase64Encoded: true,
+			},
+		},
+		{
+			name: "raw binary",
+			req: events.APIGatewayV2HTTPRequest{
+				Headers:         map[string]string{"content-type": "image/jpeg"},
+				Body:            base64.StdEncoding.EncodeToString(img),
+				IsBase64Encoded: true,
+			},
+		},
+	}
+
+	labels := []types.Label{
+		{Confidence: aws.Float32(99.9), Name: aws.String("Cat")},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Successful recognize the image sent as "+tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+
+			var uploadInput *s3.PutObjectInput
+
+			mockS3Uploader := mock.NewMockS3Uploader(ctrl)
+			mockS3Uploader.EXPECT().Upload(ctx, gomock.Any()).DoAndReturn(
+				func(
+					_ context.Context,
+					input *s3.PutObjectInput,
+					_ ...func(*manager.Uploader),
+				) (*manager.UploadOutput, error) {
+					uploadInput = input
+
+					return &manager.UploadOutput{}, nil
+				},
+			)
+
+			mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+			mockRekognitionClient.EXPECT().DetectLabels(ctx, gomock.Any()).DoAndReturn(
+				func(
+					_ context.Context,
+					input *rekognition.DetectLabelsInput,
+					_ ...func(*rekognition.Options),
+				) (*rekognition.DetectLabelsOutput, error) {
+					if reflect.DeepEqual(input.Image.Bytes, img) == false {
+						t.Error("\nActually: ", len(input.Image.Bytes), "bytes", "\nExpected: ", len(img), "bytes")
+					}
+
+					return &rekognition.DetectLabelsOutput{Labels: labels}, nil
+				},
+			)
+
+			mockUniqueIdGenerator := mock.NewMockUniqueIdGenerator(ctrl)
+			mockUniqueIdGenerator.EXPECT().Generate().Return(mockUuid, nil)
+
+			imageRecognitionUseCase = &imagerecognition.UseCase{
+				RekognitionClient: mockRekognitionClient,
+				S3Uploader:        mockS3Uploader,
+				UniqueIdGenerator: mockUniqueIdGenerator,
+			}
+
+			res, err := Handler(ctx, tt.req)
+			if err != nil {
+				t.Fatal("Error failed to Handler", err)
+			}
+
+			if res.StatusCode != 200 {
+				t.Error("\nActually: ", res.StatusCode, res.Body, "\nExpected: ", 200)
+			}
+
+			expectedKey := "tmp/" + mockUuid + ".jpg"
+			if aws.ToString(uploadInput.Key) != expectedKey {
+				t.Error("\nActually: ", aws.ToString(uploadInput.Key), "\nExpected: ", expectedKey)
+			}
+
+			expectedBody, _ := json.Marshal(&imagerecognition.Response{ImageId: mockUuid, Labels: labels})
+			if res.Body != string(expectedBody) {
+				t.Error("\nActually: ", res.Body, "\nExpected: ", string(expectedBody))
+			}
+		})
+	}
+
+	t.Run("Failure rekognition returned an error after the upload", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Uploader := mock.NewMockS3Uploader(ctrl)
+		mockS3Uploader.EXPECT().Upload(ctx, gomock.Any()).Return(&manager.UploadOutput{}, nil)
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockRekognitionClient.EXPECT().DetectLabels(ctx, gomock.Any()).Return(nil, errors.New("failed recognition"))
+
+		mockUniqueIdGenerator := mock.NewMockUniqueIdGenerator(ctrl)
+		mockUniqueIdGenerator.EXPECT().Generate().Return(mockUuid, nil)
+
+		imageRecognitionUseCase = &imagerecognition.UseCase{
+			RekognitionClient: mockRekognitionClient,
+			S3Uploader:        mockS3Uploader,
+			UniqueIdGenerator: mockUniqueIdGenerator,
+		}
+
+		res, err := Handler(ctx, tests[0].req)
+		if err != nil {
+			t.Fatal("Error failed to Handler", err)
+		}
+
+		if res.StatusCode != 500 {
+			t.Error("\nActually: ", res.StatusCode, "\nExpected: ", 500)
+		}
+
+		// アップロード済みの画像は判定されるので、エラーでも判定結果を確認する為のIDを返す
+		expectedBody, _ := json.Marshal(&ResponseErrorBody{
+			Message: imagerecognition.ErrRekognition.Error(),
+			ImageId: mockUuid,
+		})
+		if res.Body != string(expectedBody) {
+			t.Error("\nActually: ", res.Body, "\nExpected: ", string(expectedBody))
+		}
+	})
+
+	t.Run("Failure the multipart body does not contain the image", func(t *testing.T) {
+		body, contentType, err := test.CreateMultipartBody("file", "moko-cat.jpg", "image/jpeg", img)
+		if err != nil {
+			t.Fatal("Error failed to test.CreateMultipartBody", err)
+		}
+
+		req := events.APIGatewayV2HTTPRequest{
+			Headers:         map[string]string{"content-type": contentType},
+			Body:            base64.StdEncoding.EncodeToString(body),
+			IsBase64Encoded: true,
+		}
+
+		res, _ := Handler(context.Background(), req)
+		if res.StatusCode != 400 {
+			t.Error("\nActually: ", res.StatusCode, "\nExpected: ", 400)
+		}
+	})
+}
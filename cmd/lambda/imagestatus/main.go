@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/imagestatus"
+	"github.com/pkg/errors"
+)
+
+var (
+	logger             *logging.Logger
+	imageStatusUseCase *imagestatus.UseCase
+)
+
+//nolint:gochecknoinits
+func init() {
+	logger = logging.NewFromEnv()
+
+	region := os.Getenv("REGION")
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		logger.Fatal(ctx, "failed to config.LoadDefaultConfig", err)
+	}
+
+	if _, err := tracing.NewProviderFromEnv(ctx); err != nil {
+		logger.Fatal(ctx, "failed to tracing.NewProviderFromEnv", err)
+	}
+
+	s3Client := &infrastructure.TracingS3Client{Client: s3.NewFromConfig(cfg)}
+
+	imageStatusUseCase = &imagestatus.UseCase{
+		ImageRecordRepository: &infrastructure.S3ImageRecordRepository{
+			S3Client:   s3Client,
+			BucketName: os.Getenv("TRIGGER_BUCKET_NAME"),
+		},
+	}
+}
+
+type ResponseErrorBody struct {
+	Message string `json:"message"`
+}
+
+func createApiGatewayV2Response(statusCode int, resBodyJson []byte) events.APIGatewayV2HTTPResponse {
+	res := events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		Body:            string(resBodyJson),
+		IsBase64Encoded: false,
+	}
+
+	return res
+}
+
+func createErrorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
+	resBody := &ResponseErrorBody{Message: message}
+	resBodyJson, _ := json.Marshal(resBody)
+
+	return createApiGatewayV2Response(statusCode, resBodyJson)
+}
+
+func Handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	defer tracing.Flush(ctx)
+
+	ctx, span := tracing.Start(ctx, "imageStatus.Handler")
+	defer span.End()
+
+	ctx = logging.WithApiGatewayRequestId(logging.WithLambdaRequestId(ctx), req.RequestContext.RequestID)
+
+	res, err := imageStatusUseCase.FindImageRecord(ctx, req.PathParameters["id"])
+	if err != nil {
+		logger.Error(ctx, "failed to imageStatusUseCase.FindImageRecord", err)
+		tracing.RecordError(span, err)
+
+		statusCode := 500
+
+		//nolint:errorlint
+		switch errors.Cause(err) {
+		case imagestatus.ErrInvalidImageId:
+			statusCode = 400
+		case imagestatus.ErrImageNotFound:
+			statusCode = 404
+		}
+
+		resp := createErrorResponse(statusCode, errors.Cause(err).Error())
+
+		return resp, nil
+	}
+
+	resBodyJson, _ := json.Marshal(res)
+
+	statusCode := 200
+	resp := createApiGatewayV2Response(statusCode, resBodyJson)
+
+	return resp, nil
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -2,76 +2,51 @@ package main
 
 import (
 	"context"
-	"log"
-	"os"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/rekognition"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/keitakn/aws-rekognition-sandbox/usecase/catimage"
+	"github.com/keitakn/aws-rekognition-sandbox/internal/catimageevent"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
 )
 
-var useCase *catimage.UseCase
+var (
+	logger    *logging.Logger
+	processor *catimageevent.Processor
+)
 
 //nolint:gochecknoinits
 func init() {
-	region := os.Getenv("REGION")
+	logger = logging.NewFromEnv()
 
-	ctx := context.Background()
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	if err != nil {
-		// TODO ここでエラーが発生した場合、致命的な問題が起きているのでちゃんとしたログを出すように改修する
-		log.Fatalln(err)
+	if _, err := tracing.NewProviderFromEnv(context.Background()); err != nil {
+		logger.Fatal(context.Background(), "failed to tracing.NewProviderFromEnv", err)
 	}
 
-	s3Client := s3.NewFromConfig(cfg)
-
-	rekognitionClient := rekognition.NewFromConfig(cfg)
+	var err error
 
-	useCase = &catimage.UseCase{
-		S3Client:          s3Client,
-		RekognitionClient: rekognitionClient,
+	processor, err = catimageevent.NewProcessorFromEnv(context.Background(), logger, metrics.NewFromEnv())
+	if err != nil {
+		logger.Fatal(context.Background(), "failed to catimageevent.NewProcessorFromEnv", err)
 	}
 }
 
-func Handler(ctx context.Context, event events.S3Event) error {
-	for _, record := range event.Records {
-		// recordの中にイベント発生させたS3のBucket名やKeyが入っている
-		acceptableCatImageRequest := &catimage.Request{
-			TargetS3BucketName:      record.S3.Bucket.Name,
-			TargetS3ObjectKey:       record.S3.Object.Key,
-			TargetS3ObjectVersionId: record.S3.Object.VersionID,
-		}
+// Handler は1件のレコードの処理に失敗しても残りのレコードを処理し、失敗したレコードがある場合のみ BatchError を返す
+// エラーを返すとS3イベント全体が再実行されるが、成功したレコードは IdempotencyStore によってスキップされる
+func Handler(ctx context.Context, event events.S3Event) (err error) {
+	defer tracing.Flush(ctx)
 
-		// ねこ画像かどうかを判定する
-		isAcceptableCatImageResponse, err := useCase.IsAcceptableCatImage(ctx, acceptableCatImageRequest)
-		if err != nil {
-			return err
-		}
+	ctx, span := tracing.Start(ctx, "isAcceptableCatImage.Handler")
+	defer func() { tracing.End(span, err) }()
 
-		// 受け入れ可能なねこ画像ではない場合、ここで処理を中断する
-		if !isAcceptableCatImageResponse.IsAcceptableCatImage {
-			continue
-		}
+	ctx = logging.WithLambdaRequestId(ctx)
 
-		copyCatImageRequest := &catimage.CopyCatImageToDestinationBucketRequest{
-			// TriggerBucketName, DestinationBucketNameに同じ値が設定されているが、同じバケットの異なるディレクトリを使っているから
-			// 実運用の際は別のバケットを指定したほうが良い
-			TriggerBucketName:     os.Getenv("TRIGGER_BUCKET_NAME"),
-			DestinationBucketName: os.Getenv("TRIGGER_BUCKET_NAME"),
-			TargetS3ObjectKey:     acceptableCatImageRequest.TargetS3ObjectKey,
-		}
+	results := processor.ProcessRecords(ctx, event.Records)
 
-		// ここまで来るという事は受け入れ可能なねこ画像なので指定された場所にアップロードする
-		err = useCase.CopyCatImageToDestinationBucket(ctx, copyCatImageRequest)
-		if err != nil {
-			return err
-		}
-	}
+	logger.Info(ctx, "processed records", logging.Fields{"results": results})
 
-	return nil
+	return catimageevent.NewBatchError(results)
 }
 
 func main() {
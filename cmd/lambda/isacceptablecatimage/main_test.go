@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/internal/catimageevent"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/keitakn/aws-rekognition-sandbox/test"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/catimage"
+	"github.com/pkg/errors"
+)
+
+func TestHandler(t *testing.T) {
+	const bucketName = "trigger-bucket"
+	const key = "tmp/abyssinian-cat.jpg"
+	const imgPath = "../../../test/images/abyssinian-cat.jpg"
+
+	t.Run("Failure only the failed record is reported and the others are processed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		const brokenKey = "tmp/broken-image.jpg"
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		// 1件目はS3の障害で失敗するが、2件目は判定される
+		mockS3Client.EXPECT().
+			GetObject(gomock.Any(), test.GetObjectInputWithKey(brokenKey)).
+			Return(nil, context.DeadlineExceeded)
+		test.ExpectAcceptableCatImage(t, mockS3Client, mockRekognitionClient, imgPath)
+
+		processor = &catimageevent.Processor{
+			UseCase:          &catimage.UseCase{S3Client: mockS3Client, RekognitionClient: mockRekognitionClient},
+			IdempotencyStore: infrastructure.NewMemoryIdempotencyStore(),
+		}
+
+		event := events.S3Event{
+			Records: []events.S3EventRecord{
+				test.NewS3EventRecord(bucketName, brokenKey, "0055AED6DCD90281E5"),
+				test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E6"),
+			},
+		}
+
+		err := Handler(ctx, event)
+
+		var batchErr *catimageevent.BatchError
+		if !errors.As(err, &batchErr) {
+			t.Fatal("\nActually: ", err, "\nExpected: ", "*BatchError")
+		}
+
+		if batchErr.Total != 2 || len(batchErr.Failures) != 1 {
+			t.Fatal("\nActually: ", batchErr)
+		}
+
+		failure := batchErr.Failures[0]
+		if failure.Key != brokenKey || failure.Outcome != catimageevent.RecordOutcomeFailed || failure.Error == "" {
+			t.Error("\nActually: ", failure)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/keitakn/aws-rekognition-sandbox/internal/catimageevent"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
+	"github.com/pkg/errors"
+)
+
+var (
+	logger    *logging.Logger
+	processor *catimageevent.Processor
+)
+
+//nolint:gochecknoinits
+func init() {
+	logger = logging.NewFromEnv()
+
+	if _, err := tracing.NewProviderFromEnv(context.Background()); err != nil {
+		logger.Fatal(context.Background(), "failed to tracing.NewProviderFromEnv", err)
+	}
+
+	var err error
+
+	processor, err = catimageevent.NewProcessorFromEnv(context.Background(), logger, metrics.NewFromEnv())
+	if err != nil {
+		logger.Fatal(context.Background(), "failed to catimageevent.NewProcessorFromEnv", err)
+	}
+}
+
+// Handler はS3イベントの通知が入ったSQSのメッセージを isacceptablecatimage と同じように処理する
+// 処理に失敗したレコードを含むメッセージだけを BatchItemFailures として返すので、そのメッセージだけが再実行される
+// 再実行された際に成功済みのレコードは IdempotencyStore によってスキップされる
+// 利用するにはイベントソースマッピングの FunctionResponseTypes に ReportBatchItemFailures を指定する必要がある
+func Handler(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	defer tracing.Flush(ctx)
+
+	// 部分的なバッチレスポンスではエラーを返さないので、失敗したメッセージのエラーを span に記録する
+	var failure error
+
+	ctx, span := tracing.Start(ctx, "isAcceptableCatImageSqs.Handler")
+	defer func() { tracing.End(span, failure) }()
+
+	ctx = logging.WithLambdaRequestId(ctx)
+
+	res := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+
+	for _, message := range event.Records {
+		messageCtx := logging.WithFields(ctx, logging.Fields{"sqsMessageId": message.MessageId})
+
+		if err := handleMessage(messageCtx, message); err != nil {
+			logger.Error(messageCtx, "failed to process message", err)
+
+			failure = err
+
+			res.BatchItemFailures = append(res.BatchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return res, nil
+}
+
+func handleMessage(ctx context.Context, message events.SQSMessage) error {
+	var s3Event events.S3Event
+	if err := json.Unmarshal([]byte(message.Body), &s3Event); err != nil {
+		// 何度実行しても成功しないが、失敗として扱う事でデッドレターキューに移動させて後から確認出来るようにする
+		return errors.Wrap(err, "failed to json.Unmarshal")
+	}
+
+	// 通知を設定した際に送られる s3:TestEvent 等の Records を含まないメッセージは何もせずに成功として扱う
+	results := processor.ProcessRecords(ctx, s3Event.Records)
+
+	logger.Info(ctx, "processed records", logging.Fields{"results": results})
+
+	return catimageevent.NewBatchError(results)
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/internal/catimageevent"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/keitakn/aws-rekognition-sandbox/test"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/catimage"
+)
+
+func newSQSMessage(t *testing.T, messageId string, records ...events.S3EventRecord) events.SQSMessage {
+	t.Helper()
+
+	body, err := json.Marshal(events.S3Event{Records: records})
+	if err != nil {
+		t.Fatal("Error failed to json.Marshal", err)
+	}
+
+	return events.SQSMessage{MessageId: messageId, Body: string(body)}
+}
+
+//nolint:funlen
+func TestHandler(t *testing.T) {
+	const bucketName = "trigger-bucket"
+	const key = "tmp/abyssinian-cat.jpg"
+	const imgPath = "../../../test/images/abyssinian-cat.jpg"
+
+	t.Run("Successful report only the failed messages", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		// 1件目のメッセージはS3の障害で失敗、2件目は判定される
+		mockS3Client.EXPECT().
+			GetObject(gomock.Any(), test.GetObjectInputWithKey("tmp/broken-image.jpg")).
+			Return(nil, context.DeadlineExceeded)
+		test.ExpectAcceptableCatImage(t, mockS3Client, mockRekognitionClient, imgPath)
+
+		processor = &catimageevent.Processor{
+			UseCase:          &catimage.UseCase{S3Client: mockS3Client, RekognitionClient: mockRekognitionClient},
+			IdempotencyStore: infrastructure.NewMemoryIdempotencyStore(),
+		}
+
+		event := events.SQSEvent{
+			Records: []events.SQSMessage{
+				newSQSMessage(t, "message-1", test.NewS3EventRecord(bucketName, "tmp/broken-image.jpg", "0055AED6DCD90281E5")),
+				newSQSMessage(t, "message-2", test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E6")),
+				// 通知を設定した際に送られるテストイベントには Records が含まれない
+				{MessageId: "message-3", Body: `{"Service":"Amazon S3","Event":"s3:TestEvent"}`},
+				{MessageId: "message-4", Body: "invalid json"},
+			},
+		}
+
+		res, err := Handler(ctx, event)
+		if err != nil {
+			t.Fatal("Error failed to Handler", err)
+		}
+
+		expected := events.SQSEventResponse{
+			BatchItemFailures: []events.SQSBatchItemFailure{
+				{ItemIdentifier: "message-1"},
+				{ItemIdentifier: "message-4"},
+			},
+		}
+
+		if reflect.DeepEqual(res, expected) == false {
+			t.Error("\nActually: ", res, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful return empty batch item failures when all messages are processed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		// 同じS3イベントが2通のメッセージで配信されても判定は1回だけ
+		test.ExpectAcceptableCatImage(t, mockS3Client, mockRekognitionClient, imgPath)
+
+		processor = &catimageevent.Processor{
+			UseCase:          &catimage.UseCase{S3Client: mockS3Client, RekognitionClient: mockRekognitionClient},
+			IdempotencyStore: infrastructure.NewMemoryIdempotencyStore(),
+		}
+
+		record := test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E5")
+
+		event := events.SQSEvent{
+			Records: []events.SQSMessage{
+				newSQSMessage(t, "message-1", record),
+				newSQSMessage(t, "message-2", record),
+			},
+		}
+
+		res, err := Handler(ctx, event)
+		if err != nil {
+			t.Fatal("Error failed to Handler", err)
+		}
+
+		if len(res.BatchItemFailures) != 0 {
+			t.Error("\nActually: ", res.BatchItemFailures, "\nExpected: ", "empty")
+		}
+	})
+}
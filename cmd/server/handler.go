@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/keitakn/aws-rekognition-sandbox/imageprocessing"
+	"github.com/keitakn/aws-rekognition-sandbox/imagerequest"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/catimage"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/detectfaces"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/imagerecognition"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/imagestatus"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/presignedupload"
+	"github.com/pkg/errors"
+)
+
+// maxImageRequestBodySize は画像を受け付けるAPIのリクエストボディの上限
+// API Gateway（HTTP API）のペイロードの上限に合わせている
+const maxImageRequestBodySize = 10 * 1024 * 1024
+
+// imageStatusPathPrefix は GET /images/{id} のパスから {id} を取り出す為のプレフィックス
+const imageStatusPathPrefix = "/images/"
+
+type ResponseErrorBody struct {
+	Message string `json:"message"`
+	// ImageId は imageRecognitionHandler でアップロードした後にエラーになった場合に設定される
+	ImageId string `json:"imageId,omitempty"`
+}
+
+// CatImageEvaluationRequestBody はS3イベントの代わりに判定対象のS3オブジェクトを指定する為のリクエストボディ
+type CatImageEvaluationRequestBody struct {
+	BucketName      string `json:"bucketName"`
+	ObjectKey       string `json:"objectKey"`
+	ObjectVersionId string `json:"objectVersionId"`
+}
+
+func writeJsonResponse(w http.ResponseWriter, statusCode int, resBody interface{}) {
+	resBodyJson, err := json.Marshal(resBody)
+	if err != nil {
+		logger.Error(context.Background(), "failed to json.Marshal", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if _, err := w.Write(resBodyJson); err != nil {
+		logger.Error(context.Background(), "failed to http.ResponseWriter.Write", err)
+	}
+}
+
+func writeErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	writeJsonResponse(w, statusCode, &ResponseErrorBody{Message: message})
+}
+
+func allowMethod(method string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeErrorResponse(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeImageRequestBody は cmd/lambda と同じように JSON、multipart/form-data、画像そのもののどれでも受け付ける
+func decodeImageRequestBody(w http.ResponseWriter, r *http.Request) (*imagerequest.Body, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImageRequestBodySize))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read request body")
+	}
+
+	reqBody, err := imagerequest.Decode(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to imagerequest.Decode")
+	}
+
+	return reqBody, nil
+}
+
+// imageRecognitionHandler は cmd/lambda/imagerecognition と同じリクエスト、レスポンスを返す
+func imageRecognitionHandler(u *imagerecognition.UseCase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqBody, err := decodeImageRequestBody(w, r)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "Bad Request")
+
+			return
+		}
+
+		res, err := u.ImageRecognition(r.Context(), imagerecognition.RequestBody{
+			Image:          reqBody.Image,
+			ImageExtension: reqBody.ImageExtension,
+		})
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+
+			//nolint:errorlint
+			if cause := errors.Cause(err); cause == imagerecognition.ErrNotAllowedImageFormat ||
+				cause == imagerecognition.ErrImagePreprocessing {
+				statusCode = http.StatusBadRequest
+			}
+
+			resBody := &ResponseErrorBody{Message: errors.Cause(err).Error()}
+			if res != nil {
+				resBody.ImageId = res.ImageId
+			}
+
+			writeJsonResponse(w, statusCode, resBody)
+
+			return
+		}
+
+		writeJsonResponse(w, http.StatusOK, res)
+	}
+}
+
+// detectFacesHandler は cmd/lambda/detectfaces と同じリクエスト、レスポンスを返す
+func detectFacesHandler(u *detectfaces.UseCase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqBody, err := decodeImageRequestBody(w, r)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "Bad Request")
+
+			return
+		}
+
+		res, err := u.DetectFaces(r.Context(), detectfaces.Request{Image: reqBody.Image})
+		if err != nil {
+			//nolint:errorlint
+			switch errors.Cause(err) {
+			case detectfaces.ErrBase64Decode:
+				writeErrorResponse(w, http.StatusInternalServerError, detectfaces.ErrBase64Decode.Error())
+			case detectfaces.ErrImagePreprocessing:
+				writeErrorResponse(w, http.StatusBadRequest, detectfaces.ErrImagePreprocessing.Error())
+			case detectfaces.ErrUnexpected:
+				writeErrorResponse(w, http.StatusInternalServerError, detectfaces.ErrUnexpected.Error())
+			default:
+				writeErrorResponse(w, http.StatusInternalServerError, "Internal Server Error")
+			}
+
+			return
+		}
+
+		writeJsonResponse(w, http.StatusOK, res)
+	}
+}
+
+// presignedUploadHandler は cmd/lambda/presignedupload と同じリクエスト、レスポンスを返す
+func presignedUploadHandler(u *presignedupload.UseCase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reqBody presignedupload.Request
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "Bad Request")
+
+			return
+		}
+
+		res, err := u.CreatePresignedUploadUrl(r.Context(), reqBody)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+
+			//nolint:errorlint
+			switch errors.Cause(err) {
+			case presignedupload.ErrNotAllowedContentType, presignedupload.ErrInvalidContentLength:
+				statusCode = http.StatusBadRequest
+			}
+
+			writeErrorResponse(w, statusCode, errors.Cause(err).Error())
+
+			return
+		}
+
+		writeJsonResponse(w, http.StatusOK, res)
+	}
+}
+
+func createQuarantineRejectedImageRequest(
+	bucketName string,
+	key string,
+	reasons []catimage.RejectionReason,
+) *catimage.QuarantineRejectedImageRequest {
+	quarantineBucketName := os.Getenv("REJECTED_BUCKET_NAME")
+	if quarantineBucketName == "" {
+		quarantineBucketName = os.Getenv("TRIGGER_BUCKET_NAME")
+	}
+
+	return &catimage.QuarantineRejectedImageRequest{
+		TriggerBucketName:    bucketName,
+		QuarantineBucketName: quarantineBucketName,
+		QuarantinePrefix:     os.Getenv("REJECTED_PREFIX"),
+		TargetS3ObjectKey:    key,
+		RejectionReasons:     reasons,
+	}
+}
+
+// imageStatusHandler は GET /images/{id} で画像の処理状況を返す
+func imageStatusHandler(u *imagestatus.UseCase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		imageId := strings.TrimPrefix(r.URL.Path, imageStatusPathPrefix)
+
+		res, err := u.FindImageRecord(r.Context(), imageId)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+
+			//nolint:errorlint
+			switch errors.Cause(err) {
+			case imagestatus.ErrInvalidImageId:
+				statusCode = http.StatusBadRequest
+			case imagestatus.ErrImageNotFound:
+				statusCode = http.StatusNotFound
+			}
+
+			writeErrorResponse(w, statusCode, errors.Cause(err).Error())
+
+			return
+		}
+
+		writeJsonResponse(w, http.StatusOK, res)
+	}
+}
+
+// catImageEvaluationHandler は cmd/lambda/isacceptablecatimage と同じ判定を手動で実行する
+// cmd/lambda/isacceptablecatimage と同じように受け入れ可能なねこ画像だった場合は cat-images/ にコピーし、
+// 受け入れ不可の場合は REJECTED_PREFIX に移動する
+// ねこの位置が分かる場合は cat-images/cropped/ にねこを中心に切り抜いた画像も作成する
+func catImageEvaluationHandler(u *catimage.UseCase, cropOptions imageprocessing.CropOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reqBody CatImageEvaluationRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "Bad Request")
+
+			return
+		}
+
+		bucketName := reqBody.BucketName
+		if bucketName == "" {
+			bucketName = os.Getenv("TRIGGER_BUCKET_NAME")
+		}
+
+		req := &catimage.Request{
+			TargetS3BucketName:      bucketName,
+			TargetS3ObjectKey:       reqBody.ObjectKey,
+			TargetS3ObjectVersionId: reqBody.ObjectVersionId,
+		}
+
+		res, err := u.IsAcceptableCatImage(r.Context(), req)
+		if err != nil {
+			rejectionReason, ok := catimage.RejectionReasonFromError(err)
+			if !ok {
+				writeErrorResponse(w, http.StatusInternalServerError, errors.Cause(err).Error())
+
+				return
+			}
+
+			res = &catimage.IsAcceptableCatImageResponse{
+				RejectionReasons: []catimage.RejectionReason{rejectionReason},
+			}
+		}
+
+		if !res.IsAcceptableCatImage {
+			quarantineRequest := createQuarantineRejectedImageRequest(bucketName, req.TargetS3ObjectKey, res.RejectionReasons)
+			if err := u.QuarantineRejectedImage(r.Context(), quarantineRequest); err != nil {
+				writeErrorResponse(w, http.StatusInternalServerError, "Internal Server Error")
+
+				return
+			}
+		}
+
+		if res.IsAcceptableCatImage {
+			copyCatImageRequest := &catimage.CopyCatImageToDestinationBucketRequest{
+				TriggerBucketName:     bucketName,
+				DestinationBucketName: os.Getenv("TRIGGER_BUCKET_NAME"),
+				TargetS3ObjectKey:     req.TargetS3ObjectKey,
+				PerceptualHash:        res.PerceptualHash,
+			}
+
+			if err := u.CopyCatImageToDestinationBucket(r.Context(), copyCatImageRequest); err != nil {
+				writeErrorResponse(w, http.StatusInternalServerError, "Internal Server Error")
+
+				return
+			}
+		}
+
+		if res.IsAcceptableCatImage && len(res.Cats) > 0 {
+			cropRequest := &catimage.CreateCroppedCatImageRequest{
+				TriggerBucketName:       bucketName,
+				DestinationBucketName:   os.Getenv("TRIGGER_BUCKET_NAME"),
+				TargetS3ObjectKey:       req.TargetS3ObjectKey,
+				TargetS3ObjectVersionId: req.TargetS3ObjectVersionId,
+				Cats:                    res.Cats,
+				CropOptions:             cropOptions,
+			}
+
+			if _, err := u.CreateCroppedCatImage(r.Context(), cropRequest); err != nil {
+				writeErrorResponse(w, http.StatusInternalServerError, "Internal Server Error")
+
+				return
+			}
+		}
+
+		status := infrastructure.ImageRecordStatusRejected
+		if res.IsAcceptableCatImage {
+			status = infrastructure.ImageRecordStatusAccepted
+		}
+
+		updateRequest := &catimage.UpdateImageRecordRequest{
+			TargetS3ObjectKey: req.TargetS3ObjectKey,
+			Status:            status,
+			Response:          res,
+		}
+
+		if err := u.UpdateImageRecord(r.Context(), updateRequest); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "Internal Server Error")
+
+			return
+		}
+
+		// S3イベントのように再実行されないので、通知に失敗してもログを出すだけにして判定結果は返す
+		notifyRequest := &catimage.NotifyDecisionRequest{TargetS3ObjectKey: req.TargetS3ObjectKey, Response: res}
+		if err := u.NotifyDecision(r.Context(), notifyRequest); err != nil {
+			logger.Error(r.Context(), "failed to notify the decision", err)
+		}
+
+		writeJsonResponse(w, http.StatusOK, res)
+	}
+}
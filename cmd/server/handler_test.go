@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/keitakn/aws-rekognition-sandbox/test"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/imagerecognition"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/presignedupload"
+)
+
+// newTestServeMux はAWSにアクセスしないように、Rekognitionをフィクスチャに、認証情報を固定値にした newServeMux を返す
+func newTestServeMux(t *testing.T) *http.ServeMux {
+	t.Helper()
+
+	t.Setenv("REGION", "ap-northeast-1")
+	t.Setenv("TRIGGER_BUCKET_NAME", "trigger-bucket")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("REKOGNITION_FIXTURE_DIR", "../../test/images")
+	t.Setenv("REKOGNITION_DEFAULT_FIXTURE", "")
+	t.Setenv("IMAGE_RECORD_DIR", "")
+	t.Setenv("CAT_IMAGE_POLICY_PATH", "")
+
+	mux, err := newServeMux(context.Background())
+	if err != nil {
+		t.Fatal("Error failed to newServeMux", err)
+	}
+
+	return mux
+}
+
+func serve(handler http.Handler, method, path, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+//nolint:funlen
+func TestServeMux(t *testing.T) {
+	mux := newTestServeMux(t)
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		contentType     string
+		body            string
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{
+			name:            "the method is not allowed for the image recognition",
+			method:          http.MethodGet,
+			path:            "/images/recognition",
+			expectedStatus:  http.StatusMethodNotAllowed,
+			expectedMessage: "Method Not Allowed",
+		},
+		{
+			name:            "the method is not allowed for the image status",
+			method:          http.MethodDelete,
+			path:            "/images/adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a",
+			expectedStatus:  http.StatusMethodNotAllowed,
+			expectedMessage: "Method Not Allowed",
+		},
+		{
+			name:            "the faces request body is not json",
+			method:          http.MethodPost,
+			path:            "/images/faces",
+			contentType:     "application/json",
+			body:            "not json",
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "Bad Request",
+		},
+		{
+			name:            "the upload url content type is not allowed",
+			method:          http.MethodPost,
+			path:            "/images/upload-url",
+			contentType:     "application/json",
+			body:            `{"contentType":"image/gif","contentLength":1024}`,
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: presignedupload.ErrNotAllowedContentType.Error(),
+		},
+		{
+			name:            "the cat evaluation request body is not json",
+			method:          http.MethodPost,
+			path:            "/images/cat-evaluation",
+			contentType:     "application/json",
+			body:            "not json",
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "Bad Request",
+		},
+		{
+			name:            "the image id is invalid",
+			method:          http.MethodGet,
+			path:            "/images/invalid.id",
+			expectedStatus:  http.StatusBadRequest,
+			expectedMessage: "invalid image id",
+		},
+		{
+			name:            "the image is not found",
+			method:          http.MethodGet,
+			path:            "/images/adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a",
+			expectedStatus:  http.StatusNotFound,
+			expectedMessage: "image not found",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Failure "+tt.name, func(t *testing.T) {
+			rec := serve(mux, tt.method, tt.path, tt.contentType, []byte(tt.body))
+
+			if rec.Code != tt.expectedStatus {
+				t.Error("\nActually: ", rec.Code, rec.Body.String(), "\nExpected: ", tt.expectedStatus)
+			}
+
+			if rec.Header().Get("Content-Type") != "application/json" {
+				t.Error("\nActually: ", rec.Header().Get("Content-Type"), "\nExpected: ", "application/json")
+			}
+
+			var resBody ResponseErrorBody
+			if err := json.Unmarshal(rec.Body.Bytes(), &resBody); err != nil {
+				t.Fatal("Error failed to json.Unmarshal", err)
+			}
+
+			if resBody.Message != tt.expectedMessage {
+				t.Error("\nActually: ", resBody.Message, "\nExpected: ", tt.expectedMessage)
+			}
+		})
+	}
+
+	t.Run("Successful return the allowed method", func(t *testing.T) {
+		rec := serve(mux, http.MethodGet, "/images/upload-url", "", nil)
+
+		if rec.Header().Get("Allow") != http.MethodPost {
+			t.Error("\nActually: ", rec.Header().Get("Allow"), "\nExpected: ", http.MethodPost)
+		}
+	})
+
+	t.Run("Successful detect the faces with the fixture", func(t *testing.T) {
+		img, err := os.ReadFile("../../test/images/moko-cat.jpg")
+		if err != nil {
+			t.Fatal("Error failed to os.ReadFile", err)
+		}
+
+		rec := serve(mux, http.MethodPost, "/images/faces", "image/jpeg", img)
+
+		if rec.Code != http.StatusOK {
+			t.Error("\nActually: ", rec.Code, rec.Body.String(), "\nExpected: ", http.StatusOK)
+		}
+	})
+
+	t.Run("Successful find the image of the presigned upload url", func(t *testing.T) {
+		rec := serve(
+			mux,
+			http.MethodPost,
+			"/images/upload-url",
+			"application/json",
+			[]byte(`{"contentType":"image/jpeg","contentLength":571639}`),
+		)
+
+		if rec.Code != http.StatusOK {
+			t.Fatal("\nActually: ", rec.Code, rec.Body.String(), "\nExpected: ", http.StatusOK)
+		}
+
+		var presigned presignedupload.Response
+		if err := json.Unmarshal(rec.Body.Bytes(), &presigned); err != nil {
+			t.Fatal("Error failed to json.Unmarshal", err)
+		}
+
+		if !strings.Contains(presigned.UploadUrl, "trigger-bucket") || presigned.Method != http.MethodPut {
+			t.Error("\nActually: ", presigned, "\nExpected: ", "PUT to trigger-bucket")
+		}
+
+		// 署名付きURLを発行した時点で /images/{id} で参照出来る
+		rec = serve(mux, http.MethodGet, "/images/"+presigned.ImageId, "", nil)
+
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"uploaded"`) {
+			t.Error("\nActually: ", rec.Code, rec.Body.String(), "\nExpected: ", "uploaded")
+		}
+	})
+}
+
+//nolint:funlen
+func TestImageRecognitionHandler(t *testing.T) {
+	const mockUuid = "adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a"
+
+	img, err := os.ReadFile("../../test/images/moko-cat.jpg")
+	if err != nil {
+		t.Fatal("Error failed to os.ReadFile", err)
+	}
+
+	t.Run("Successful recognize the image sent as multipart/form-data", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		labels := []types.Label{
+			{Confidence: aws.Float32(99.9), Name: aws.String("Cat")},
+		}
+
+		mockS3Uploader := mock.NewMockS3Uploader(ctrl)
+		mockS3Uploader.EXPECT().Upload(gomock.Any(), gomock.Any()).Return(&manager.UploadOutput{}, nil)
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockRekognitionClient.EXPECT().
+			DetectLabels(gomock.Any(), gomock.Any()).
+			Return(&rekognition.DetectLabelsOutput{Labels: labels}, nil)
+
+		mockUniqueIdGenerator := mock.NewMockUniqueIdGenerator(ctrl)
+		mockUniqueIdGenerator.EXPECT().Generate().Return(mockUuid, nil)
+
+		handler := imageRecognitionHandler(&imagerecognition.UseCase{
+			RekognitionClient: mockRekognitionClient,
+			S3Uploader:        mockS3Uploader,
+			UniqueIdGenerator: mockUniqueIdGenerator,
+		})
+
+		body, contentType, err := test.CreateMultipartBody("image", "moko-cat.jpg", "image/jpeg", img)
+		if err != nil {
+			t.Fatal("Error failed to test.CreateMultipartBody", err)
+		}
+
+		rec := serve(handler, http.MethodPost, "/images/recognition", contentType, body)
+
+		if rec.Code != http.StatusOK {
+			t.Error("\nActually: ", rec.Code, rec.Body.String(), "\nExpected: ", http.StatusOK)
+		}
+
+		expectedBody, _ := json.Marshal(&imagerecognition.Response{ImageId: mockUuid, Labels: labels})
+		if reflect.DeepEqual(rec.Body.Bytes(), expectedBody) == false {
+			t.Error("\nActually: ", rec.Body.String(), "\nExpected: ", string(expectedBody))
+		}
+	})
+
+	t.Run("Failure the image format is not allowed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		handler := imageRecognitionHandler(&imagerecognition.UseCase{
+			RekognitionClient: mock.NewMockRekognitionClient(ctrl),
+			S3Uploader:        mock.NewMockS3Uploader(ctrl),
+			UniqueIdGenerator: mock.NewMockUniqueIdGenerator(ctrl),
+		})
+
+		rec := serve(handler, http.MethodPost, "/images/recognition", "image/jpeg", []byte("GIF89a not a jpeg"))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Error("\nActually: ", rec.Code, rec.Body.String(), "\nExpected: ", http.StatusBadRequest)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/internal/catimageevent"
+	"github.com/keitakn/aws-rekognition-sandbox/internal/rekognitionclient"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/catimage"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/detectfaces"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/imagerecognition"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/imagestatus"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/presignedupload"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPort       = "8080"
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 30 * time.Second
+)
+
+// logger はハンドラーとUseCaseで共通して利用する、LOG_LEVEL で出力するログのレベルを変更出来る
+var logger = logging.NewFromEnv()
+
+// newRekognitionClient は REKOGNITION_FIXTURE_DIR が指定されている場合はAWSにアクセスしないフィクスチャの実装を返す
+func newRekognitionClient(cfg aws.Config) (infrastructure.RekognitionClient, error) {
+	fixtureDir := os.Getenv("REKOGNITION_FIXTURE_DIR")
+	if fixtureDir == "" {
+		client, err := rekognitionclient.NewFromEnv(cfg, logger, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to rekognitionclient.NewFromEnv")
+		}
+
+		return client, nil
+	}
+
+	client, err := infrastructure.NewFixtureRekognitionClient(fixtureDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to infrastructure.NewFixtureRekognitionClient")
+	}
+
+	if defaultFixturePath := os.Getenv("REKOGNITION_DEFAULT_FIXTURE"); defaultFixturePath != "" {
+		defaultFixture, err := infrastructure.LoadRekognitionFixture(defaultFixturePath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to infrastructure.LoadRekognitionFixture")
+		}
+
+		client.DefaultFixture = defaultFixture
+	}
+
+	return client, nil
+}
+
+// newImageRecordRepository は IMAGE_RECORD_DIR が指定されている場合はファイルに、それ以外はメモリ上に処理状況を保存する
+func newImageRecordRepository() (infrastructure.ImageRecordRepository, error) {
+	dir := os.Getenv("IMAGE_RECORD_DIR")
+	if dir == "" {
+		return infrastructure.NewMemoryImageRecordRepository(), nil
+	}
+
+	repository, err := infrastructure.NewFileImageRecordRepository(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to infrastructure.NewFileImageRecordRepository")
+	}
+
+	return repository, nil
+}
+
+func newServeMux(ctx context.Context) (*http.ServeMux, error) {
+	region := os.Getenv("REGION")
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to config.LoadDefaultConfig")
+	}
+
+	sdkS3Client := s3.NewFromConfig(cfg)
+	s3Client := &infrastructure.TracingS3Client{Client: sdkS3Client}
+	uploader := &infrastructure.TracingS3Uploader{Uploader: manager.NewUploader(sdkS3Client)}
+
+	rekognitionClient, err := newRekognitionClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	imageRecordRepository, err := newImageRecordRepository()
+	if err != nil {
+		return nil, err
+	}
+
+	imageRecognitionUseCase := &imagerecognition.UseCase{
+		RekognitionClient:     rekognitionClient,
+		S3Uploader:            uploader,
+		UniqueIdGenerator:     &infrastructure.UuidGenerator{},
+		ImageRecordRepository: imageRecordRepository,
+		Logger:                logger,
+	}
+
+	detectFacesUseCase := &detectfaces.UseCase{RekognitionClient: rekognitionClient, Logger: logger}
+
+	presignedUploadUseCase := &presignedupload.UseCase{
+		S3Presigner:           &infrastructure.TracingS3Presigner{Presigner: s3.NewPresignClient(sdkS3Client)},
+		UniqueIdGenerator:     &infrastructure.UuidGenerator{},
+		ImageRecordRepository: imageRecordRepository,
+	}
+
+	policy := catimage.DefaultPolicy()
+	if policyPath := os.Getenv("CAT_IMAGE_POLICY_PATH"); policyPath != "" {
+		policy, err = catimage.LoadPolicy(policyPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to catimage.LoadPolicy")
+		}
+	}
+
+	catImageUseCase := &catimage.UseCase{
+		S3Client:              s3Client,
+		RekognitionClient:     rekognitionClient,
+		Policy:                policy,
+		ImageRecordRepository: imageRecordRepository,
+		WebhookSender:         &infrastructure.HttpWebhookSender{Secret: os.Getenv("WEBHOOK_SECRET")},
+		WebhookUrls:           catimageevent.LoadWebhookUrls(),
+		PerceptualHashIndex:   infrastructure.NewMemoryPerceptualHashIndex(),
+		Logger:                logger,
+	}
+
+	imageStatusUseCase := &imagestatus.UseCase{ImageRecordRepository: imageRecordRepository}
+
+	cropOptions, err := catimageevent.LoadCropOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/images/recognition", allowMethod(http.MethodPost, imageRecognitionHandler(imageRecognitionUseCase)))
+	mux.Handle("/images/faces", allowMethod(http.MethodPost, detectFacesHandler(detectFacesUseCase)))
+	mux.Handle("/images/upload-url", allowMethod(http.MethodPost, presignedUploadHandler(presignedUploadUseCase)))
+	mux.Handle(
+		"/images/cat-evaluation",
+		allowMethod(http.MethodPost, catImageEvaluationHandler(catImageUseCase, cropOptions)),
+	)
+	// "/images/" は上記以外の "/images/{id}" に一致する
+	mux.Handle(imageStatusPathPrefix, allowMethod(http.MethodGet, imageStatusHandler(imageStatusUseCase)))
+
+	return mux, nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// OTEL_EXPORTER_OTLP_ENDPOINT を指定するとローカルのJaeger等にトレースを送信出来る
+	tracerProvider, err := tracing.NewProviderFromEnv(ctx)
+	if err != nil {
+		logger.Fatal(ctx, "failed to tracing.NewProviderFromEnv", err)
+	}
+
+	mux, err := newServeMux(ctx)
+	if err != nil {
+		logger.Fatal(ctx, "failed to newServeMux", err)
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = defaultPort
+	}
+
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	go func() {
+		logger.Info(ctx, "server started", logging.Fields{"addr": server.Addr})
+
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal(ctx, "failed to server.ListenAndServe", err)
+		}
+	}()
+
+	// SIGINT, SIGTERM を受け取ったら処理中のリクエストが終わるのを待ってからサーバーを停止する
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error(shutdownCtx, "failed to shutdown server", err)
+	}
+
+	if tracerProvider != nil {
+		if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+			logger.Error(shutdownCtx, "failed to shutdown tracer provider", err)
+		}
+	}
+
+	logger.Info(shutdownCtx, "server stopped")
+}
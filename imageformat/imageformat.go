@@ -0,0 +1,134 @@
+package imageformat
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Format は画像の先頭バイト（マジックナンバー）から判定した画像形式
+type Format string
+
+const (
+	Unknown Format = ""
+	Jpeg    Format = "jpeg"
+	Png     Format = "png"
+	Webp    Format = "webp"
+	Gif     Format = "gif"
+	Heic    Format = "heic"
+	Bmp     Format = "bmp"
+)
+
+// HeaderSize は画像形式の判定に必要な先頭のバイト数
+// S3オブジェクトを判定する際はこのサイズだけRangeを指定して取得すれば良い
+const HeaderSize = 16
+
+var (
+	jpegSignature = []byte{0xFF, 0xD8, 0xFF}
+	pngSignature  = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+	gif87aHeader  = []byte("GIF87a")
+	gif89aHeader  = []byte("GIF89a")
+	riffHeader    = []byte("RIFF")
+	webpHeader    = []byte("WEBP")
+	ftypBox       = []byte("ftyp")
+	bmpHeader     = []byte("BM")
+)
+
+// HEIC, HEIFのftypボックスに含まれるブランド
+var heicBrands = [...]string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+func Detect(b []byte) Format {
+	switch {
+	case bytes.HasPrefix(b, jpegSignature):
+		return Jpeg
+	case bytes.HasPrefix(b, pngSignature):
+		return Png
+	case bytes.HasPrefix(b, gif87aHeader), bytes.HasPrefix(b, gif89aHeader):
+		return Gif
+	case len(b) >= 12 && bytes.Equal(b[0:4], riffHeader) && bytes.Equal(b[8:12], webpHeader):
+		return Webp
+	case len(b) >= 12 && bytes.Equal(b[4:8], ftypBox) && isHeicBrand(string(b[8:12])):
+		return Heic
+	case bytes.HasPrefix(b, bmpHeader):
+		return Bmp
+	default:
+		return Unknown
+	}
+}
+
+// FromExtension は拡張子から想定される画像形式を返す
+// .e.g. ".jpg", ".JPEG" の場合は Jpeg
+func FromExtension(ext string) Format {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return Jpeg
+	case ".png":
+		return Png
+	case ".webp":
+		return Webp
+	case ".gif":
+		return Gif
+	case ".heic", ".heif":
+		return Heic
+	case ".bmp":
+		return Bmp
+	default:
+		return Unknown
+	}
+}
+
+// FromContentType はContent-Typeから想定される画像形式を返す
+// .e.g. "image/jpeg", "image/jpg" の場合は Jpeg
+func FromContentType(contentType string) Format {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+
+	switch mediaType {
+	case "image/jpeg", "image/jpg", "image/pjpeg":
+		return Jpeg
+	case "image/png":
+		return Png
+	case "image/webp":
+		return Webp
+	case "image/gif":
+		return Gif
+	case "image/heic", "image/heif":
+		return Heic
+	case "image/bmp", "image/x-ms-bmp":
+		return Bmp
+	default:
+		return Unknown
+	}
+}
+
+func (f Format) Extension() string {
+	switch f {
+	case Jpeg:
+		return ".jpg"
+	case Png, Webp, Gif, Heic, Bmp:
+		return "." + string(f)
+	case Unknown:
+		return ""
+	default:
+		return ""
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case Jpeg, Png, Webp, Gif, Heic, Bmp:
+		return "image/" + string(f)
+	case Unknown:
+		return "application/octet-stream"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func isHeicBrand(brand string) bool {
+	for _, v := range heicBrands {
+		if brand == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,106 @@
+package imageformat
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	imageTests := []struct {
+		imgPath  string
+		expected Format
+	}{
+		{imgPath: "../test/images/moko-cat.jpg", expected: Jpeg},
+		{imgPath: "../test/images/moko-cat.jpeg", expected: Jpeg},
+		{imgPath: "../test/images/munchkin-cat.png", expected: Png},
+	}
+
+	for _, tt := range imageTests {
+		tt := tt
+		t.Run("Successful detect the format of "+tt.imgPath, func(t *testing.T) {
+			img, err := os.ReadFile(tt.imgPath)
+			if err != nil {
+				t.Fatal("Error failed to os.ReadFile", err)
+			}
+
+			actual := Detect(img)
+			if actual != tt.expected {
+				t.Error("\nActually: ", actual, "\nExpected: ", tt.expected)
+			}
+		})
+	}
+
+	headerTests := []struct {
+		name     string
+		header   []byte
+		expected Format
+	}{
+		{name: "webp", header: []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), expected: Webp},
+		{name: "gif", header: []byte("GIF89a\x01\x00\x01\x00"), expected: Gif},
+		{name: "heic", header: []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), expected: Heic},
+		{name: "bmp", header: []byte("BM\x36\x00\x0c\x00\x00\x00"), expected: Bmp},
+		{name: "riff but not webp", header: []byte("RIFF\x24\x00\x00\x00WAVEfmt "), expected: Unknown},
+		{name: "mp4 is not heic", header: []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00"), expected: Unknown},
+		{name: "text", header: []byte("this is not an image"), expected: Unknown},
+		{name: "empty", header: []byte{}, expected: Unknown},
+	}
+
+	for _, tt := range headerTests {
+		tt := tt
+		t.Run("Successful detect the format of "+tt.name, func(t *testing.T) {
+			actual := Detect(tt.header)
+			if actual != tt.expected {
+				t.Error("\nActually: ", actual, "\nExpected: ", tt.expected)
+			}
+		})
+	}
+}
+
+func TestFromExtension(t *testing.T) {
+	tests := []struct {
+		ext      string
+		expected Format
+	}{
+		{ext: ".jpg", expected: Jpeg},
+		{ext: ".JPEG", expected: Jpeg},
+		{ext: ".png", expected: Png},
+		{ext: ".webp", expected: Webp},
+		{ext: ".heif", expected: Heic},
+		{ext: ".txt", expected: Unknown},
+		{ext: "", expected: Unknown},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Successful the format of extension "+tt.ext, func(t *testing.T) {
+			actual := FromExtension(tt.ext)
+			if actual != tt.expected {
+				t.Error("\nActually: ", actual, "\nExpected: ", tt.expected)
+			}
+		})
+	}
+}
+
+func TestFromContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    Format
+	}{
+		{contentType: "image/jpeg", expected: Jpeg},
+		{contentType: "image/JPG", expected: Jpeg},
+		{contentType: "image/png; charset=binary", expected: Png},
+		{contentType: "image/webp", expected: Webp},
+		{contentType: "application/octet-stream", expected: Unknown},
+		{contentType: "", expected: Unknown},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Successful the format of content type "+tt.contentType, func(t *testing.T) {
+			actual := FromContentType(tt.contentType)
+			if actual != tt.expected {
+				t.Error("\nActually: ", actual, "\nExpected: ", tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/keitakn/aws-rekognition-sandbox/imageformat"
+	"github.com/pkg/errors"
+	"golang.org/x/image/webp"
+)
+
+const (
+	// JpegQuality はJPEGにエンコードする際の品質
+	JpegQuality = 90
+	// MaxPixels はデコードする画像の画素数（幅×高さ）の上限、48メガピクセルのスマートフォンの写真はデコード出来る
+	// ファイルサイズが小さくても画素数が非常に多い画像（decompression bomb）はデコードするとメモリが足りなくなる
+	MaxPixels = 50 * 1000 * 1000
+)
+
+var (
+	ErrUnsupportedImageFormat = errors.New("unsupported image format")
+	ErrTooManyPixels          = errors.New("image has too many pixels")
+)
+
+// Decode は画像をデコードする
+// 画素数が MaxPixels を超える場合はデコードする前に ErrTooManyPixels を返す
+// JPEGにExifのOrientationが設定されている場合は、Rekognitionと同じように向きを補正した画像を返す
+func Decode(b []byte) (image.Image, imageformat.Format, error) {
+	format := imageformat.Detect(b)
+
+	var decode func(r io.Reader) (image.Image, error)
+
+	switch format {
+	case imageformat.Jpeg:
+		decode = jpeg.Decode
+	case imageformat.Png:
+		decode = png.Decode
+	case imageformat.Webp:
+		decode = webp.Decode
+	case imageformat.Gif:
+		decode = gif.Decode
+	case imageformat.Heic, imageformat.Bmp, imageformat.Unknown:
+		return nil, format, errors.Wrap(ErrUnsupportedImageFormat, "image format is "+string(format))
+	default:
+		return nil, format, errors.Wrap(ErrUnsupportedImageFormat, "image format is "+string(format))
+	}
+
+	if err := checkPixels(b); err != nil {
+		return nil, format, err
+	}
+
+	img, err := decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, format, errors.Wrap(err, "failed to decode image")
+	}
+
+	if format == imageformat.Jpeg {
+		img = applyOrientation(img, readExifOrientation(b))
+	}
+
+	return img, format, nil
+}
+
+// checkPixels は画像のヘッダーだけを読み込んで画素数が MaxPixels 以下か確認する
+func checkPixels(b []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "failed to image.DecodeConfig")
+	}
+
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return errors.Wrap(ErrTooManyPixels, fmt.Sprintf("image size is %dx%d", config.Width, config.Height))
+	}
+
+	return nil
+}
+
+// Encode は画像をエンコードする
+// Goの標準ライブラリ等にはWebP, GIF（アニメーションを保持しない）のエンコーダーが無いので、それらはPNGとしてエンコードする
+// 実際にエンコードした形式を返すので、拡張子やContent-Typeはそれに合わせる事
+func Encode(img image.Image, format imageformat.Format) ([]byte, imageformat.Format, error) {
+	var buf bytes.Buffer
+
+	if format == imageformat.Jpeg {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: JpegQuality}); err != nil {
+			return nil, format, errors.Wrap(err, "failed to jpeg.Encode")
+		}
+
+		return buf.Bytes(), imageformat.Jpeg, nil
+	}
+
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, format, errors.Wrap(err, "failed to png.Encode")
+	}
+
+	return buf.Bytes(), imageformat.Png, nil
+}
+
+// Crop は rect の範囲を切り抜いた画像を返す
+// rect は img.Bounds() を基準とした座標で指定する
+func Crop(img image.Image, rect image.Rectangle) image.Image {
+	rect = rect.Add(img.Bounds().Min).Intersect(img.Bounds())
+
+	if subImager, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return subImager.SubImage(rect)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+
+	return dst
+}
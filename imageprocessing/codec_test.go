@@ -0,0 +1,159 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/keitakn/aws-rekognition-sandbox/imageformat"
+	"github.com/pkg/errors"
+)
+
+// pngWithSize は1x1のPNGのIHDRチャンクの幅と高さを書き換える
+// 画素数の確認はヘッダーだけで行うので、実際の画素データが足りなくても良い
+func pngWithSize(t *testing.T, width uint32, height uint32) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal("Error failed to png.Encode", err)
+	}
+
+	b := buf.Bytes()
+
+	// シグネチャ（8バイト）、IHDRチャンクの長さ（4バイト）に続けて "IHDR"、幅、高さ、その後の5バイトの後にCRCが続く
+	const ihdrTypeOffset = 12
+	binary.BigEndian.PutUint32(b[ihdrTypeOffset+4:], width)
+	binary.BigEndian.PutUint32(b[ihdrTypeOffset+8:], height)
+	binary.BigEndian.PutUint32(b[ihdrTypeOffset+17:], crc32.ChecksumIEEE(b[ihdrTypeOffset:ihdrTypeOffset+17]))
+
+	return b
+}
+
+func TestDecodeAndEncode(t *testing.T) {
+	tests := []struct {
+		imgPath          string
+		expectedFormat   imageformat.Format
+		expectedEncoding imageformat.Format
+	}{
+		{imgPath: "../test/images/moko-cat.jpg", expectedFormat: imageformat.Jpeg, expectedEncoding: imageformat.Jpeg},
+		{imgPath: "../test/images/munchkin-cat.png", expectedFormat: imageformat.Png, expectedEncoding: imageformat.Png},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Successful crop and encode "+tt.imgPath, func(t *testing.T) {
+			b, err := os.ReadFile(tt.imgPath)
+			if err != nil {
+				t.Fatal("Error failed to os.ReadFile", err)
+			}
+
+			img, format, err := Decode(b)
+			if err != nil {
+				t.Fatal("Error failed to Decode", err)
+			}
+
+			if format != tt.expectedFormat {
+				t.Error("\nActually: ", format, "\nExpected: ", tt.expectedFormat)
+			}
+
+			rect := image.Rect(10, 20, 110, 70)
+			cropped := Crop(img, rect)
+
+			encoded, encodedFormat, err := Encode(cropped, format)
+			if err != nil {
+				t.Fatal("Error failed to Encode", err)
+			}
+
+			if encodedFormat != tt.expectedEncoding {
+				t.Error("\nActually: ", encodedFormat, "\nExpected: ", tt.expectedEncoding)
+			}
+
+			decoded, _, err := Decode(encoded)
+			if err != nil {
+				t.Fatal("Error failed to Decode", err)
+			}
+
+			if decoded.Bounds().Dx() != rect.Dx() || decoded.Bounds().Dy() != rect.Dy() {
+				t.Error("\nActually: ", decoded.Bounds(), "\nExpected: ", rect)
+			}
+		})
+	}
+
+	t.Run("Failure unsupported image format", func(t *testing.T) {
+		_, _, err := Decode([]byte("this is not an image"))
+
+		if !errors.Is(err, ErrUnsupportedImageFormat) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrUnsupportedImageFormat)
+		}
+	})
+
+	t.Run("Failure too many pixels", func(t *testing.T) {
+		_, _, err := Decode(pngWithSize(t, 20000, 20000))
+
+		if !errors.Is(err, ErrTooManyPixels) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrTooManyPixels)
+		}
+	})
+}
+
+//nolint:funlen
+func TestApplyOrientation(t *testing.T) {
+	// 2x1 の画像の左側を赤、右側を青にして、補正後の位置を確認する
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		redAt       image.Point
+		blueAt      image.Point
+	}{
+		{orientation: orientationNormal, size: image.Pt(2, 1), redAt: image.Pt(0, 0), blueAt: image.Pt(1, 0)},
+		{orientation: orientationFlipH, size: image.Pt(2, 1), redAt: image.Pt(1, 0), blueAt: image.Pt(0, 0)},
+		{orientation: orientationRotate180, size: image.Pt(2, 1), redAt: image.Pt(1, 0), blueAt: image.Pt(0, 0)},
+		{orientation: orientationRotate90, size: image.Pt(1, 2), redAt: image.Pt(0, 0), blueAt: image.Pt(0, 1)},
+		{orientation: orientationRotate270, size: image.Pt(1, 2), redAt: image.Pt(0, 1), blueAt: image.Pt(0, 0)},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Successful apply orientation", func(t *testing.T) {
+			actual := applyOrientation(src, tt.orientation)
+
+			if actual.Bounds().Size() != tt.size {
+				t.Error("\nActually: ", actual.Bounds().Size(), "\nExpected: ", tt.size)
+			}
+
+			if actual.At(tt.redAt.X, tt.redAt.Y) != red {
+				t.Error("\nActually: ", actual.At(tt.redAt.X, tt.redAt.Y), "\nExpected: ", red)
+			}
+
+			if actual.At(tt.blueAt.X, tt.blueAt.Y) != blue {
+				t.Error("\nActually: ", actual.At(tt.blueAt.X, tt.blueAt.Y), "\nExpected: ", blue)
+			}
+		})
+	}
+
+	t.Run("Successful read orientation from exif", func(t *testing.T) {
+		// SOI + APP1(Exif, ビッグエンディアン, IFD0 に Orientation = 6 のみ) + SOS
+		b := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x22}
+		b = append(b, "Exif\x00\x00MM\x00\x2A\x00\x00\x00\x08"...)
+		b = append(b, 0x00, 0x01, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, 0x06, 0x00, 0x00)
+		b = append(b, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xDA)
+
+		actual := readExifOrientation(b)
+		if actual != orientationRotate90 {
+			t.Error("\nActually: ", actual, "\nExpected: ", orientationRotate90)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package imageprocessing
+
+import (
+	"image"
+	"math"
+)
+
+// RelativeBox は画像内の位置を画像全体の幅、高さに対する比率（0〜1）で表す
+// RekognitionのBoundingBoxと同じ表現
+type RelativeBox struct {
+	Left   float64
+	Top    float64
+	Width  float64
+	Height float64
+}
+
+type CropOptions struct {
+	// Padding は切り抜く範囲を BoundingBox の幅、高さに対してどれだけ広げるかの比率
+	// .e.g. 0.1 の場合は上下左右それぞれに幅、高さの10%ずつ広げる
+	Padding float64
+	// AspectRatio は切り抜く範囲の 幅/高さ、0 の場合は BoundingBox の比率のまま切り抜く
+	// .e.g. 1 の場合は正方形
+	AspectRatio float64
+}
+
+// CropRectangle は画像の大きさ、BoundingBox、CropOptions から切り抜く範囲を計算する
+// 範囲は画像からはみ出さないように中心をずらして調整し、それでも収まらない場合はアスペクト比を保ったまま縮小する
+func CropRectangle(width int, height int, box RelativeBox, opts CropOptions) image.Rectangle {
+	imageWidth := float64(width)
+	imageHeight := float64(height)
+
+	w := box.Width * imageWidth
+	h := box.Height * imageHeight
+	centerX := box.Left*imageWidth + w/2
+	centerY := box.Top*imageHeight + h/2
+
+	if opts.Padding > 0 {
+		w += w * opts.Padding * 2
+		h += h * opts.Padding * 2
+	}
+
+	if opts.AspectRatio > 0 && w > 0 && h > 0 {
+		if w/h < opts.AspectRatio {
+			w = h * opts.AspectRatio
+		} else {
+			h = w / opts.AspectRatio
+		}
+	}
+
+	// 画像より大きくなった場合はアスペクト比を保ったまま画像に収まるように縮小する
+	if scale := math.Min(imageWidth/w, imageHeight/h); scale < 1 {
+		w *= scale
+		h *= scale
+	}
+
+	left := clamp(centerX-w/2, 0, imageWidth-w)
+	top := clamp(centerY-h/2, 0, imageHeight-h)
+
+	rect := image.Rect(
+		int(math.Round(left)),
+		int(math.Round(top)),
+		int(math.Round(left+w)),
+		int(math.Round(top+h)),
+	)
+
+	return rect.Intersect(image.Rect(0, 0, width, height))
+}
+
+func clamp(v, lower, upper float64) float64 {
+	if v < lower {
+		return lower
+	}
+
+	if v > upper {
+		return upper
+	}
+
+	return v
+}
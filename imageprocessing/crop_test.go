@@ -0,0 +1,68 @@
+package imageprocessing
+
+import (
+	"image"
+	"testing"
+)
+
+func TestCropRectangle(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    int
+		height   int
+		box      RelativeBox
+		opts     CropOptions
+		expected image.Rectangle
+	}{
+		{
+			name:     "bounding box as it is",
+			width:    1000,
+			height:   1000,
+			box:      RelativeBox{Left: 0.2, Top: 0.3, Width: 0.4, Height: 0.2},
+			opts:     CropOptions{},
+			expected: image.Rect(200, 300, 600, 500),
+		},
+		{
+			name:     "with padding",
+			width:    1000,
+			height:   1000,
+			box:      RelativeBox{Left: 0.2, Top: 0.3, Width: 0.4, Height: 0.2},
+			opts:     CropOptions{Padding: 0.1},
+			expected: image.Rect(160, 280, 640, 520),
+		},
+		{
+			name:     "square aspect ratio widens the shorter side",
+			width:    1000,
+			height:   1000,
+			box:      RelativeBox{Left: 0.2, Top: 0.3, Width: 0.4, Height: 0.2},
+			opts:     CropOptions{AspectRatio: 1},
+			expected: image.Rect(200, 200, 600, 600),
+		},
+		{
+			name:     "shifted to stay inside the image",
+			width:    1000,
+			height:   1000,
+			box:      RelativeBox{Left: 0, Top: 0, Width: 0.2, Height: 0.4},
+			opts:     CropOptions{AspectRatio: 1},
+			expected: image.Rect(0, 0, 400, 400),
+		},
+		{
+			name:     "scaled down when larger than the image",
+			width:    800,
+			height:   400,
+			box:      RelativeBox{Left: 0.25, Top: 0, Width: 0.5, Height: 1},
+			opts:     CropOptions{Padding: 0.5, AspectRatio: 1},
+			expected: image.Rect(200, 0, 600, 400),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Successful "+tt.name, func(t *testing.T) {
+			actual := CropRectangle(tt.width, tt.height, tt.box, tt.opts)
+			if actual != tt.expected {
+				t.Error("\nActually: ", actual, "\nExpected: ", tt.expected)
+			}
+		})
+	}
+}
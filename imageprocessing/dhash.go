@@ -0,0 +1,83 @@
+package imageprocessing
+
+import (
+	"image"
+	"math/bits"
+)
+
+const (
+	dHashWidth  = 9
+	dHashHeight = 8
+	// dHashMaxSamples は縮小する際に1マスあたり縦横それぞれ何ピクセルまで平均を取るか
+	// 大きな画像でも全てのピクセルを読まなくて済むように間引く
+	dHashMaxSamples = 16
+)
+
+// DHash は画像の知覚ハッシュ（difference hash）を返す
+// 画像を9x8のグレースケールに縮小し、横に隣り合うピクセルの明るさの大小を64ビットで表す
+// サイズや圧縮率が異なるだけの同じ写真はハミング距離が小さくなる
+func DHash(img image.Image) uint64 {
+	var gray [dHashHeight][dHashWidth]float64
+
+	bounds := img.Bounds()
+
+	for y := 0; y < dHashHeight; y++ {
+		for x := 0; x < dHashWidth; x++ {
+			cell := image.Rect(
+				bounds.Min.X+bounds.Dx()*x/dHashWidth,
+				bounds.Min.Y+bounds.Dy()*y/dHashHeight,
+				bounds.Min.X+bounds.Dx()*(x+1)/dHashWidth,
+				bounds.Min.Y+bounds.Dy()*(y+1)/dHashHeight,
+			)
+
+			gray[y][x] = averageLuminance(img, cell)
+		}
+	}
+
+	var hash uint64
+
+	for y := 0; y < dHashHeight; y++ {
+		for x := 0; x < dHashWidth-1; x++ {
+			hash <<= 1
+			if gray[y][x] < gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// HammingDistance は2つの知覚ハッシュで異なるビットの数を返す、0なら同じ画像と見なせる
+func HammingDistance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+func averageLuminance(img image.Image, rect image.Rectangle) float64 {
+	if rect.Empty() {
+		// 画像が9x8より小さい場合は1ピクセルを複数のマスで使う
+		rect = image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+1, rect.Min.Y+1).Intersect(img.Bounds())
+		if rect.Empty() {
+			return 0
+		}
+	}
+
+	stepX := (rect.Dx() + dHashMaxSamples - 1) / dHashMaxSamples
+	stepY := (rect.Dy() + dHashMaxSamples - 1) / dHashMaxSamples
+
+	var (
+		sum   float64
+		count int
+	)
+
+	for y := rect.Min.Y; y < rect.Max.Y; y += stepY {
+		for x := rect.Min.X; x < rect.Max.X; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			// ITU-R BT.601 の輝度
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			count++
+		}
+	}
+
+	return sum / float64(count)
+}
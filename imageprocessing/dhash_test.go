@@ -0,0 +1,81 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"testing"
+)
+
+func decodeTestImage(t *testing.T, imgPath string) image.Image {
+	t.Helper()
+
+	b, err := os.ReadFile(imgPath)
+	if err != nil {
+		t.Fatal("Error failed to os.ReadFile", err)
+	}
+
+	img, _, err := Decode(b)
+	if err != nil {
+		t.Fatal("Error failed to Decode", err)
+	}
+
+	return img
+}
+
+// resizeAndCompress はサイズを半分にして低い品質のJPEGで保存し直した画像を返す
+func resizeAndCompress(t *testing.T, img image.Image) image.Image {
+	t.Helper()
+
+	bounds := img.Bounds()
+	resized := image.NewRGBA(image.Rect(0, 0, bounds.Dx()/2, bounds.Dy()/2))
+
+	for y := 0; y < resized.Bounds().Dy(); y++ {
+		for x := 0; x < resized.Bounds().Dx(); x++ {
+			resized.Set(x, y, img.At(bounds.Min.X+x*2, bounds.Min.Y+y*2))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 30}); err != nil {
+		t.Fatal("Error failed to jpeg.Encode", err)
+	}
+
+	compressed, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal("Error failed to jpeg.Decode", err)
+	}
+
+	return compressed
+}
+
+func TestDHash(t *testing.T) {
+	const nearDuplicateDistance = 5
+
+	original := decodeTestImage(t, "../test/images/abyssinian-cat.jpg")
+
+	t.Run("Successful the same photo saved in a different size is near", func(t *testing.T) {
+		distance := HammingDistance(DHash(original), DHash(resizeAndCompress(t, original)))
+		if distance > nearDuplicateDistance {
+			t.Error("\nActually: ", distance, "\nExpected: ", "<= ", nearDuplicateDistance)
+		}
+	})
+
+	t.Run("Successful the different photos are far", func(t *testing.T) {
+		other := decodeTestImage(t, "../test/images/munchkin-cat.png")
+
+		distance := HammingDistance(DHash(original), DHash(other))
+		if distance <= nearDuplicateDistance {
+			t.Error("\nActually: ", distance, "\nExpected: ", "> ", nearDuplicateDistance)
+		}
+	})
+
+	t.Run("Successful hash the image smaller than the hash size", func(t *testing.T) {
+		tiny := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+		if DHash(tiny) != 0 {
+			t.Error("\nActually: ", DHash(tiny), "\nExpected: ", 0)
+		}
+	})
+}
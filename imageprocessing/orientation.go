@@ -0,0 +1,167 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// Exif の Orientation の値
+// https://www.cipa.jp/std/documents/j/DC-008-2012_J.pdf
+const (
+	orientationNormal     = 1
+	orientationFlipH      = 2
+	orientationRotate180  = 3
+	orientationFlipV      = 4
+	orientationTranspose  = 5
+	orientationRotate90   = 6
+	orientationTransverse = 7
+	orientationRotate270  = 8
+)
+
+const (
+	jpegMarkerPrefix = 0xFF
+	jpegMarkerSOI    = 0xD8
+	jpegMarkerAPP1   = 0xE1
+	jpegMarkerSOS    = 0xDA
+	exifTagOrient    = 0x0112
+	tiffHeaderSize   = 8
+	ifdEntrySize     = 12
+	bytesPerPixel    = 4
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// readExifOrientation はJPEGのAPP1セグメントからExifのOrientationを読み取る
+// Exifが存在しない、または読み取れない場合は orientationNormal を返す
+func readExifOrientation(b []byte) int {
+	if len(b) < 2 || b[0] != jpegMarkerPrefix || b[1] != jpegMarkerSOI {
+		return orientationNormal
+	}
+
+	for pos := 2; pos+4 <= len(b); {
+		if b[pos] != jpegMarkerPrefix {
+			return orientationNormal
+		}
+
+		marker := b[pos+1]
+		if marker == jpegMarkerSOS {
+			// これ以降は画像データなのでExifは存在しない
+			return orientationNormal
+		}
+
+		segmentLength := int(binary.BigEndian.Uint16(b[pos+2 : pos+4]))
+		segmentEnd := pos + 2 + segmentLength
+
+		if segmentLength < 2 || segmentEnd > len(b) {
+			return orientationNormal
+		}
+
+		segment := b[pos+4 : segmentEnd]
+		if marker == jpegMarkerAPP1 && bytes.HasPrefix(segment, exifHeader) {
+			return readTiffOrientation(segment[len(exifHeader):])
+		}
+
+		pos = segmentEnd
+	}
+
+	return orientationNormal
+}
+
+func readTiffOrientation(tiff []byte) int {
+	if len(tiff) < tiffHeaderSize {
+		return orientationNormal
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return orientationNormal
+	}
+
+	ifdOffset := int(order.Uint32(tiff[4:8]))
+	if ifdOffset+2 > len(tiff) {
+		return orientationNormal
+	}
+
+	entryCount := int(order.Uint16(tiff[ifdOffset : ifdOffset+2]))
+	for i := 0; i < entryCount; i++ {
+		entry := ifdOffset + 2 + i*ifdEntrySize
+		if entry+ifdEntrySize > len(tiff) {
+			return orientationNormal
+		}
+
+		if order.Uint16(tiff[entry:entry+2]) != exifTagOrient {
+			continue
+		}
+
+		orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+		if orientation < orientationNormal || orientation > orientationRotate270 {
+			return orientationNormal
+		}
+
+		return orientation
+	}
+
+	return orientationNormal
+}
+
+// applyOrientation はExifのOrientationに従って画像の向きを補正する
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation == orientationNormal {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := w, h
+	if orientation >= orientationTranspose {
+		dstW, dstH = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := orientedPoint(x, y, w, h, orientation)
+
+			srcOffset := src.PixOffset(x, y)
+			dstOffset := dst.PixOffset(dx, dy)
+			copy(dst.Pix[dstOffset:dstOffset+bytesPerPixel], src.Pix[srcOffset:srcOffset+bytesPerPixel])
+		}
+	}
+
+	return dst
+}
+
+// orientedPoint は補正前の座標 (x, y) が補正後の画像のどの座標になるかを返す
+func orientedPoint(x, y, w, h, orientation int) (int, int) {
+	switch orientation {
+	case orientationFlipH:
+		return w - 1 - x, y
+	case orientationRotate180:
+		return w - 1 - x, h - 1 - y
+	case orientationFlipV:
+		return x, h - 1 - y
+	case orientationTranspose:
+		return y, x
+	case orientationRotate90:
+		return h - 1 - y, x
+	case orientationTransverse:
+		return h - 1 - y, w - 1 - x
+	case orientationRotate270:
+		return y, w - 1 - x
+	default:
+		return x, y
+	}
+}
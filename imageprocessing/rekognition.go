@@ -0,0 +1,133 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"github.com/keitakn/aws-rekognition-sandbox/imageformat"
+	"github.com/pkg/errors"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// MaxRekognitionImageBytes はRekognitionに画像のバイト列を直接渡す場合の上限
+	// https://docs.aws.amazon.com/ja_jp/rekognition/latest/dg/limits.html
+	MaxRekognitionImageBytes = 5 * 1024 * 1024
+	// MaxRekognitionImageDimension はRekognitionに渡す画像の幅、高さの上限
+	// Rekognitionの制限ではないが、これより大きくても解析結果は変わらずサイズが増えるだけなので縮小する
+	MaxRekognitionImageDimension = 4096
+)
+
+// 縮小してもサイズが上限を超える場合に試すJPEGの品質
+var rekognitionJpegQualities = [...]int{JpegQuality, 80, 70, 60}
+
+// rekognitionDownscaleRate は全ての品質を試してもサイズが上限を超える場合の縮小率
+const rekognitionDownscaleRate = 0.75
+
+// PrepareForRekognition はRekognitionにバイト列で渡せるように画像を変換する
+// 以下の場合はJPEGに再エンコードし、必要に応じて縮小する
+//   - MaxRekognitionImageBytes を超えている
+//   - 幅、高さのどちらかが MaxRekognitionImageDimension を超えている
+//   - RekognitionがサポートしていないWebP等の形式
+//
+// 変換が不要な場合は渡された画像をそのまま返す
+// BoundingBox等は画像全体に対する比率で返されるので、縮小しても元の画像の座標にそのまま適用出来る
+func PrepareForRekognition(b []byte) ([]byte, error) {
+	if !needsPreparation(b) {
+		return b, nil
+	}
+
+	img, _, err := Decode(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Decode")
+	}
+
+	img = Resize(img, MaxRekognitionImageDimension)
+
+	for {
+		for _, quality := range rekognitionJpegQualities {
+			encoded, err := encodeJpegOnWhite(img, quality)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(encoded) <= MaxRekognitionImageBytes {
+				return encoded, nil
+			}
+		}
+
+		bounds := img.Bounds()
+		maxDimension := int(float64(maxInt(bounds.Dx(), bounds.Dy())) * rekognitionDownscaleRate)
+
+		if maxDimension < 1 {
+			return nil, errors.New("failed to reduce image size")
+		}
+
+		img = Resize(img, maxDimension)
+	}
+}
+
+// Resize は幅、高さのどちらも maxDimension 以下になるようにアスペクト比を保ったまま縮小する
+// 既に maxDimension 以下の場合はそのまま返す
+func Resize(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	if w <= maxDimension && h <= maxDimension {
+		return img
+	}
+
+	scale := float64(maxDimension) / float64(maxInt(w, h))
+	dstW := maxInt(1, int(float64(w)*scale))
+	dstH := maxInt(1, int(float64(h)*scale))
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+	return dst
+}
+
+func needsPreparation(b []byte) bool {
+	if len(b) > MaxRekognitionImageBytes {
+		return true
+	}
+
+	format := imageformat.Detect(b)
+	if format != imageformat.Jpeg && format != imageformat.Png {
+		// WebP等はRekognitionがサポートしていないので変換する、画像形式が判定出来ない場合はRekognitionのエラーに任せる
+		return format != imageformat.Unknown
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return false
+	}
+
+	return config.Width > MaxRekognitionImageDimension || config.Height > MaxRekognitionImageDimension
+}
+
+// encodeJpegOnWhite は透過部分を白で塗りつぶしてJPEGにエンコードする
+// JPEGは透過を扱えないので、そのままエンコードすると透過部分が黒になってしまう
+func encodeJpegOnWhite(img image.Image, quality int) ([]byte, error) {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, errors.Wrap(err, "failed to jpeg.Encode")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,99 @@
+package imageprocessing
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/keitakn/aws-rekognition-sandbox/imageformat"
+)
+
+func encodePng(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal("Error failed to png.Encode", err)
+	}
+
+	return buf.Bytes()
+}
+
+//nolint:funlen
+func TestPrepareForRekognition(t *testing.T) {
+	t.Run("Successful the image within the limits is returned as it is", func(t *testing.T) {
+		b, err := os.ReadFile("../test/images/moko-cat.jpg")
+		if err != nil {
+			t.Fatal("Error failed to os.ReadFile", err)
+		}
+
+		actual, err := PrepareForRekognition(b)
+		if err != nil {
+			t.Fatal("Error failed to PrepareForRekognition", err)
+		}
+
+		if !bytes.Equal(actual, b) {
+			t.Error("\nActually: ", len(actual), "bytes", "\nExpected: ", len(b), "bytes")
+		}
+	})
+
+	t.Run("Successful downscale the image that exceeds the maximum dimension", func(t *testing.T) {
+		const width = 6000
+		const height = 300
+
+		b := encodePng(t, image.NewGray(image.Rect(0, 0, width, height)))
+
+		actual, err := PrepareForRekognition(b)
+		if err != nil {
+			t.Fatal("Error failed to PrepareForRekognition", err)
+		}
+
+		if imageformat.Detect(actual) != imageformat.Jpeg {
+			t.Error("\nActually: ", imageformat.Detect(actual), "\nExpected: ", imageformat.Jpeg)
+		}
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(actual))
+		if err != nil {
+			t.Fatal("Error failed to image.DecodeConfig", err)
+		}
+
+		// アスペクト比を保ったまま縮小される
+		if config.Width != MaxRekognitionImageDimension || config.Height != height*MaxRekognitionImageDimension/width {
+			t.Error("\nActually: ", config.Width, "x", config.Height)
+		}
+	})
+
+	t.Run("Successful reduce the image that exceeds the maximum bytes", func(t *testing.T) {
+		const size = 1500
+
+		// ノイズの画像はほとんど圧縮されないので、PNGでは上限を超える
+		img := image.NewNRGBA(image.Rect(0, 0, size, size))
+		random := rand.New(rand.NewSource(1)) //nolint:gosec
+		random.Read(img.Pix)
+
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 0xFF
+		}
+
+		b := encodePng(t, img)
+		if len(b) <= MaxRekognitionImageBytes {
+			t.Fatal("Error the test image must exceed the maximum bytes", len(b))
+		}
+
+		actual, err := PrepareForRekognition(b)
+		if err != nil {
+			t.Fatal("Error failed to PrepareForRekognition", err)
+		}
+
+		if len(actual) > MaxRekognitionImageBytes {
+			t.Error("\nActually: ", len(actual), "\nExpected: <= ", MaxRekognitionImageBytes)
+		}
+
+		if imageformat.Detect(actual) != imageformat.Jpeg {
+			t.Error("\nActually: ", imageformat.Detect(actual), "\nExpected: ", imageformat.Jpeg)
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package imagerequest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/keitakn/aws-rekognition-sandbox/imageformat"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ImageFieldName はmultipart/form-dataで画像ファイルを送る際のフィールド名
+	ImageFieldName = "image"
+	// ImageExtensionFieldName はmultipart/form-dataで拡張子を明示する際のフィールド名、省略した場合はファイル名から判定する
+	ImageExtensionFieldName = "imageExtension"
+)
+
+var (
+	ErrInvalidBody   = errors.New("invalid request body")
+	ErrImageNotFound = errors.New("image is not found in the request body")
+	// ErrUnsupportedContentType は画像そのものが送られた際のContent-Typeが image/jpeg, image/png, image/webp 以外の場合のエラー
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+)
+
+// Body は画像を受け付けるAPIのリクエストボディ
+// JSON, multipart/form-data, 画像そのもの のどの形式で送られた場合もこの形に変換する
+type Body struct {
+	// Image はBase64エンコードされた画像
+	Image          string `json:"image"`
+	ImageExtension string `json:"imageExtension"`
+}
+
+// Decode はContent-Typeに応じてリクエストボディをデコードする
+//   - multipart/form-data の場合は image フィールドの画像ファイル
+//   - image/jpeg, image/png, image/webp, application/octet-stream の場合はリクエストボディそのものを画像として扱う
+//   - それ以外の image/* の場合は ErrUnsupportedContentType を返す
+//   - それ以外の場合は従来通りJSONとして扱う
+func Decode(contentType string, body []byte) (*Body, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		switch {
+		case mediaType == "multipart/form-data":
+			return decodeMultipart(body, params["boundary"])
+		case strings.HasPrefix(mediaType, "image/"), mediaType == "application/octet-stream":
+			return decodeRaw(mediaType, body)
+		}
+	}
+
+	var reqBody Body
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		return nil, errors.Wrap(ErrInvalidBody, err.Error())
+	}
+
+	return &reqBody, nil
+}
+
+// DecodeAPIGatewayV2Request はAPI Gateway（HTTP API）のリクエストボディをデコードする
+// multipart/form-data, image/jpeg 等のバイナリはBase64エンコードされた状態で渡されるので、デコードしてから扱う
+func DecodeAPIGatewayV2Request(req events.APIGatewayV2HTTPRequest) (*Body, error) {
+	body := []byte(req.Body)
+
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidBody, err.Error())
+		}
+
+		body = decoded
+	}
+
+	return Decode(headerValue(req.Headers, "Content-Type"), body)
+}
+
+func decodeMultipart(body []byte, boundary string) (*Body, error) {
+	if boundary == "" {
+		return nil, errors.Wrap(ErrInvalidBody, "boundary is empty")
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+
+	var (
+		img            []byte
+		fileExtension  string
+		imageExtension string
+	)
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidBody, err.Error())
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidBody, err.Error())
+		}
+
+		switch part.FormName() {
+		case ImageFieldName:
+			img = value
+			fileExtension = extensionFromPart(part)
+		case ImageExtensionFieldName:
+			imageExtension = string(value)
+		}
+	}
+
+	if len(img) == 0 {
+		return nil, errors.Wrap(ErrImageNotFound, "multipart field "+ImageFieldName+" is empty")
+	}
+
+	if imageExtension == "" {
+		imageExtension = fileExtension
+	}
+
+	return &Body{
+		Image:          base64.StdEncoding.EncodeToString(img),
+		ImageExtension: imageExtension,
+	}, nil
+}
+
+// decodeRaw は curl --data-binary 等で送られた画像そのもののリクエストボディをデコードする
+// 拡張子はContent-Typeから判定する、application/octet-stream 等で判定出来ない場合は空になる
+func decodeRaw(mediaType string, body []byte) (*Body, error) {
+	format := imageformat.FromContentType(mediaType)
+	if mediaType != "application/octet-stream" && !isRawImageFormat(format) {
+		return nil, errors.Wrap(ErrUnsupportedContentType, "content type is "+mediaType)
+	}
+
+	if len(body) == 0 {
+		return nil, errors.Wrap(ErrImageNotFound, "request body is empty")
+	}
+
+	return &Body{
+		Image:          base64.StdEncoding.EncodeToString(body),
+		ImageExtension: format.Extension(),
+	}, nil
+}
+
+// isRawImageFormat は画像そのものを送る場合に受け付ける画像形式かどうか
+func isRawImageFormat(format imageformat.Format) bool {
+	switch format {
+	case imageformat.Jpeg, imageformat.Png, imageformat.Webp:
+		return true
+	default:
+		return false
+	}
+}
+
+// extensionFromPart はファイル名の拡張子、無い場合はパートのContent-Typeから拡張子を決定する
+func extensionFromPart(part *multipart.Part) string {
+	if ext := filepath.Ext(part.FileName()); ext != "" {
+		return ext
+	}
+
+	return imageformat.FromContentType(part.Header.Get("Content-Type")).Extension()
+}
+
+// headerValue はヘッダーの値を取得する
+// API Gateway（HTTP API）はヘッダー名を小文字にして渡すので大文字小文字を区別せずに探す
+func headerValue(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+
+	return ""
+}
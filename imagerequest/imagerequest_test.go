@@ -0,0 +1,162 @@
+package imagerequest
+
+import (
+	"encoding/base64"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/keitakn/aws-rekognition-sandbox/test"
+	"github.com/pkg/errors"
+)
+
+//nolint:funlen
+func TestDecode(t *testing.T) {
+	img, err := os.ReadFile("../test/images/moko-cat.jpg")
+	if err != nil {
+		t.Fatal("Error failed to os.ReadFile", err)
+	}
+
+	base64Img := base64.StdEncoding.EncodeToString(img)
+
+	t.Run("Successful decode the json body", func(t *testing.T) {
+		body := []byte(`{"image": "` + base64Img + `", "imageExtension": ".jpg"}`)
+
+		actual, err := Decode("application/json", body)
+		if err != nil {
+			t.Fatal("Error failed to Decode", err)
+		}
+
+		expected := &Body{Image: base64Img, ImageExtension: ".jpg"}
+		if reflect.DeepEqual(actual, expected) == false {
+			t.Error("\nActually: ", actual, "\nExpected: ", expected)
+		}
+	})
+
+	multipartTests := []struct {
+		name              string
+		fileName          string
+		partContentType   string
+		expectedExtension string
+	}{
+		{
+			name:              "extension from the file name",
+			fileName:          "moko-cat.JPEG",
+			partContentType:   "image/jpeg",
+			expectedExtension: ".JPEG",
+		},
+		{
+			name:              "extension from the content type",
+			fileName:          "blob",
+			partContentType:   "image/jpeg",
+			expectedExtension: ".jpg",
+		},
+	}
+
+	for _, tt := range multipartTests {
+		tt := tt
+		t.Run("Successful decode the multipart body "+tt.name, func(t *testing.T) {
+			body, contentType, err := test.CreateMultipartBody(ImageFieldName, tt.fileName, tt.partContentType, img)
+			if err != nil {
+				t.Fatal("Error failed to test.CreateMultipartBody", err)
+			}
+
+			actual, err := Decode(contentType, body)
+			if err != nil {
+				t.Fatal("Error failed to Decode", err)
+			}
+
+			expected := &Body{Image: base64Img, ImageExtension: tt.expectedExtension}
+			if reflect.DeepEqual(actual, expected) == false {
+				t.Error("\nActually: ", actual.ImageExtension, "\nExpected: ", expected.ImageExtension)
+			}
+		})
+	}
+
+	t.Run("Successful decode the base64 encoded multipart body from API Gateway", func(t *testing.T) {
+		body, contentType, err := test.CreateMultipartBody(ImageFieldName, "moko-cat.jpg", "image/jpeg", img)
+		if err != nil {
+			t.Fatal("Error failed to test.CreateMultipartBody", err)
+		}
+
+		req := events.APIGatewayV2HTTPRequest{
+			Headers:         map[string]string{"content-type": contentType},
+			Body:            base64.StdEncoding.EncodeToString(body),
+			IsBase64Encoded: true,
+		}
+
+		actual, err := DecodeAPIGatewayV2Request(req)
+		if err != nil {
+			t.Fatal("Error failed to DecodeAPIGatewayV2Request", err)
+		}
+
+		expected := &Body{Image: base64Img, ImageExtension: ".jpg"}
+		if reflect.DeepEqual(actual, expected) == false {
+			t.Error("\nActually: ", actual.ImageExtension, "\nExpected: ", expected.ImageExtension)
+		}
+	})
+
+	rawTests := []struct {
+		contentType       string
+		expectedExtension string
+	}{
+		{contentType: "image/jpeg", expectedExtension: ".jpg"},
+		{contentType: "image/png", expectedExtension: ".png"},
+		{contentType: "image/webp", expectedExtension: ".webp"},
+		{contentType: "application/octet-stream", expectedExtension: ""},
+	}
+
+	for _, tt := range rawTests {
+		tt := tt
+		t.Run("Successful decode the raw binary body "+tt.contentType, func(t *testing.T) {
+			actual, err := Decode(tt.contentType, img)
+			if err != nil {
+				t.Fatal("Error failed to Decode", err)
+			}
+
+			expected := &Body{Image: base64Img, ImageExtension: tt.expectedExtension}
+			if reflect.DeepEqual(actual, expected) == false {
+				t.Error("\nActually: ", actual.ImageExtension, "\nExpected: ", expected.ImageExtension)
+			}
+		})
+	}
+
+	t.Run("Failure the raw binary body is empty", func(t *testing.T) {
+		_, err := Decode("image/jpeg", []byte{})
+		if !errors.Is(err, ErrImageNotFound) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrImageNotFound)
+		}
+	})
+
+	unsupportedContentTypes := []string{"image/gif", "image/heic", "image/svg+xml"}
+
+	for _, contentType := range unsupportedContentTypes {
+		contentType := contentType
+		t.Run("Failure the raw binary body is "+contentType, func(t *testing.T) {
+			_, err := Decode(contentType, img)
+			if !errors.Is(err, ErrUnsupportedContentType) {
+				t.Error("\nActually: ", err, "\nExpected: ", ErrUnsupportedContentType)
+			}
+		})
+	}
+
+	t.Run("Failure the multipart body does not contain the image field", func(t *testing.T) {
+		body, contentType, err := test.CreateMultipartBody("file", "moko-cat.jpg", "image/jpeg", img)
+		if err != nil {
+			t.Fatal("Error failed to test.CreateMultipartBody", err)
+		}
+
+		_, err = Decode(contentType, body)
+		if !errors.Is(err, ErrImageNotFound) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrImageNotFound)
+		}
+	})
+
+	t.Run("Failure the json body is invalid", func(t *testing.T) {
+		_, err := Decode("application/json", []byte("invalid"))
+		if !errors.Is(err, ErrInvalidBody) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrInvalidBody)
+		}
+	})
+}
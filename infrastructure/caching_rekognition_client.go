@@ -0,0 +1,237 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/pkg/errors"
+)
+
+const DefaultRekognitionCacheTTL = 24 * time.Hour
+
+// CachingRekognitionClient は同じ画像に対する DetectLabels の結果を RekognitionCacheStore に保存して再利用する RekognitionClient のデコレーター
+// 同じ写真が何度もアップロードされても、2回目以降はRekognitionの料金が掛からない
+// キャッシュの読み書きに失敗した場合はログを出してRekognitionを呼び出す（キャッシュが原因で判定出来なくならないようにする為）
+type CachingRekognitionClient struct {
+	Client RekognitionClient
+	Store  RekognitionCacheStore
+	// S3Client が設定されている場合、S3オブジェクトの画像はETagをキーにするので、同じ内容の画像であれば別のKeyでもキャッシュが使われる
+	// 設定されていない場合はバージョンIDが指定されたS3オブジェクトのみキャッシュする
+	S3Client S3Client
+	// TTL が設定されていない場合は DefaultRekognitionCacheTTL を利用する
+	TTL time.Duration
+	// Now はテストで時刻を固定する為に利用する、設定されていない場合は time.Now を利用する
+	Now func() time.Time
+	// Logger が設定されていない場合はキャッシュの読み書きに失敗してもログを出力しない
+	Logger *logging.Logger
+	// Metrics が設定されている場合は、キャッシュが使われた回数を RekognitionCacheHits、使われなかった回数を RekognitionCacheMisses として出力する
+	Metrics *metrics.Recorder
+	hits    int64
+	misses  int64
+}
+
+// RekognitionCacheStats はキャッシュが使われた回数と使われなかった回数、キャッシュ出来ない画像は含まない
+type RekognitionCacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+type rekognitionCacheEntry struct {
+	ExpiresAt    time.Time                       `json:"expiresAt"`
+	DetectLabels *rekognition.DetectLabelsOutput `json:"detectLabels"`
+}
+
+func (c *CachingRekognitionClient) Stats() RekognitionCacheStats {
+	return RekognitionCacheStats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+	}
+}
+
+func (c *CachingRekognitionClient) DetectLabels(
+	ctx context.Context,
+	params *rekognition.DetectLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectLabelsOutput, error) {
+	key, err := c.detectLabelsCacheKey(ctx, params)
+	if err != nil {
+		c.Logger.Error(ctx, "failed to create the cache key", err)
+	}
+
+	if key == "" {
+		return c.Client.DetectLabels(ctx, params, optFns...)
+	}
+
+	if output := c.get(ctx, key); output != nil {
+		atomic.AddInt64(&c.hits, 1)
+		c.Metrics.Count("RekognitionCacheHits", metrics.Dimensions{"Operation": "DetectLabels"})
+
+		return output, nil
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+	c.Metrics.Count("RekognitionCacheMisses", metrics.Dimensions{"Operation": "DetectLabels"})
+
+	output, err := c.Client.DetectLabels(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.set(ctx, key, output)
+
+	return output, nil
+}
+
+func (c *CachingRekognitionClient) DetectFaces(
+	ctx context.Context,
+	params *rekognition.DetectFacesInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectFacesOutput, error) {
+	return c.Client.DetectFaces(ctx, params, optFns...)
+}
+
+func (c *CachingRekognitionClient) DetectModerationLabels(
+	ctx context.Context,
+	params *rekognition.DetectModerationLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectModerationLabelsOutput, error) {
+	return c.Client.DetectModerationLabels(ctx, params, optFns...)
+}
+
+// detectLabelsCacheKey は画像の内容とリクエストのパラメータのSHA-256を返す
+// キャッシュ出来ない画像の場合は空文字を返す
+func (c *CachingRekognitionClient) detectLabelsCacheKey(
+	ctx context.Context,
+	params *rekognition.DetectLabelsInput,
+) (string, error) {
+	if params == nil || params.Image == nil {
+		return "", nil
+	}
+
+	imageKey, err := c.imageCacheKey(ctx, params)
+	if err != nil || imageKey == "" {
+		return "", err
+	}
+
+	// MaxLabels, MinConfidence が異なるとレスポンスに含まれるラベルが変わるのでキーに含める
+	maxLabels := ""
+	if params.MaxLabels != nil {
+		maxLabels = strconv.FormatInt(int64(*params.MaxLabels), 10)
+	}
+
+	minConfidence := ""
+	if params.MinConfidence != nil {
+		minConfidence = strconv.FormatFloat(float64(*params.MinConfidence), 'f', -1, 32)
+	}
+
+	sum := sha256.Sum256([]byte("DetectLabels\n" + imageKey + "\n" + maxLabels + "\n" + minConfidence))
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (c *CachingRekognitionClient) imageCacheKey(
+	ctx context.Context,
+	params *rekognition.DetectLabelsInput,
+) (string, error) {
+	if params.Image.Bytes != nil {
+		return "sha256:" + sha256HexString(params.Image.Bytes), nil
+	}
+
+	s3Object := params.Image.S3Object
+	if s3Object == nil || s3Object.Bucket == nil || s3Object.Name == nil {
+		return "", nil
+	}
+
+	if c.S3Client != nil {
+		input := &s3.HeadObjectInput{
+			Bucket: s3Object.Bucket,
+			Key:    s3Object.Name,
+		}
+
+		if aws.ToString(s3Object.Version) != "" {
+			input.VersionId = s3Object.Version
+		}
+
+		output, err := c.S3Client.HeadObject(ctx, input)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to S3Client.HeadObject")
+		}
+
+		if aws.ToString(output.ETag) != "" {
+			return "etag:" + aws.ToString(output.ETag), nil
+		}
+	}
+
+	// バージョンIDが無い場合は同じKeyで別の画像に上書きされる可能性があるのでキャッシュしない
+	if aws.ToString(s3Object.Version) == "" {
+		return "", nil
+	}
+
+	return "s3:" + *s3Object.Bucket + "/" + *s3Object.Name + "?versionId=" + *s3Object.Version, nil
+}
+
+func (c *CachingRekognitionClient) get(ctx context.Context, key string) *rekognition.DetectLabelsOutput {
+	value, err := c.Store.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrRekognitionCacheMiss) {
+			c.Logger.Error(ctx, "failed to get the cache", err)
+		}
+
+		return nil
+	}
+
+	var entry rekognitionCacheEntry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		c.Logger.Error(ctx, "failed to json.Unmarshal", err)
+
+		return nil
+	}
+
+	if !c.now().Before(entry.ExpiresAt) {
+		return nil
+	}
+
+	return entry.DetectLabels
+}
+
+func (c *CachingRekognitionClient) set(ctx context.Context, key string, output *rekognition.DetectLabelsOutput) {
+	value, err := json.Marshal(&rekognitionCacheEntry{
+		ExpiresAt:    c.now().Add(c.ttl()),
+		DetectLabels: output,
+	})
+	if err != nil {
+		c.Logger.Error(ctx, "failed to json.Marshal", err)
+
+		return
+	}
+
+	if err := c.Store.Set(ctx, key, value); err != nil {
+		c.Logger.Error(ctx, "failed to set the cache", err)
+	}
+}
+
+func (c *CachingRekognitionClient) ttl() time.Duration {
+	if c.TTL <= 0 {
+		return DefaultRekognitionCacheTTL
+	}
+
+	return c.TTL
+}
+
+func (c *CachingRekognitionClient) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+
+	return c.Now()
+}
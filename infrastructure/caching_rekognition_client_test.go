@@ -0,0 +1,146 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+)
+
+// fakeS3Client は Key に関係なく同じETagを返す
+type fakeS3Client struct {
+	S3Client
+	etag string
+}
+
+func (c *fakeS3Client) HeadObject(
+	ctx context.Context,
+	params *s3.HeadObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ETag: aws.String(c.etag)}, nil
+}
+
+//nolint:funlen
+func TestCachingRekognitionClient(t *testing.T) {
+	now := time.Date(2022, 3, 19, 12, 0, 0, 0, time.UTC)
+
+	newClient := func() (*CachingRekognitionClient, *fakeRekognitionClient) {
+		fake := &fakeRekognitionClient{}
+
+		return &CachingRekognitionClient{
+			Client: fake,
+			Store:  NewMemoryRekognitionCacheStore(0),
+			Now:    func() time.Time { return now },
+		}, fake
+	}
+
+	newBytesInput := func(img []byte, minConfidence float32) *rekognition.DetectLabelsInput {
+		return &rekognition.DetectLabelsInput{
+			Image:         &types.Image{Bytes: img},
+			MaxLabels:     aws.Int32(10),
+			MinConfidence: aws.Float32(minConfidence),
+		}
+	}
+
+	newS3Input := func(key string, version string) *rekognition.DetectLabelsInput {
+		return &rekognition.DetectLabelsInput{
+			Image: &types.Image{
+				S3Object: &types.S3Object{
+					Bucket:  aws.String("trigger-bucket"),
+					Name:    aws.String(key),
+					Version: aws.String(version),
+				},
+			},
+		}
+	}
+
+	detectLabels := func(t *testing.T, client *CachingRekognitionClient, inputs ...*rekognition.DetectLabelsInput) {
+		t.Helper()
+
+		for _, input := range inputs {
+			if _, err := client.DetectLabels(context.Background(), input); err != nil {
+				t.Fatal("Error failed to DetectLabels", err)
+			}
+		}
+	}
+
+	t.Run("Successful reuse the result for the same image bytes and parameters", func(t *testing.T) {
+		client, fake := newClient()
+
+		img := []byte("same image")
+
+		detectLabels(t, client, newBytesInput(img, 80), newBytesInput([]byte("same image"), 80), newBytesInput(img, 90))
+
+		// MinConfidence が異なる場合は別のリクエストとして扱う
+		expected := RekognitionCacheStats{Hits: 1, Misses: 2}
+		if fake.calls != 2 || client.Stats() != expected {
+			t.Error("\nActually: ", fake.calls, client.Stats(), "\nExpected: ", 2, expected)
+		}
+	})
+
+	t.Run("Successful reuse the result for the s3 objects with the same etag", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		client, fake := newClient()
+		client.S3Client = &fakeS3Client{etag: `"d41d8cd98f00b204e9800998ecf8427e"`}
+		client.Metrics = metrics.New(&buf, "TestNamespace", nil)
+
+		detectLabels(t, client, newS3Input("tmp/cat-1.jpg", ""), newS3Input("tmp/cat-2.jpg", ""))
+
+		expected := RekognitionCacheStats{Hits: 1, Misses: 1}
+		if fake.calls != 1 || client.Stats() != expected {
+			t.Error("\nActually: ", fake.calls, client.Stats(), "\nExpected: ", 1, expected)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 ||
+			!strings.Contains(lines[0], `"RekognitionCacheMisses":1`) ||
+			!strings.Contains(lines[1], `"RekognitionCacheHits":1`) {
+			t.Error("\nActually: ", lines, "\nExpected: ", "RekognitionCacheMisses, RekognitionCacheHits")
+		}
+	})
+
+	t.Run("Successful do not cache the s3 object which may be overwritten", func(t *testing.T) {
+		client, fake := newClient()
+
+		detectLabels(t, client, newS3Input("tmp/cat.jpg", ""), newS3Input("tmp/cat.jpg", ""))
+
+		expected := RekognitionCacheStats{}
+		if fake.calls != 2 || client.Stats() != expected {
+			t.Error("\nActually: ", fake.calls, client.Stats(), "\nExpected: ", 2, expected)
+		}
+
+		// バージョンIDが指定されていれば同じ画像なのでキャッシュする
+		detectLabels(t, client, newS3Input("tmp/cat.jpg", "v1"), newS3Input("tmp/cat.jpg", "v1"))
+
+		if fake.calls != 3 {
+			t.Error("\nActually: ", fake.calls, "\nExpected: ", 3)
+		}
+	})
+
+	t.Run("Successful call Rekognition again after the ttl", func(t *testing.T) {
+		client, fake := newClient()
+		client.TTL = time.Hour
+
+		img := []byte("same image")
+
+		detectLabels(t, client, newBytesInput(img, 80))
+
+		now = now.Add(time.Hour)
+		defer func() { now = now.Add(-time.Hour) }()
+
+		detectLabels(t, client, newBytesInput(img, 80))
+
+		if fake.calls != 2 {
+			t.Error("\nActually: ", fake.calls, "\nExpected: ", 2)
+		}
+	})
+}
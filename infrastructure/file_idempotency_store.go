@@ -0,0 +1,142 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FileIdempotencyStore は1イベントにつき1つのJSONファイルとして記録する IdempotencyStore の実装
+// ローカルサーバーを再起動しても処理済みの記録を残したい場合に利用する
+// 読み込みから書き込みまでをプロセス内のロックで保護しているので、同じディレクトリを複数のプロセスで共有する事は出来ない
+type FileIdempotencyStore struct {
+	Dir string
+	// Retention が設定されていない場合は DefaultIdempotencyRetention を利用する
+	Retention time.Duration
+	// Now はテストで時刻を固定する為に利用する、設定されていない場合は time.Now を利用する
+	Now func() time.Time
+
+	mu sync.Mutex
+}
+
+func NewFileIdempotencyStore(dir string) (*FileIdempotencyStore, error) {
+	if err := os.MkdirAll(dir, imageRecordDirPerm); err != nil {
+		return nil, errors.Wrap(err, "failed to os.MkdirAll")
+	}
+
+	return &FileIdempotencyStore{Dir: dir}, nil
+}
+
+func (s *FileIdempotencyStore) Acquire(_ context.Context, key string, leaseDuration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recordPath, err := s.recordPath(key)
+	if err != nil {
+		return err
+	}
+
+	record, err := s.read(recordPath)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	if err := record.acquirable(now); err != nil {
+		return err
+	}
+
+	return s.write(recordPath, &idempotencyRecord{
+		Status:    idempotencyStatusInProgress,
+		ExpiresAt: now.Add(leaseDuration),
+	})
+}
+
+func (s *FileIdempotencyStore) Complete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recordPath, err := s.recordPath(key)
+	if err != nil {
+		return err
+	}
+
+	return s.write(recordPath, &idempotencyRecord{
+		Status:    idempotencyStatusCompleted,
+		ExpiresAt: s.now().Add(s.retention()),
+	})
+}
+
+func (s *FileIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recordPath, err := s.recordPath(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(recordPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err, "failed to os.Remove")
+	}
+
+	return nil
+}
+
+// read は記録が無い場合に nil を返す
+func (s *FileIdempotencyStore) read(recordPath string) (*idempotencyRecord, error) {
+	recordJson, err := os.ReadFile(recordPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to os.ReadFile")
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(recordJson, &record); err != nil {
+		return nil, errors.Wrap(err, "failed to json.Unmarshal")
+	}
+
+	return &record, nil
+}
+
+func (s *FileIdempotencyStore) write(recordPath string, record *idempotencyRecord) error {
+	recordJson, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to json.Marshal")
+	}
+
+	return writeFileAtomically(s.Dir, recordPath, recordJson, imageRecordFilePerm)
+}
+
+// recordPath は FileImageRecordRepository と同じく Dir の外を参照する事が無いようにファイル名だけを許可する
+func (s *FileIdempotencyStore) recordPath(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || key == "." || key == ".." {
+		return "", errors.New("invalid idempotency key: " + key)
+	}
+
+	return filepath.Join(s.Dir, key+".json"), nil
+}
+
+func (s *FileIdempotencyStore) retention() time.Duration {
+	if s.Retention <= 0 {
+		return DefaultIdempotencyRetention
+	}
+
+	return s.Retention
+}
+
+func (s *FileIdempotencyStore) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+
+	return s.Now()
+}
@@ -0,0 +1,104 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	imageRecordDirPerm  = 0o755
+	imageRecordFilePerm = 0o600
+)
+
+// FileImageRecordRepository は画像1枚につき1つのJSONファイルとして保存する ImageRecordRepository の実装
+// ローカルサーバーを再起動しても処理状況を残したい場合に利用する
+type FileImageRecordRepository struct {
+	Dir string
+}
+
+func NewFileImageRecordRepository(dir string) (*FileImageRecordRepository, error) {
+	if err := os.MkdirAll(dir, imageRecordDirPerm); err != nil {
+		return nil, errors.Wrap(err, "failed to os.MkdirAll")
+	}
+
+	return &FileImageRecordRepository{Dir: dir}, nil
+}
+
+func (r *FileImageRecordRepository) Save(_ context.Context, record *ImageRecord) error {
+	recordPath, err := r.recordPath(record.ImageId)
+	if err != nil {
+		return err
+	}
+
+	recordJson, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to json.Marshal")
+	}
+
+	return writeFileAtomically(r.Dir, recordPath, recordJson, imageRecordFilePerm)
+}
+
+func (r *FileImageRecordRepository) FindById(_ context.Context, imageId string) (*ImageRecord, error) {
+	recordPath, err := r.recordPath(imageId)
+	if err != nil {
+		return nil, err
+	}
+
+	recordJson, err := os.ReadFile(recordPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrImageRecordNotFound
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to os.ReadFile")
+	}
+
+	var record ImageRecord
+	if err := json.Unmarshal(recordJson, &record); err != nil {
+		return nil, errors.Wrap(err, "failed to json.Unmarshal")
+	}
+
+	return &record, nil
+}
+
+// recordPath はIDに "../" 等が含まれていて Dir の外を参照する事が無いようにファイル名だけを許可する
+func (r *FileImageRecordRepository) recordPath(imageId string) (string, error) {
+	if imageId == "" || imageId != filepath.Base(imageId) || imageId == "." || imageId == ".." {
+		return "", errors.New("invalid image id: " + imageId)
+	}
+
+	return filepath.Join(r.Dir, imageId+".json"), nil
+}
+
+// writeFileAtomically は書き込み途中のファイルを読まないように、一時ファイルに書き込んでからリネームする
+func writeFileAtomically(dir string, path string, data []byte, perm os.FileMode) error {
+	tmpFile, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to os.CreateTemp")
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+
+		return errors.Wrap(err, "failed to write file")
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return errors.Wrap(err, "failed to close file")
+	}
+
+	if err := os.Chmod(tmpFile.Name(), perm); err != nil {
+		return errors.Wrap(err, "failed to os.Chmod")
+	}
+
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return errors.Wrap(err, "failed to os.Rename")
+	}
+
+	return nil
+}
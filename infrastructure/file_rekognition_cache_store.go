@@ -0,0 +1,45 @@
+package infrastructure
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// FileRekognitionCacheStore はキー毎に1つのファイルとして保存する RekognitionCacheStore の実装
+// ローカルサーバーを再起動してもRekognitionの料金が掛からないようにしたい場合に利用する
+type FileRekognitionCacheStore struct {
+	Dir string
+}
+
+func NewFileRekognitionCacheStore(dir string) (*FileRekognitionCacheStore, error) {
+	if err := os.MkdirAll(dir, imageRecordDirPerm); err != nil {
+		return nil, errors.Wrap(err, "failed to os.MkdirAll")
+	}
+
+	return &FileRekognitionCacheStore{Dir: dir}, nil
+}
+
+func (s *FileRekognitionCacheStore) Get(_ context.Context, key string) ([]byte, error) {
+	value, err := os.ReadFile(s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrRekognitionCacheMiss
+		}
+
+		return nil, errors.Wrap(err, "failed to os.ReadFile")
+	}
+
+	return value, nil
+}
+
+func (s *FileRekognitionCacheStore) Set(_ context.Context, key string, value []byte) error {
+	return writeFileAtomically(s.Dir, s.path(key), value, imageRecordFilePerm)
+}
+
+// path のキーは CachingRekognitionClient が作成したSHA-256の16進数なので、パストラバーサルの心配は無い
+func (s *FileRekognitionCacheStore) path(key string) string {
+	return filepath.Join(s.Dir, key+".json")
+}
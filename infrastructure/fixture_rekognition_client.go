@@ -0,0 +1,240 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/pkg/errors"
+)
+
+// RekognitionFixture は画像1枚分のRekognitionのレスポンスを表す
+// 画像ファイルと同じディレクトリに "画像ファイル名.json" というサイドカーファイルとして配置する
+// .e.g. test/images/abyssinian-cat.jpg のフィクスチャは test/images/abyssinian-cat.jpg.json
+type RekognitionFixture struct {
+	// S3ObjectKeys にはこのフィクスチャを返すS3オブジェクトのKeyを指定する（省略可）
+	// 省略した場合でもS3オブジェクトのKeyのファイル名が画像ファイル名と一致すればこのフィクスチャが返される
+	// APIでアップロードした画像のKeyは "tmp/{画像ID}.jpg" になるので、ファイル名での一致は手動で配置したS3オブジェクトにしか使えない
+	S3ObjectKeys           []string                                  `json:"s3ObjectKeys,omitempty"`
+	DetectLabels           *rekognition.DetectLabelsOutput           `json:"detectLabels,omitempty"`
+	DetectFaces            *rekognition.DetectFacesOutput            `json:"detectFaces,omitempty"`
+	DetectModerationLabels *rekognition.DetectModerationLabelsOutput `json:"detectModerationLabels,omitempty"`
+}
+
+const rekognitionFixtureExt = ".json"
+
+var ErrRekognitionFixtureNotFound = errors.New("rekognition fixture not found")
+
+// FixtureRekognitionClient はAWSにアクセスせずにフィクスチャファイルの内容を返す RekognitionClient の実装
+// ローカルサーバーや結合テスト等、gomockで期待値を1つずつ定義するのが難しい場面で利用する
+type FixtureRekognitionClient struct {
+	// DefaultFixture が設定されている場合、フィクスチャが見つからない画像に対してはこれを返す
+	// 設定されていない場合は ErrRekognitionFixtureNotFound を返す
+	DefaultFixture *RekognitionFixture
+	byContentHash  map[string]*RekognitionFixture
+	byS3ObjectKey  map[string]*RekognitionFixture
+	byFileName     map[string]*RekognitionFixture
+}
+
+func LoadRekognitionFixture(fixturePath string) (*RekognitionFixture, error) {
+	fixtureJson, err := os.ReadFile(fixturePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to os.ReadFile")
+	}
+
+	var fixture RekognitionFixture
+	if err := json.Unmarshal(fixtureJson, &fixture); err != nil {
+		return nil, errors.Wrap(err, "failed to json.Unmarshal "+fixturePath)
+	}
+
+	return &fixture, nil
+}
+
+// NewFixtureRekognitionClient は fixtureDir 内のサイドカーファイルを全て読み込んで FixtureRekognitionClient を作成する
+// 画像はバイト列のSHA-256、S3オブジェクトはKeyで対応するフィクスチャを検索する
+func NewFixtureRekognitionClient(fixtureDir string) (*FixtureRekognitionClient, error) {
+	fixturePaths, err := filepath.Glob(filepath.Join(fixtureDir, "*"+rekognitionFixtureExt))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to filepath.Glob")
+	}
+
+	// 同じ内容の画像が複数ある場合でも結果が変わらないようにファイル名順で登録する
+	sort.Strings(fixturePaths)
+
+	c := &FixtureRekognitionClient{
+		byContentHash: map[string]*RekognitionFixture{},
+		byS3ObjectKey: map[string]*RekognitionFixture{},
+		byFileName:    map[string]*RekognitionFixture{},
+	}
+
+	for _, fixturePath := range fixturePaths {
+		fixture, err := LoadRekognitionFixture(fixturePath)
+		if err != nil {
+			return nil, err
+		}
+
+		imagePath := strings.TrimSuffix(fixturePath, rekognitionFixtureExt)
+
+		img, err := os.ReadFile(imagePath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the image for "+fixturePath)
+		}
+
+		contentHash := sha256HexString(img)
+		if _, ok := c.byContentHash[contentHash]; !ok {
+			c.byContentHash[contentHash] = fixture
+		}
+
+		c.byFileName[filepath.Base(imagePath)] = fixture
+
+		for _, key := range fixture.S3ObjectKeys {
+			c.byS3ObjectKey[key] = fixture
+		}
+	}
+
+	return c, nil
+}
+
+func (c *FixtureRekognitionClient) DetectLabels(
+	ctx context.Context,
+	params *rekognition.DetectLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectLabelsOutput, error) {
+	fixture, err := c.findFixture(params.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	if fixture.DetectLabels == nil {
+		return nil, errors.Wrap(ErrRekognitionFixtureNotFound, "detectLabels is not defined in the fixture")
+	}
+
+	// 本物のAPIと同じように MinConfidence 未満のラベルを除外し、MaxLabels 件までに絞り込む
+	labels := []types.Label{}
+	for _, label := range fixture.DetectLabels.Labels {
+		if params.MinConfidence != nil && label.Confidence != nil && *label.Confidence < *params.MinConfidence {
+			continue
+		}
+
+		if params.MaxLabels != nil && int32(len(labels)) >= *params.MaxLabels {
+			break
+		}
+
+		labels = append(labels, label)
+	}
+
+	return &rekognition.DetectLabelsOutput{
+		LabelModelVersion:     fixture.DetectLabels.LabelModelVersion,
+		Labels:                labels,
+		OrientationCorrection: fixture.DetectLabels.OrientationCorrection,
+		ResultMetadata:        fixture.DetectLabels.ResultMetadata,
+	}, nil
+}
+
+func (c *FixtureRekognitionClient) DetectFaces(
+	ctx context.Context,
+	params *rekognition.DetectFacesInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectFacesOutput, error) {
+	fixture, err := c.findFixture(params.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	if fixture.DetectFaces == nil {
+		return nil, errors.Wrap(ErrRekognitionFixtureNotFound, "detectFaces is not defined in the fixture")
+	}
+
+	output := *fixture.DetectFaces
+
+	return &output, nil
+}
+
+func (c *FixtureRekognitionClient) DetectModerationLabels(
+	ctx context.Context,
+	params *rekognition.DetectModerationLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectModerationLabelsOutput, error) {
+	fixture, err := c.findFixture(params.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	if fixture.DetectModerationLabels == nil {
+		return nil, errors.Wrap(ErrRekognitionFixtureNotFound, "detectModerationLabels is not defined in the fixture")
+	}
+
+	// MinConfidence を省略した場合、本物のAPIは50以上のラベルを返す
+	minConfidence := float32(50)
+	if params.MinConfidence != nil {
+		minConfidence = *params.MinConfidence
+	}
+
+	moderationLabels := []types.ModerationLabel{}
+	for _, label := range fixture.DetectModerationLabels.ModerationLabels {
+		if label.Confidence != nil && *label.Confidence < minConfidence {
+			continue
+		}
+
+		moderationLabels = append(moderationLabels, label)
+	}
+
+	return &rekognition.DetectModerationLabelsOutput{
+		ModerationLabels:       moderationLabels,
+		ModerationModelVersion: fixture.DetectModerationLabels.ModerationModelVersion,
+		ResultMetadata:         fixture.DetectModerationLabels.ResultMetadata,
+	}, nil
+}
+
+func (c *FixtureRekognitionClient) findFixture(image *types.Image) (*RekognitionFixture, error) {
+	if image == nil {
+		return nil, errors.New("image is required")
+	}
+
+	if image.Bytes != nil {
+		if fixture, ok := c.byContentHash[sha256HexString(image.Bytes)]; ok {
+			return fixture, nil
+		}
+
+		return c.defaultFixture("no fixture matches the image bytes")
+	}
+
+	if image.S3Object != nil && image.S3Object.Name != nil {
+		key := *image.S3Object.Name
+
+		if fixture, ok := c.byS3ObjectKey[key]; ok {
+			return fixture, nil
+		}
+
+		// "aws s3 cp test/images/abyssinian-cat.jpg s3://bucket/tmp/" のように手動で配置した画像の為のフォールバック
+		if fixture, ok := c.byFileName[path.Base(key)]; ok {
+			return fixture, nil
+		}
+
+		return c.defaultFixture("no fixture matches the s3 object key " + key)
+	}
+
+	return nil, errors.New("either image bytes or s3 object is required")
+}
+
+func (c *FixtureRekognitionClient) defaultFixture(message string) (*RekognitionFixture, error) {
+	if c.DefaultFixture == nil {
+		return nil, errors.Wrap(ErrRekognitionFixtureNotFound, message)
+	}
+
+	return c.DefaultFixture, nil
+}
+
+func sha256HexString(b []byte) string {
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,148 @@
+package infrastructure
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/pkg/errors"
+)
+
+const fixtureDir = "../test/images"
+
+//nolint:funlen
+func TestFixtureRekognitionClient(t *testing.T) {
+	client, err := NewFixtureRekognitionClient(fixtureDir)
+	if err != nil {
+		t.Fatal("Error failed to NewFixtureRekognitionClient", err)
+	}
+
+	ctx := context.Background()
+
+	t.Run("Successful fetch the labels by image bytes", func(t *testing.T) {
+		img, err := os.ReadFile(fixtureDir + "/abyssinian-cat.jpg")
+		if err != nil {
+			t.Fatal("Error failed to os.ReadFile", err)
+		}
+
+		output, err := client.DetectLabels(ctx, &rekognition.DetectLabelsInput{
+			Image: &types.Image{Bytes: img},
+		})
+		if err != nil {
+			t.Fatal("Error failed to DetectLabels", err)
+		}
+
+		expected := "Abyssinian"
+		actual := *output.Labels[len(output.Labels)-1].Name
+		if actual != expected {
+			t.Error("\nActually: ", actual, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful the labels are filtered by MinConfidence and MaxLabels", func(t *testing.T) {
+		img, err := os.ReadFile(fixtureDir + "/moko-cat.jpg")
+		if err != nil {
+			t.Fatal("Error failed to os.ReadFile", err)
+		}
+
+		const maxLabels = int32(5)
+		const minConfidence = float32(85)
+
+		output, err := client.DetectLabels(ctx, &rekognition.DetectLabelsInput{
+			Image:         &types.Image{Bytes: img},
+			MaxLabels:     aws.Int32(maxLabels),
+			MinConfidence: aws.Float32(minConfidence),
+		})
+		if err != nil {
+			t.Fatal("Error failed to DetectLabels", err)
+		}
+
+		if int32(len(output.Labels)) != maxLabels {
+			t.Error("\nActually: ", len(output.Labels), "\nExpected: ", maxLabels)
+		}
+
+		for _, label := range output.Labels {
+			if *label.Confidence < minConfidence {
+				t.Error("\nLabel below MinConfidence: ", *label.Name, *label.Confidence)
+			}
+		}
+	})
+
+	t.Run("Successful fetch the labels by s3 object key", func(t *testing.T) {
+		output, err := client.DetectLabels(ctx, &rekognition.DetectLabelsInput{
+			Image: &types.Image{S3Object: &types.S3Object{
+				Bucket: aws.String("trigger-bucket"),
+				Name:   aws.String("tmp/dog.jpg"),
+			}},
+		})
+		if err != nil {
+			t.Fatal("Error failed to DetectLabels", err)
+		}
+
+		expected := "Dog"
+		actual := *output.Labels[0].Name
+		if actual != expected {
+			t.Error("\nActually: ", actual, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful fetch the faces by image bytes", func(t *testing.T) {
+		img, err := os.ReadFile(fixtureDir + "/cat-and-lady.jpg")
+		if err != nil {
+			t.Fatal("Error failed to os.ReadFile", err)
+		}
+
+		output, err := client.DetectFaces(ctx, &rekognition.DetectFacesInput{
+			Image: &types.Image{Bytes: img},
+		})
+		if err != nil {
+			t.Fatal("Error failed to DetectFaces", err)
+		}
+
+		expected := 2
+		if len(output.FaceDetails) != expected {
+			t.Error("\nActually: ", len(output.FaceDetails), "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Failure unknown image", func(t *testing.T) {
+		_, err := client.DetectLabels(ctx, &rekognition.DetectLabelsInput{
+			Image: &types.Image{Bytes: []byte("unknown image")},
+		})
+
+		expected := ErrRekognitionFixtureNotFound
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful unknown image returns the default fixture", func(t *testing.T) {
+		defaultFixture, err := LoadRekognitionFixture(fixtureDir + "/dog.jpg.json")
+		if err != nil {
+			t.Fatal("Error failed to LoadRekognitionFixture", err)
+		}
+
+		clientWithDefault, err := NewFixtureRekognitionClient(fixtureDir)
+		if err != nil {
+			t.Fatal("Error failed to NewFixtureRekognitionClient", err)
+		}
+
+		clientWithDefault.DefaultFixture = defaultFixture
+
+		output, err := clientWithDefault.DetectLabels(ctx, &rekognition.DetectLabelsInput{
+			Image: &types.Image{S3Object: &types.S3Object{Name: aws.String("tmp/unknown.jpg")}},
+		})
+		if err != nil {
+			t.Fatal("Error failed to DetectLabels", err)
+		}
+
+		expected := "Dog"
+		actual := *output.Labels[0].Name
+		if actual != expected {
+			t.Error("\nActually: ", actual, "\nExpected: ", expected)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultIdempotencyLeaseDuration は処理中のままプロセスが停止した場合に、他のプロセスが処理を引き継げるようになるまでの時間
+	// Lambdaではタイムアウトまでの残り時間からリースを決めるので、タイムアウトが無い場合にだけ利用する
+	DefaultIdempotencyLeaseDuration = time.Minute
+	// DefaultIdempotencyRetention は処理済みとして記録しておく期間
+	// S3イベントの重複配信は通常数分以内に発生するので、それより十分に長い期間にしている
+	DefaultIdempotencyRetention = 24 * time.Hour
+)
+
+type idempotencyStatus string
+
+const (
+	idempotencyStatusInProgress idempotencyStatus = "in-progress"
+	idempotencyStatusCompleted  idempotencyStatus = "completed"
+)
+
+var (
+	ErrAlreadyProcessed     = errors.New("already processed")
+	ErrProcessingInProgress = errors.New("processing in progress")
+)
+
+// IdempotencyStore は同じS3イベントを2回以上処理しない為の記録
+type IdempotencyStore interface {
+	// Acquire は処理を開始して良い場合に leaseDuration の間だけ処理中として記録する
+	// 処理済みの場合は ErrAlreadyProcessed、他で処理中の場合は ErrProcessingInProgress を返す
+	Acquire(ctx context.Context, key string, leaseDuration time.Duration) error
+	// Complete は処理済みとして記録する、以降の Acquire は ErrAlreadyProcessed になる
+	Complete(ctx context.Context, key string) error
+	// Release は処理に失敗した場合に記録を削除して、再実行された際に処理出来るようにする
+	Release(ctx context.Context, key string) error
+}
+
+// idempotencyRecord は IdempotencyStore の実装で共通して利用する記録の形式
+type idempotencyRecord struct {
+	Status    idempotencyStatus `json:"status"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// acquirable は記録が無い、もしくは期限切れの場合に処理を開始出来る事を表す
+func (r *idempotencyRecord) acquirable(now time.Time) error {
+	if r == nil || !now.Before(r.ExpiresAt) {
+		return nil
+	}
+
+	if r.Status == idempotencyStatusCompleted {
+		return ErrAlreadyProcessed
+	}
+
+	return ErrProcessingInProgress
+}
+
+// S3EventIdempotencyKey はS3イベントのレコードを一意に識別するKeyを返す
+// 同じKeyに再度アップロードされた場合は sequencer が変わるので別のイベントとして扱われる
+// ファイル名としても利用出来るようにSHA-256の16進数にしている
+func S3EventIdempotencyKey(bucketName string, key string, versionId string, sequencer string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{bucketName, key, versionId, sequencer}, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
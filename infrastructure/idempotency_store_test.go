@@ -0,0 +1,121 @@
+package infrastructure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//nolint:funlen
+func TestIdempotencyStore(t *testing.T) {
+	const leaseDuration = time.Minute
+
+	now := time.Date(2022, 3, 19, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	newStores := func(t *testing.T) []struct {
+		name  string
+		store IdempotencyStore
+	} {
+		t.Helper()
+
+		memoryStore := NewMemoryIdempotencyStore()
+		memoryStore.Now = clock
+
+		fileStore, err := NewFileIdempotencyStore(t.TempDir())
+		if err != nil {
+			t.Fatal("Error failed to NewFileIdempotencyStore", err)
+		}
+
+		fileStore.Now = clock
+
+		s3Store := &S3IdempotencyStore{S3Client: &fakeConditionalS3Client{}, BucketName: "trigger-bucket", Now: clock}
+
+		return []struct {
+			name  string
+			store IdempotencyStore
+		}{
+			{name: "memory", store: memoryStore},
+			{name: "file", store: fileStore},
+			{name: "s3", store: s3Store},
+		}
+	}
+
+	key := S3EventIdempotencyKey("trigger-bucket", "tmp/sample-cat-image.jpg", "", "0055AED6DCD90281E5")
+
+	for _, tt := range newStores(t) {
+		tt := tt
+		t.Run("Successful skip the completed event with "+tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if err := tt.store.Acquire(ctx, key, leaseDuration); err != nil {
+				t.Fatal("Error failed to Acquire", err)
+			}
+
+			if err := tt.store.Acquire(ctx, key, leaseDuration); !errors.Is(err, ErrProcessingInProgress) {
+				t.Error("\nActually: ", err, "\nExpected: ", ErrProcessingInProgress)
+			}
+
+			if err := tt.store.Complete(ctx, key); err != nil {
+				t.Fatal("Error failed to Complete", err)
+			}
+
+			if err := tt.store.Acquire(ctx, key, leaseDuration); !errors.Is(err, ErrAlreadyProcessed) {
+				t.Error("\nActually: ", err, "\nExpected: ", ErrAlreadyProcessed)
+			}
+		})
+	}
+
+	for _, tt := range newStores(t) {
+		tt := tt
+		t.Run("Successful acquire again after release with "+tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if err := tt.store.Acquire(ctx, key, leaseDuration); err != nil {
+				t.Fatal("Error failed to Acquire", err)
+			}
+
+			if err := tt.store.Release(ctx, key); err != nil {
+				t.Fatal("Error failed to Release", err)
+			}
+
+			if err := tt.store.Acquire(ctx, key, leaseDuration); err != nil {
+				t.Error("\nActually: ", err, "\nExpected: ", nil)
+			}
+		})
+	}
+
+	for _, tt := range newStores(t) {
+		tt := tt
+		t.Run("Successful take over the expired lease with "+tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if err := tt.store.Acquire(ctx, key, leaseDuration); err != nil {
+				t.Fatal("Error failed to Acquire", err)
+			}
+
+			// 処理中のままプロセスが停止した場合を想定して、リースの期限が切れるまで時刻を進める
+			now = now.Add(leaseDuration)
+			defer func() { now = now.Add(-leaseDuration) }()
+
+			if err := tt.store.Acquire(ctx, key, leaseDuration); err != nil {
+				t.Error("\nActually: ", err, "\nExpected: ", nil)
+			}
+		})
+	}
+}
+
+func TestS3EventIdempotencyKey(t *testing.T) {
+	key := S3EventIdempotencyKey("trigger-bucket", "tmp/sample-cat-image.jpg", "", "0055AED6DCD90281E5")
+
+	if key != S3EventIdempotencyKey("trigger-bucket", "tmp/sample-cat-image.jpg", "", "0055AED6DCD90281E5") {
+		t.Error("\nActually: ", key, "\nExpected: the same key for the same event")
+	}
+
+	// 同じKeyに再度アップロードされた場合は別のイベントとして扱う
+	if key == S3EventIdempotencyKey("trigger-bucket", "tmp/sample-cat-image.jpg", "", "0055AED6DCD90281E6") {
+		t.Error("\nActually: ", key, "\nExpected: a different key for a different sequencer")
+	}
+}
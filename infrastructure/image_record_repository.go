@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ImageRecordStatus は画像の処理状況
+type ImageRecordStatus string
+
+const (
+	// ImageRecordStatusUploaded は tmp/ にアップロードされ、判定を待っている状態
+	ImageRecordStatusUploaded ImageRecordStatus = "uploaded"
+	// ImageRecordStatusEvaluating は isacceptablecatimage で判定中の状態
+	ImageRecordStatusEvaluating ImageRecordStatus = "evaluating"
+	// ImageRecordStatusAccepted は受け入れ可能なねこ画像として cat-images/ にコピーされた状態
+	ImageRecordStatusAccepted ImageRecordStatus = "accepted"
+	// ImageRecordStatusRejected は受け入れ不可として隔離された状態
+	ImageRecordStatusRejected ImageRecordStatus = "rejected"
+	// ImageRecordStatusFailed はRekognitionの障害等で判定出来なかった状態、S3イベントの再実行で再度判定される
+	ImageRecordStatusFailed ImageRecordStatus = "failed"
+)
+
+// ImageRecord は画像1枚分の処理状況
+type ImageRecord struct {
+	ImageId     string            `json:"imageId"`
+	Status      ImageRecordStatus `json:"status"`
+	S3ObjectKey string            `json:"s3ObjectKey"`
+	// Evaluation には判定結果（catimage.IsAcceptableCatImageResponse）をJSONのまま保存する
+	Evaluation   json.RawMessage `json:"evaluation,omitempty"`
+	ErrorMessage string          `json:"errorMessage,omitempty"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	UpdatedAt    time.Time       `json:"updatedAt"`
+}
+
+var ErrImageRecordNotFound = errors.New("image record not found")
+
+type ImageRecordRepository interface {
+	Save(ctx context.Context, record *ImageRecord) error
+	// FindById は見つからない場合 ErrImageRecordNotFound を返す
+	FindById(ctx context.Context, imageId string) (*ImageRecord, error)
+}
+
+// ImageIdFromS3ObjectKey はS3オブジェクトのKeyから画像のIDを取り出す
+// .e.g. "tmp/adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a.jpg" の場合は "adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a"
+func ImageIdFromS3ObjectKey(key string) string {
+	fileName := path.Base(key)
+
+	return strings.TrimSuffix(fileName, path.Ext(fileName))
+}
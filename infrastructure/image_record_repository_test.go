@@ -0,0 +1,135 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+)
+
+// inMemoryS3Client は S3ImageRecordRepository のテスト用に GetObject, PutObject だけを実装した S3Client
+type inMemoryS3Client struct {
+	S3Client
+	objects map[string][]byte
+}
+
+func (c *inMemoryS3Client) PutObject(
+	_ context.Context,
+	params *s3.PutObjectInput,
+	_ ...func(*s3.Options),
+) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)] = body
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *inMemoryS3Client) GetObject(
+	_ context.Context,
+	params *s3.GetObjectInput,
+	_ ...func(*s3.Options),
+) (*s3.GetObjectOutput, error) {
+	body, ok := c.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil
+}
+
+//nolint:funlen
+func TestImageRecordRepository(t *testing.T) {
+	fileRepository, err := NewFileImageRecordRepository(t.TempDir())
+	if err != nil {
+		t.Fatal("Error failed to NewFileImageRecordRepository", err)
+	}
+
+	s3Client := &inMemoryS3Client{objects: map[string][]byte{}}
+
+	repositories := []struct {
+		name       string
+		repository ImageRecordRepository
+	}{
+		{name: "memory", repository: NewMemoryImageRecordRepository()},
+		{name: "file", repository: fileRepository},
+		{name: "s3", repository: &S3ImageRecordRepository{S3Client: s3Client, BucketName: "test-bucket"}},
+	}
+
+	createdAt := time.Date(2022, 3, 19, 12, 0, 0, 0, time.UTC)
+
+	record := &ImageRecord{
+		ImageId:     "adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a",
+		Status:      ImageRecordStatusAccepted,
+		S3ObjectKey: "tmp/adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a.jpg",
+		Evaluation:  json.RawMessage(`{"isAcceptableCatImage":true,"typesOfCats":["Abyssinian"],"catCount":1}`),
+		CreatedAt:   createdAt,
+		UpdatedAt:   createdAt.Add(time.Minute),
+	}
+
+	for _, tt := range repositories {
+		tt := tt
+		t.Run("Successful save and find the image record with "+tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if err := tt.repository.Save(ctx, record); err != nil {
+				t.Fatal("Error failed to Save", err)
+			}
+
+			actual, err := tt.repository.FindById(ctx, record.ImageId)
+			if err != nil {
+				t.Fatal("Error failed to FindById", err)
+			}
+
+			if reflect.DeepEqual(actual, record) == false {
+				t.Error("\nActually: ", actual, "\nExpected: ", record)
+			}
+		})
+
+		t.Run("Failure the image record is not found with "+tt.name, func(t *testing.T) {
+			_, err := tt.repository.FindById(context.Background(), "not-found")
+			if !errors.Is(err, ErrImageRecordNotFound) {
+				t.Error("\nActually: ", err, "\nExpected: ", ErrImageRecordNotFound)
+			}
+		})
+	}
+
+	t.Run("Failure the image id contains a path with file", func(t *testing.T) {
+		_, err := fileRepository.FindById(context.Background(), "../image-record")
+		if err == nil || errors.Is(err, ErrImageRecordNotFound) {
+			t.Error("\nActually: ", err, "\nExpected: invalid image id")
+		}
+	})
+}
+
+func TestImageIdFromS3ObjectKey(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{key: "tmp/adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a.jpg", expected: "adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a"},
+		{key: "tmp/sample-cat-image.webp", expected: "sample-cat-image"},
+		{key: "sample-cat-image", expected: "sample-cat-image"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Successful extract the image id from "+tt.key, func(t *testing.T) {
+			actual := ImageIdFromS3ObjectKey(tt.key)
+			if actual != tt.expected {
+				t.Error("\nActually: ", actual, "\nExpected: ", tt.expected)
+			}
+		})
+	}
+}
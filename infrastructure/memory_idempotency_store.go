@@ -0,0 +1,84 @@
+package infrastructure
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryIdempotencyStore はメモリ上に記録する IdempotencyStore の実装
+// Lambdaの場合は同じ実行環境（コンテナ）に配信された重複イベントのみ検出出来る
+type MemoryIdempotencyStore struct {
+	// Retention が設定されていない場合は DefaultIdempotencyRetention を利用する
+	Retention time.Duration
+	// Now はテストで時刻を固定する為に利用する、設定されていない場合は time.Now を利用する
+	Now func() time.Time
+
+	mu      sync.Mutex
+	records map[string]idempotencyRecord
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: map[string]idempotencyRecord{}}
+}
+
+func (s *MemoryIdempotencyStore) Acquire(_ context.Context, key string, leaseDuration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.purgeExpired(now)
+
+	if record, ok := s.records[key]; ok {
+		if err := record.acquirable(now); err != nil {
+			return err
+		}
+	}
+
+	s.records[key] = idempotencyRecord{Status: idempotencyStatusInProgress, ExpiresAt: now.Add(leaseDuration)}
+
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = idempotencyRecord{Status: idempotencyStatusCompleted, ExpiresAt: s.now().Add(s.retention())}
+
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+
+	return nil
+}
+
+// purgeExpired はLambdaの実行環境が再利用され続けてもメモリが増え続けないように期限切れの記録を削除する
+func (s *MemoryIdempotencyStore) purgeExpired(now time.Time) {
+	for key, record := range s.records {
+		if !now.Before(record.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
+
+func (s *MemoryIdempotencyStore) retention() time.Duration {
+	if s.Retention <= 0 {
+		return DefaultIdempotencyRetention
+	}
+
+	return s.Retention
+}
+
+func (s *MemoryIdempotencyStore) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+
+	return s.Now()
+}
@@ -0,0 +1,38 @@
+package infrastructure
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryImageRecordRepository はメモリ上に保存する ImageRecordRepository の実装
+// プロセスを再起動すると消えるので、ローカルサーバーでの動作確認に利用する
+type MemoryImageRecordRepository struct {
+	mu      sync.RWMutex
+	records map[string]ImageRecord
+}
+
+func NewMemoryImageRecordRepository() *MemoryImageRecordRepository {
+	return &MemoryImageRecordRepository{records: map[string]ImageRecord{}}
+}
+
+func (r *MemoryImageRecordRepository) Save(_ context.Context, record *ImageRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records[record.ImageId] = *record
+
+	return nil
+}
+
+func (r *MemoryImageRecordRepository) FindById(_ context.Context, imageId string) (*ImageRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, ok := r.records[imageId]
+	if !ok {
+		return nil, ErrImageRecordNotFound
+	}
+
+	return &record, nil
+}
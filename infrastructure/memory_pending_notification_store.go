@@ -0,0 +1,47 @@
+package infrastructure
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryPendingNotificationStore はメモリ上に保存する PendingNotificationStore の実装
+// ローカルサーバーやテストで利用する
+type MemoryPendingNotificationStore struct {
+	mu            sync.Mutex
+	notifications map[string]*PendingNotification
+}
+
+func NewMemoryPendingNotificationStore() *MemoryPendingNotificationStore {
+	return &MemoryPendingNotificationStore{notifications: map[string]*PendingNotification{}}
+}
+
+func (s *MemoryPendingNotificationStore) Save(_ context.Context, key string, notification *PendingNotification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.notifications[key] = notification
+
+	return nil
+}
+
+func (s *MemoryPendingNotificationStore) Find(_ context.Context, key string) (*PendingNotification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notification, ok := s.notifications[key]
+	if !ok {
+		return nil, ErrPendingNotificationNotFound
+	}
+
+	return notification, nil
+}
+
+func (s *MemoryPendingNotificationStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.notifications, key)
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package infrastructure
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryPerceptualHashIndex はメモリ上に保存する PerceptualHashIndex の実装
+// ローカルサーバーやテストで利用する、プロセスが終了すると消える
+type MemoryPerceptualHashIndex struct {
+	mu     sync.RWMutex
+	hashes map[string]uint64
+}
+
+func NewMemoryPerceptualHashIndex() *MemoryPerceptualHashIndex {
+	return &MemoryPerceptualHashIndex{hashes: map[string]uint64{}}
+}
+
+func (i *MemoryPerceptualHashIndex) FindSimilar(
+	_ context.Context,
+	hash uint64,
+	maxDistance int,
+) ([]PerceptualHashMatch, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return findSimilarPerceptualHashes(i.hashes, hash, maxDistance), nil
+}
+
+func (i *MemoryPerceptualHashIndex) Add(_ context.Context, s3ObjectKey string, hash uint64) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.hashes[s3ObjectKey] = hash
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package infrastructure
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+const DefaultRekognitionCacheCapacity = 1000
+
+// MemoryRekognitionCacheStore は最大 Capacity 件まで保存し、超えた場合は最も長い間使われていないものから削除する RekognitionCacheStore の実装
+// Lambdaのインスタンスが破棄されると消えるので、同じインスタンスで同じ画像が続けて判定される場合のみ効果がある
+type MemoryRekognitionCacheStore struct {
+	capacity int
+	mu       sync.Mutex
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type memoryRekognitionCacheEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryRekognitionCacheStore は capacity が0以下の場合 DefaultRekognitionCacheCapacity を利用する
+func NewMemoryRekognitionCacheStore(capacity int) *MemoryRekognitionCacheStore {
+	if capacity <= 0 {
+		capacity = DefaultRekognitionCacheCapacity
+	}
+
+	return &MemoryRekognitionCacheStore{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryRekognitionCacheStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, ErrRekognitionCacheMiss
+	}
+
+	s.order.MoveToFront(element)
+
+	return element.Value.(*memoryRekognitionCacheEntry).value, nil
+}
+
+func (s *MemoryRekognitionCacheStore) Set(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		element.Value.(*memoryRekognitionCacheEntry).value = value
+		s.order.MoveToFront(element)
+
+		return nil
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryRekognitionCacheEntry{key: key, value: value})
+
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryRekognitionCacheEntry).key)
+	}
+
+	return nil
+}
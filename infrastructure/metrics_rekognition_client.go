@@ -0,0 +1,83 @@
+package infrastructure
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/smithy-go"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/pkg/errors"
+)
+
+// MetricsRekognitionClient はAPI毎の呼び出しにかかった時間とエラーの種類をメトリクスとして出力する RekognitionClient のデコレーター
+// リトライした場合も1回毎に出力されるように、aws-sdk-go-v2 のクライアントを直接包む
+type MetricsRekognitionClient struct {
+	Client  RekognitionClient
+	Metrics *metrics.Recorder
+}
+
+func (c *MetricsRekognitionClient) DetectLabels(
+	ctx context.Context,
+	params *rekognition.DetectLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectLabelsOutput, error) {
+	start := time.Now()
+	output, err := c.Client.DetectLabels(ctx, params, optFns...)
+	c.record("DetectLabels", start, err)
+
+	return output, err
+}
+
+func (c *MetricsRekognitionClient) DetectFaces(
+	ctx context.Context,
+	params *rekognition.DetectFacesInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectFacesOutput, error) {
+	start := time.Now()
+	output, err := c.Client.DetectFaces(ctx, params, optFns...)
+	c.record("DetectFaces", start, err)
+
+	return output, err
+}
+
+func (c *MetricsRekognitionClient) DetectModerationLabels(
+	ctx context.Context,
+	params *rekognition.DetectModerationLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectModerationLabelsOutput, error) {
+	start := time.Now()
+	output, err := c.Client.DetectModerationLabels(ctx, params, optFns...)
+	c.record("DetectModerationLabels", start, err)
+
+	return output, err
+}
+
+func (c *MetricsRekognitionClient) record(operation string, start time.Time, err error) {
+	c.Metrics.Duration("RekognitionLatency", time.Since(start), metrics.Dimensions{"Operation": operation})
+
+	if err != nil {
+		c.Metrics.Count("RekognitionErrors", metrics.Dimensions{
+			"Operation": operation,
+			"ErrorType": RekognitionErrorType(err),
+		})
+	}
+}
+
+// RekognitionErrorType はメトリクスのディメンションにするエラーの種類を返す
+// Rekognitionが返したエラーはエラーコード（.e.g. ThrottlingException）、それ以外はタイムアウト等の原因で分類する
+func RekognitionErrorType(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "DeadlineExceeded"
+	case errors.Is(err, context.Canceled):
+		return "Canceled"
+	default:
+		return "Unknown"
+	}
+}
@@ -0,0 +1,51 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/smithy-go"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/pkg/errors"
+)
+
+func TestMetricsRekognitionClient(t *testing.T) {
+	t.Run("Successful record the latency and the error type", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		throttlingErr := &smithy.GenericAPIError{Code: "ThrottlingException"}
+		client := &MetricsRekognitionClient{
+			Client:  &fakeRekognitionClient{errs: []error{throttlingErr}},
+			Metrics: metrics.New(&buf, "TestNamespace", nil),
+		}
+
+		_, err := client.DetectLabels(context.Background(), &rekognition.DetectLabelsInput{})
+		if !errors.Is(err, throttlingErr) {
+			t.Error("\nActually: ", err, "\nExpected: ", throttlingErr)
+		}
+
+		if _, err := client.DetectLabels(context.Background(), &rekognition.DetectLabelsInput{}); err != nil {
+			t.Fatal("Error failed to DetectLabels", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+		expected := []string{`"RekognitionLatency"`, `"ErrorType":"ThrottlingException"`, `"RekognitionLatency"`}
+		for i, s := range expected {
+			if len(lines) != len(expected) || !strings.Contains(lines[i], s) {
+				t.Fatal("\nActually: ", lines, "\nExpected: ", expected)
+			}
+		}
+	})
+
+	t.Run("Successful classify the error without the error code", func(t *testing.T) {
+		err := errors.Wrap(context.DeadlineExceeded, "failed to RekognitionClient.DetectLabels")
+
+		if errorType := RekognitionErrorType(err); errorType != "DeadlineExceeded" {
+			t.Error("\nActually: ", errorType, "\nExpected: ", "DeadlineExceeded")
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+var ErrPendingNotificationNotFound = errors.New("pending notification not found")
+
+// PendingNotification は通知に失敗したWebhookを再送する為に保存しておく内容
+// 受信側が同じ通知かどうか判断出来るように、再送する際も最初に送ったボディをそのまま利用する
+type PendingNotification struct {
+	Urls []string        `json:"urls"`
+	Body json.RawMessage `json:"body"`
+}
+
+// PendingNotificationStore はリトライしても通知出来なかった判定結果を、S3イベントが再実行された際に再送する為に保存する
+type PendingNotificationStore interface {
+	// Save は同じKeyが既に保存されている場合は上書きする
+	Save(ctx context.Context, key string, notification *PendingNotification) error
+	// Find は保存されていない場合 ErrPendingNotificationNotFound を返す
+	Find(ctx context.Context, key string) (*PendingNotification, error)
+	Delete(ctx context.Context, key string) error
+}
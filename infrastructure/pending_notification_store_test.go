@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestPendingNotificationStore(t *testing.T) {
+	stores := []struct {
+		name  string
+		store PendingNotificationStore
+	}{
+		{name: "memory", store: NewMemoryPendingNotificationStore()},
+		{name: "s3", store: &S3PendingNotificationStore{S3Client: &fakeListObjectsS3Client{}, BucketName: "trigger-bucket"}},
+	}
+
+	const key = "tmp/aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa.jpg"
+
+	for _, tt := range stores {
+		tt := tt
+		t.Run("Successful save, find and delete the pending notification with "+tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			notification := &PendingNotification{
+				Urls: []string{"https://example.com/webhooks/cat-images"},
+				Body: json.RawMessage(`{"decision":"accepted"}`),
+			}
+
+			if err := tt.store.Save(ctx, key, notification); err != nil {
+				t.Fatal("Error failed to Save", err)
+			}
+
+			actual, err := tt.store.Find(ctx, key)
+			if err != nil {
+				t.Fatal("Error failed to Find", err)
+			}
+
+			if reflect.DeepEqual(actual, notification) == false {
+				t.Error("\nActually: ", actual, "\nExpected: ", notification)
+			}
+
+			if err := tt.store.Delete(ctx, key); err != nil {
+				t.Fatal("Error failed to Delete", err)
+			}
+
+			if _, err := tt.store.Find(ctx, key); !errors.Is(err, ErrPendingNotificationNotFound) {
+				t.Error("\nActually: ", err, "\nExpected: ", ErrPendingNotificationNotFound)
+			}
+		})
+	}
+}
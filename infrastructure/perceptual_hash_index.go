@@ -0,0 +1,43 @@
+package infrastructure
+
+import (
+	"context"
+	"math/bits"
+	"sort"
+)
+
+// PerceptualHashMatch は知覚ハッシュが近い画像のS3オブジェクトのKeyとハミング距離
+type PerceptualHashMatch struct {
+	S3ObjectKey string `json:"s3ObjectKey"`
+	Distance    int    `json:"distance"`
+}
+
+// PerceptualHashIndex は受け入れ済みのねこ画像の知覚ハッシュを保存し、ほぼ同じ画像を探す為に利用する
+type PerceptualHashIndex interface {
+	// FindSimilar はハミング距離が maxDistance 以下の画像を距離が近い順に返す
+	FindSimilar(ctx context.Context, hash uint64, maxDistance int) ([]PerceptualHashMatch, error)
+	// Add は同じKeyが既に保存されている場合は上書きする
+	Add(ctx context.Context, s3ObjectKey string, hash uint64) error
+}
+
+// findSimilarPerceptualHashes は PerceptualHashIndex の各実装で共通の検索処理
+func findSimilarPerceptualHashes(hashes map[string]uint64, hash uint64, maxDistance int) []PerceptualHashMatch {
+	var matches []PerceptualHashMatch
+
+	for s3ObjectKey, h := range hashes {
+		if distance := bits.OnesCount64(hash ^ h); distance <= maxDistance {
+			matches = append(matches, PerceptualHashMatch{S3ObjectKey: s3ObjectKey, Distance: distance})
+		}
+	}
+
+	// 距離が同じ場合も結果が毎回同じになるようにKeyの順番にする
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+
+		return matches[i].S3ObjectKey < matches[j].S3ObjectKey
+	})
+
+	return matches
+}
@@ -0,0 +1,209 @@
+package infrastructure
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// fakeListObjectsS3Client は PutObject されたオブジェクトを保存し、Prefix に一致するKeyを1件ずつ別のページとして返す
+type fakeListObjectsS3Client struct {
+	S3Client
+	objects map[string]string
+}
+
+func (c *fakeListObjectsS3Client) PutObject(
+	ctx context.Context,
+	params *s3.PutObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.PutObjectOutput, error) {
+	b, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.objects == nil {
+		c.objects = map[string]string{}
+	}
+
+	c.objects[aws.ToString(params.Key)] = string(b)
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *fakeListObjectsS3Client) GetObject(
+	ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.GetObjectOutput, error) {
+	body, ok := c.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func (c *fakeListObjectsS3Client) DeleteObject(
+	ctx context.Context,
+	params *s3.DeleteObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.DeleteObjectOutput, error) {
+	delete(c.objects, aws.ToString(params.Key))
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (c *fakeListObjectsS3Client) ListObjectsV2(
+	ctx context.Context,
+	params *s3.ListObjectsV2Input,
+	optFns ...func(*s3.Options),
+) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range c.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	page := 0
+	if params.ContinuationToken != nil {
+		page = len(aws.ToString(params.ContinuationToken))
+	}
+
+	output := &s3.ListObjectsV2Output{}
+	if page < len(keys) {
+		output.Contents = []s3types.Object{{Key: aws.String(keys[page])}}
+	}
+
+	if page+1 < len(keys) {
+		output.IsTruncated = true
+		output.NextContinuationToken = aws.String(string(make([]byte, page+1)))
+	}
+
+	return output, nil
+}
+
+//nolint:funlen
+func TestPerceptualHashIndex(t *testing.T) {
+	indexes := []struct {
+		name     string
+		newIndex func() PerceptualHashIndex
+	}{
+		{
+			name:     "memory",
+			newIndex: func() PerceptualHashIndex { return NewMemoryPerceptualHashIndex() },
+		},
+		{
+			name: "s3",
+			newIndex: func() PerceptualHashIndex {
+				return &S3PerceptualHashIndex{S3Client: &fakeListObjectsS3Client{}, BucketName: "trigger-bucket"}
+			},
+		},
+	}
+
+	for _, tt := range indexes {
+		tt := tt
+		t.Run("Successful find the similar images in order of distance with "+tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			index := tt.newIndex()
+
+			const hash = uint64(0xf0f0f0f0f0f0f0f0)
+
+			added := map[string]uint64{
+				"cat-images/same.jpg":     hash,
+				"cat-images/near.jpg":     hash ^ 0b111,
+				"cat-images/far.jpg":      ^hash,
+				"cat-images/a/nested.jpg": hash ^ 0b1,
+			}
+
+			for key, h := range added {
+				if err := index.Add(ctx, key, h); err != nil {
+					t.Fatal("Error failed to Add", err)
+				}
+			}
+
+			matches, err := index.FindSimilar(ctx, hash, 3)
+			if err != nil {
+				t.Fatal("Error failed to FindSimilar", err)
+			}
+
+			expected := []PerceptualHashMatch{
+				{S3ObjectKey: "cat-images/same.jpg", Distance: 0},
+				{S3ObjectKey: "cat-images/a/nested.jpg", Distance: 1},
+				{S3ObjectKey: "cat-images/near.jpg", Distance: 3},
+			}
+
+			if reflect.DeepEqual(matches, expected) == false {
+				t.Error("\nActually: ", matches, "\nExpected: ", expected)
+			}
+		})
+
+		t.Run("Successful replace the hash of the same key with "+tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			index := tt.newIndex()
+
+			const hash = uint64(0xf0f0f0f0f0f0f0f0)
+
+			if err := index.Add(ctx, "cat-images/replaced.jpg", ^hash); err != nil {
+				t.Fatal("Error failed to Add", err)
+			}
+
+			if err := index.Add(ctx, "cat-images/replaced.jpg", hash); err != nil {
+				t.Fatal("Error failed to Add", err)
+			}
+
+			matches, err := index.FindSimilar(ctx, ^hash, 0)
+			if err != nil {
+				t.Fatal("Error failed to FindSimilar", err)
+			}
+
+			if len(matches) != 0 {
+				t.Error("\nActually: ", matches, "\nExpected: ", "no matches")
+			}
+
+			matches, err = index.FindSimilar(ctx, hash, 0)
+			if err != nil {
+				t.Fatal("Error failed to FindSimilar", err)
+			}
+
+			expected := []PerceptualHashMatch{{S3ObjectKey: "cat-images/replaced.jpg", Distance: 0}}
+
+			if reflect.DeepEqual(matches, expected) == false {
+				t.Error("\nActually: ", matches, "\nExpected: ", expected)
+			}
+		})
+
+		t.Run("Successful find the similar images with no matching byte with "+tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			index := tt.newIndex()
+
+			const hash = uint64(0xf0f0f0f0f0f0f0f0)
+
+			// 全てのバイトが1ビットずつ異なるので、maxDistance が8以上の場合だけ見つかる
+			if err := index.Add(ctx, "cat-images/every-byte.jpg", hash^0x0101010101010101); err != nil {
+				t.Fatal("Error failed to Add", err)
+			}
+
+			matches, err := index.FindSimilar(ctx, hash, 8)
+			if err != nil {
+				t.Fatal("Error failed to FindSimilar", err)
+			}
+
+			expected := []PerceptualHashMatch{{S3ObjectKey: "cat-images/every-byte.jpg", Distance: 8}}
+
+			if reflect.DeepEqual(matches, expected) == false {
+				t.Error("\nActually: ", matches, "\nExpected: ", expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package infrastructure
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+)
+
+// RateLimitedRekognitionClient はAPI毎の TokenBucket でTPSを制限する RekognitionClient のデコレーター
+// Rekognitionにスロットリングされるまで呼び続けるのではなく、呼び出す前にトークンが補充されるまで待つ
+// TokenBucket はプロセス内でしか共有されないので、Lambdaの同時実行数が増えるとその分だけ全体のTPSは増える事に注意
+type RateLimitedRekognitionClient struct {
+	Client RekognitionClient
+	// 以下が設定されていないAPIは制限しない
+	DetectLabelsLimiter           *TokenBucket
+	DetectFacesLimiter            *TokenBucket
+	DetectModerationLabelsLimiter *TokenBucket
+	// Metrics が設定されている場合は、TPSの制限で待った時間をAPI毎に RekognitionRateLimitWait として出力する
+	Metrics *metrics.Recorder
+}
+
+func (c *RateLimitedRekognitionClient) DetectLabels(
+	ctx context.Context,
+	params *rekognition.DetectLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectLabelsOutput, error) {
+	if err := c.wait(ctx, "DetectLabels", c.DetectLabelsLimiter); err != nil {
+		return nil, err
+	}
+
+	return c.Client.DetectLabels(ctx, params, optFns...)
+}
+
+func (c *RateLimitedRekognitionClient) DetectFaces(
+	ctx context.Context,
+	params *rekognition.DetectFacesInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectFacesOutput, error) {
+	if err := c.wait(ctx, "DetectFaces", c.DetectFacesLimiter); err != nil {
+		return nil, err
+	}
+
+	return c.Client.DetectFaces(ctx, params, optFns...)
+}
+
+func (c *RateLimitedRekognitionClient) DetectModerationLabels(
+	ctx context.Context,
+	params *rekognition.DetectModerationLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectModerationLabelsOutput, error) {
+	if err := c.wait(ctx, "DetectModerationLabels", c.DetectModerationLabelsLimiter); err != nil {
+		return nil, err
+	}
+
+	return c.Client.DetectModerationLabels(ctx, params, optFns...)
+}
+
+// Stats はAPI毎にTPSの制限で待った回数と待った時間の合計を返す、制限していないAPIは含まない
+func (c *RateLimitedRekognitionClient) Stats() map[string]TokenBucketStats {
+	stats := map[string]TokenBucketStats{}
+
+	limiters := map[string]*TokenBucket{
+		"DetectLabels":           c.DetectLabelsLimiter,
+		"DetectFaces":            c.DetectFacesLimiter,
+		"DetectModerationLabels": c.DetectModerationLabelsLimiter,
+	}
+
+	for operation, limiter := range limiters {
+		if limiter != nil {
+			stats[operation] = limiter.Stats()
+		}
+	}
+
+	return stats
+}
+
+// wait は limiter のトークンを取得するまで待つ、待たなかった場合も0ミリ秒として出力するので平均の待ち時間が分かる
+func (c *RateLimitedRekognitionClient) wait(ctx context.Context, operation string, limiter *TokenBucket) error {
+	if limiter == nil {
+		return nil
+	}
+
+	start := time.Now()
+	err := limiter.Wait(ctx)
+	c.Metrics.Duration("RekognitionRateLimitWait", time.Since(start), metrics.Dimensions{"Operation": operation})
+
+	return err
+}
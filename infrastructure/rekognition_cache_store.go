@@ -0,0 +1,17 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+var ErrRekognitionCacheMiss = errors.New("rekognition cache miss")
+
+// RekognitionCacheStore は CachingRekognitionClient がRekognitionのレスポンスを保存する為に利用する
+// 有効期限は CachingRekognitionClient が値に含めて管理するので、実装は値をそのまま保存すれば良い
+type RekognitionCacheStore interface {
+	// Get は保存されていない場合 ErrRekognitionCacheMiss を返す
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+}
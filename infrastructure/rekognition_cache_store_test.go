@@ -0,0 +1,66 @@
+package infrastructure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestRekognitionCacheStore(t *testing.T) {
+	fileStore, err := NewFileRekognitionCacheStore(t.TempDir())
+	if err != nil {
+		t.Fatal("Error failed to NewFileRekognitionCacheStore", err)
+	}
+
+	stores := []struct {
+		name  string
+		store RekognitionCacheStore
+	}{
+		{name: "memory", store: NewMemoryRekognitionCacheStore(0)},
+		{name: "file", store: fileStore},
+	}
+
+	for _, tt := range stores {
+		tt := tt
+		t.Run("Successful get the saved value with "+tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if _, err := tt.store.Get(ctx, "not-saved"); !errors.Is(err, ErrRekognitionCacheMiss) {
+				t.Error("\nActually: ", err, "\nExpected: ", ErrRekognitionCacheMiss)
+			}
+
+			if err := tt.store.Set(ctx, "saved", []byte(`{"detectLabels":{}}`)); err != nil {
+				t.Fatal("Error failed to Set", err)
+			}
+
+			value, err := tt.store.Get(ctx, "saved")
+			if err != nil || string(value) != `{"detectLabels":{}}` {
+				t.Error("\nActually: ", string(value), err, "\nExpected: ", `{"detectLabels":{}}`)
+			}
+		})
+	}
+}
+
+func TestMemoryRekognitionCacheStore(t *testing.T) {
+	t.Run("Successful remove the least recently used value", func(t *testing.T) {
+		ctx := context.Background()
+
+		store := NewMemoryRekognitionCacheStore(2)
+
+		_ = store.Set(ctx, "a", []byte("a"))
+		_ = store.Set(ctx, "b", []byte("b"))
+		_, _ = store.Get(ctx, "a")
+		_ = store.Set(ctx, "c", []byte("c"))
+
+		if _, err := store.Get(ctx, "b"); !errors.Is(err, ErrRekognitionCacheMiss) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrRekognitionCacheMiss)
+		}
+
+		for _, key := range []string{"a", "c"} {
+			if _, err := store.Get(ctx, key); err != nil {
+				t.Error("\nActually: ", err, "\nExpected: ", nil)
+			}
+		}
+	})
+}
@@ -17,4 +17,9 @@ type RekognitionClient interface {
 		params *rekognition.DetectFacesInput,
 		optFns ...func(*rekognition.Options),
 	) (*rekognition.DetectFacesOutput, error)
+	DetectModerationLabels(
+		ctx context.Context,
+		params *rekognition.DetectModerationLabelsInput,
+		optFns ...func(*rekognition.Options),
+	) (*rekognition.DetectModerationLabelsOutput, error)
 }
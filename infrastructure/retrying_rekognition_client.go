@@ -0,0 +1,175 @@
+package infrastructure
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/smithy-go"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultRekognitionMaxAttempts    = 4
+	DefaultRekognitionInitialBackoff = 100 * time.Millisecond
+	DefaultRekognitionMaxBackoff     = 2 * time.Second
+)
+
+// retryableRekognitionErrorCodes はリトライすれば成功する可能性があるRekognitionのエラーコード
+// InvalidImageFormatException 等の画像やリクエストそのものに問題があるエラーは何度実行しても結果が変わらないので含めない
+var retryableRekognitionErrorCodes = map[string]bool{
+	"ThrottlingException":                    true,
+	"ProvisionedThroughputExceededException": true,
+	"InternalServerError":                    true,
+}
+
+// IsRetryableRekognitionError はRekognitionのスロットリング等、リトライすべきエラーかどうかを判定する
+func IsRetryableRekognitionError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return retryableRekognitionErrorCodes[apiErr.ErrorCode()]
+}
+
+// RetryingRekognitionClient はリトライすべきエラーの場合に Full Jitter の指数バックオフでリトライする RekognitionClient のデコレーター
+// 複数のLambdaから同時に呼ばれてもリトライのタイミングが揃わないように、待ち時間は0からバックオフの値までの間でランダムに決める
+// aws-sdk-go-v2 自体のリトライを使い切った後に、更に待ち時間を長く取ってリトライする為に利用する
+type RetryingRekognitionClient struct {
+	Client RekognitionClient
+	// 以下が設定されていない場合は DefaultRekognition〇〇 を利用する
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Logger が設定されていない場合はリトライしてもログを出力しない
+	Logger *logging.Logger
+	// Metrics が設定されている場合は、リトライする度にAPI毎の RekognitionRetries として出力する
+	Metrics *metrics.Recorder
+	retries int64
+}
+
+// Retries はこれまでにリトライした回数の合計を返す
+func (c *RetryingRekognitionClient) Retries() int64 {
+	return atomic.LoadInt64(&c.retries)
+}
+
+func (c *RetryingRekognitionClient) DetectLabels(
+	ctx context.Context,
+	params *rekognition.DetectLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectLabelsOutput, error) {
+	var output *rekognition.DetectLabelsOutput
+
+	err := c.retry(ctx, "DetectLabels", func() error {
+		var err error
+		output, err = c.Client.DetectLabels(ctx, params, optFns...)
+
+		return err
+	})
+
+	return output, err
+}
+
+func (c *RetryingRekognitionClient) DetectFaces(
+	ctx context.Context,
+	params *rekognition.DetectFacesInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectFacesOutput, error) {
+	var output *rekognition.DetectFacesOutput
+
+	err := c.retry(ctx, "DetectFaces", func() error {
+		var err error
+		output, err = c.Client.DetectFaces(ctx, params, optFns...)
+
+		return err
+	})
+
+	return output, err
+}
+
+func (c *RetryingRekognitionClient) DetectModerationLabels(
+	ctx context.Context,
+	params *rekognition.DetectModerationLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectModerationLabelsOutput, error) {
+	var output *rekognition.DetectModerationLabelsOutput
+
+	err := c.retry(ctx, "DetectModerationLabels", func() error {
+		var err error
+		output, err = c.Client.DetectModerationLabels(ctx, params, optFns...)
+
+		return err
+	})
+
+	return output, err
+}
+
+// retry はリトライを諦めた場合、最後のエラーをそのまま返す（呼び出し元のエラーの扱いを変えない為）
+func (c *RetryingRekognitionClient) retry(ctx context.Context, operation string, call func() error) error {
+	backoff := c.initialBackoff()
+
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || !IsRetryableRekognitionError(err) || attempt >= c.maxAttempts() {
+			return err
+		}
+
+		//nolint:gosec
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+
+		// 待っている間にタイムアウトする場合は、待たずに最後のエラーを返す
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+
+		c.Logger.Warn(ctx, "retry Rekognition", logging.Fields{
+			"operation": operation,
+			"attempt":   attempt,
+			"wait":      wait.String(),
+			"error":     err.Error(),
+		})
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		atomic.AddInt64(&c.retries, 1)
+		c.Metrics.Count("RekognitionRetries", metrics.Dimensions{"Operation": operation})
+
+		backoff *= 2
+		if backoff > c.maxBackoff() {
+			backoff = c.maxBackoff()
+		}
+	}
+}
+
+func (c *RetryingRekognitionClient) maxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return DefaultRekognitionMaxAttempts
+	}
+
+	return c.MaxAttempts
+}
+
+func (c *RetryingRekognitionClient) initialBackoff() time.Duration {
+	if c.InitialBackoff <= 0 {
+		return DefaultRekognitionInitialBackoff
+	}
+
+	return c.InitialBackoff
+}
+
+func (c *RetryingRekognitionClient) maxBackoff() time.Duration {
+	if c.MaxBackoff <= 0 {
+		return DefaultRekognitionMaxBackoff
+	}
+
+	return c.MaxBackoff
+}
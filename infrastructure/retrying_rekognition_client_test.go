@@ -0,0 +1,121 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/smithy-go"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/pkg/errors"
+)
+
+// fakeRekognitionClient は errs の順番にエラーを返し、エラーが無くなったら成功する
+type fakeRekognitionClient struct {
+	RekognitionClient
+	errs  []error
+	calls int
+}
+
+func (c *fakeRekognitionClient) DetectLabels(
+	ctx context.Context,
+	params *rekognition.DetectLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectLabelsOutput, error) {
+	c.calls++
+
+	if c.calls <= len(c.errs) {
+		return nil, c.errs[c.calls-1]
+	}
+
+	return &rekognition.DetectLabelsOutput{}, nil
+}
+
+//nolint:funlen
+func TestRetryingRekognitionClient(t *testing.T) {
+	throttlingErr := &smithy.GenericAPIError{Code: "ThrottlingException"}
+	provisionedThroughputErr := &smithy.GenericAPIError{Code: "ProvisionedThroughputExceededException"}
+	invalidImageErr := &smithy.GenericAPIError{Code: "InvalidImageFormatException"}
+
+	newClient := func(errs ...error) (*RetryingRekognitionClient, *fakeRekognitionClient) {
+		fake := &fakeRekognitionClient{errs: errs}
+
+		return &RetryingRekognitionClient{
+			Client:         fake,
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+		}, fake
+	}
+
+	t.Run("Successful retry the throttled requests", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		client, fake := newClient(throttlingErr, provisionedThroughputErr)
+		client.Metrics = metrics.New(&buf, "TestNamespace", nil)
+
+		output, err := client.DetectLabels(context.Background(), &rekognition.DetectLabelsInput{})
+		if err != nil {
+			t.Fatal("Error failed to DetectLabels", err)
+		}
+
+		if output == nil || fake.calls != 3 || client.Retries() != 2 {
+			t.Error("\nActually: ", fake.calls, client.Retries(), "\nExpected: ", 3, 2)
+		}
+
+		if count := strings.Count(buf.String(), `"RekognitionRetries":1`); count != 2 {
+			t.Error("\nActually: ", count, "\nExpected: ", 2)
+		}
+	})
+
+	t.Run("Failure do not retry the non retryable error", func(t *testing.T) {
+		client, fake := newClient(invalidImageErr)
+
+		_, err := client.DetectLabels(context.Background(), &rekognition.DetectLabelsInput{})
+		if !errors.Is(err, invalidImageErr) {
+			t.Error("\nActually: ", err, "\nExpected: ", invalidImageErr)
+		}
+
+		if fake.calls != 1 || client.Retries() != 0 {
+			t.Error("\nActually: ", fake.calls, client.Retries(), "\nExpected: ", 1, 0)
+		}
+	})
+
+	t.Run("Failure return the last error when the attempts are exhausted", func(t *testing.T) {
+		client, fake := newClient(throttlingErr, throttlingErr, throttlingErr, throttlingErr)
+
+		_, err := client.DetectLabels(context.Background(), &rekognition.DetectLabelsInput{})
+		if !errors.Is(err, throttlingErr) {
+			t.Error("\nActually: ", err, "\nExpected: ", throttlingErr)
+		}
+
+		if fake.calls != 3 || client.Retries() != 2 {
+			t.Error("\nActually: ", fake.calls, client.Retries(), "\nExpected: ", 3, 2)
+		}
+	})
+
+	t.Run("Failure do not wait beyond the context deadline", func(t *testing.T) {
+		client, fake := newClient(throttlingErr)
+
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+
+		_, err := client.DetectLabels(ctx, &rekognition.DetectLabelsInput{})
+		if !errors.Is(err, throttlingErr) {
+			t.Error("\nActually: ", err, "\nExpected: ", throttlingErr)
+		}
+
+		if fake.calls != 1 || client.Retries() != 0 {
+			t.Error("\nActually: ", fake.calls, client.Retries(), "\nExpected: ", 1, 0)
+		}
+	})
+
+	t.Run("Successful detect the retryable error wrapped by the caller", func(t *testing.T) {
+		if !IsRetryableRekognitionError(errors.Wrap(throttlingErr, "failed to RekognitionClient.DetectLabels")) {
+			t.Error("\nActually: ", false, "\nExpected: ", true)
+		}
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 type S3Client interface {
@@ -12,4 +14,58 @@ type S3Client interface {
 		params *s3.CopyObjectInput,
 		optFns ...func(*s3.Options),
 	) (*s3.CopyObjectOutput, error)
+	GetObject(
+		ctx context.Context,
+		params *s3.GetObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.GetObjectOutput, error)
+	DeleteObject(
+		ctx context.Context,
+		params *s3.DeleteObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.DeleteObjectOutput, error)
+	HeadObject(
+		ctx context.Context,
+		params *s3.HeadObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.HeadObjectOutput, error)
+	ListObjectsV2(
+		ctx context.Context,
+		params *s3.ListObjectsV2Input,
+		optFns ...func(*s3.Options),
+	) (*s3.ListObjectsV2Output, error)
+	PutObject(
+		ctx context.Context,
+		params *s3.PutObjectInput,
+		optFns ...func(*s3.Options),
+	) (*s3.PutObjectOutput, error)
+}
+
+// withS3RequestHeader は aws-sdk-go-v2 の入力に無いヘッダー（If-None-Match 等）をS3へのリクエストに追加する
+// 署名より前の Build で設定するので、追加したヘッダーも署名に含まれる
+func withS3RequestHeader(name string, value string) func(*s3.Options) {
+	return func(options *s3.Options) {
+		options.APIOptions = append(options.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Build.Add(&s3RequestHeader{name: name, value: value}, middleware.After)
+		})
+	}
+}
+
+type s3RequestHeader struct {
+	name  string
+	value string
+}
+
+func (m *s3RequestHeader) ID() string { return "S3RequestHeader" + m.name }
+
+func (m *s3RequestHeader) HandleBuild(
+	ctx context.Context,
+	in middleware.BuildInput,
+	next middleware.BuildHandler,
+) (middleware.BuildOutput, middleware.Metadata, error) {
+	if req, ok := in.Request.(*smithyhttp.Request); ok {
+		req.Header.Set(m.name, m.value)
+	}
+
+	return next.HandleBuild(ctx, in)
 }
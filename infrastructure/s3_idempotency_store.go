@@ -0,0 +1,171 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+)
+
+// DefaultIdempotencyPrefix は処理済みの記録を保存するS3のフォルダ
+// tmp/ 配下に保存すると isacceptablecatimage が実行されてしまうので別のフォルダにする
+const DefaultIdempotencyPrefix = "idempotency/"
+
+// S3IdempotencyStore は1イベントにつき1つのS3オブジェクトとして記録する IdempotencyStore の実装
+// 異なるLambdaの実行環境（コンテナ）に配信された重複イベントも検出出来るように、Lambdaではこれを利用する
+// 記録の作成は If-None-Match、期限切れの記録の引き継ぎは If-Match の条件付き書き込みで行うので、同時に Acquire しても1つしか成功しない
+type S3IdempotencyStore struct {
+	S3Client   S3Client
+	BucketName string
+	// Prefix が空の場合は DefaultIdempotencyPrefix を利用する
+	Prefix string
+	// Retention が設定されていない場合は DefaultIdempotencyRetention を利用する
+	Retention time.Duration
+	// Now はテストで時刻を固定する為に利用する、設定されていない場合は time.Now を利用する
+	Now func() time.Time
+}
+
+func (s *S3IdempotencyStore) Acquire(ctx context.Context, key string, leaseDuration time.Duration) error {
+	record, etag, err := s.read(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	if err := record.acquirable(now); err != nil {
+		return err
+	}
+
+	// 記録が無い場合は新規作成、期限切れの場合は読み込んだ記録から変更されていない場合だけ上書きする
+	condition := withS3RequestHeader("If-None-Match", "*")
+	if record != nil {
+		condition = withS3RequestHeader("If-Match", etag)
+	}
+
+	err = s.write(ctx, key, &idempotencyRecord{
+		Status:    idempotencyStatusInProgress,
+		ExpiresAt: now.Add(leaseDuration),
+	}, condition)
+	if isS3PreconditionFailed(err) {
+		return errors.Wrap(ErrProcessingInProgress, "acquired by another process")
+	}
+
+	return err
+}
+
+func (s *S3IdempotencyStore) Complete(ctx context.Context, key string) error {
+	return s.write(ctx, key, &idempotencyRecord{
+		Status:    idempotencyStatusCompleted,
+		ExpiresAt: s.now().Add(s.retention()),
+	})
+}
+
+func (s *S3IdempotencyStore) Release(ctx context.Context, key string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(s.key(key)),
+	}
+
+	if _, err := s.S3Client.DeleteObject(ctx, input); err != nil {
+		return errors.Wrap(err, "failed to S3Client.DeleteObject")
+	}
+
+	return nil
+}
+
+// read は記録が無い場合に nil を返す、記録がある場合は条件付き書き込みに利用する ETag も返す
+func (s *S3IdempotencyStore) read(ctx context.Context, key string) (*idempotencyRecord, string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(s.key(key)),
+	}
+
+	output, err := s.S3Client.GetObject(ctx, input)
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, "", nil
+		}
+
+		return nil, "", errors.Wrap(err, "failed to S3Client.GetObject")
+	}
+	defer output.Body.Close()
+
+	recordJson, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to read s3 object body")
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(recordJson, &record); err != nil {
+		return nil, "", errors.Wrap(err, "failed to json.Unmarshal")
+	}
+
+	return &record, aws.ToString(output.ETag), nil
+}
+
+func (s *S3IdempotencyStore) write(
+	ctx context.Context,
+	key string,
+	record *idempotencyRecord,
+	optFns ...func(*s3.Options),
+) error {
+	recordJson, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to json.Marshal")
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.BucketName),
+		Key:         aws.String(s.key(key)),
+		Body:        bytes.NewReader(recordJson),
+		ContentType: aws.String("application/json"),
+	}
+
+	if _, err := s.S3Client.PutObject(ctx, input, optFns...); err != nil {
+		return errors.Wrap(err, "failed to S3Client.PutObject")
+	}
+
+	return nil
+}
+
+func (s *S3IdempotencyStore) key(key string) string {
+	if s.Prefix == "" {
+		return DefaultIdempotencyPrefix + key + ".json"
+	}
+
+	return s.Prefix + key + ".json"
+}
+
+func (s *S3IdempotencyStore) retention() time.Duration {
+	if s.Retention <= 0 {
+		return DefaultIdempotencyRetention
+	}
+
+	return s.Retention
+}
+
+func (s *S3IdempotencyStore) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+
+	return s.Now()
+}
+
+// isS3PreconditionFailed は条件付き書き込みの条件を満たさなかった場合、または同じKeyへの条件付き書き込みが競合した場合に true を返す
+func isS3PreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.ErrorCode() == "PreconditionFailed" || apiErr.ErrorCode() == "ConditionalRequestConflict"
+}
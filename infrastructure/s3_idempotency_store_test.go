@@ -0,0 +1,181 @@
+package infrastructure
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/pkg/errors"
+)
+
+type fakeConditionalS3Object struct {
+	body string
+	etag string
+}
+
+// fakeConditionalS3Client は If-None-Match, If-Match の条件付き書き込みを本物のS3と同じように扱う
+type fakeConditionalS3Client struct {
+	S3Client
+	objects map[string]fakeConditionalS3Object
+	version int
+	// beforePut は他のプロセスが同時に書き込んだ場合を再現する為に利用する
+	beforePut func()
+}
+
+func (c *fakeConditionalS3Client) GetObject(
+	ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.GetObjectOutput, error) {
+	object, ok := c.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(object.body)), ETag: aws.String(object.etag)}, nil
+}
+
+func (c *fakeConditionalS3Client) PutObject(
+	ctx context.Context,
+	params *s3.PutObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.PutObjectOutput, error) {
+	if beforePut := c.beforePut; beforePut != nil {
+		c.beforePut = nil
+		beforePut()
+	}
+
+	header, err := s3RequestHeaders(ctx, optFns)
+	if err != nil {
+		return nil, err
+	}
+
+	key := aws.ToString(params.Key)
+	object, exists := c.objects[key]
+
+	if header.Get("If-None-Match") == "*" && exists {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}
+	}
+
+	if ifMatch := header.Get("If-Match"); ifMatch != "" && (!exists || object.etag != ifMatch) {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}
+	}
+
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.objects == nil {
+		c.objects = map[string]fakeConditionalS3Object{}
+	}
+
+	c.version++
+	c.objects[key] = fakeConditionalS3Object{body: string(body), etag: strconv.Quote(strconv.Itoa(c.version))}
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *fakeConditionalS3Client) DeleteObject(
+	ctx context.Context,
+	params *s3.DeleteObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.DeleteObjectOutput, error) {
+	delete(c.objects, aws.ToString(params.Key))
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// s3RequestHeaders は optFns で追加された middleware を実行して、S3へのリクエストに設定されるヘッダーを返す
+func s3RequestHeaders(ctx context.Context, optFns []func(*s3.Options)) (http.Header, error) {
+	var options s3.Options
+	for _, fn := range optFns {
+		fn(&options)
+	}
+
+	stack := middleware.NewStack("fake", smithyhttp.NewStackRequest)
+	for _, apiOption := range options.APIOptions {
+		if err := apiOption(stack); err != nil {
+			return nil, err
+		}
+	}
+
+	var header http.Header
+
+	handler := middleware.DecorateHandler(
+		middleware.HandlerFunc(func(ctx context.Context, input interface{}) (interface{}, middleware.Metadata, error) {
+			header = input.(*smithyhttp.Request).Header
+
+			return nil, middleware.Metadata{}, nil
+		}),
+		stack,
+	)
+
+	if _, _, err := handler.Handle(ctx, struct{}{}); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+func TestS3IdempotencyStore(t *testing.T) {
+	const leaseDuration = time.Minute
+
+	key := S3EventIdempotencyKey("trigger-bucket", "tmp/sample-cat-image.jpg", "", "0055AED6DCD90281E5")
+
+	t.Run("Failure the event is acquired by another process at the same time", func(t *testing.T) {
+		ctx := context.Background()
+
+		client := &fakeConditionalS3Client{}
+		store := &S3IdempotencyStore{S3Client: client, BucketName: "trigger-bucket"}
+		another := &S3IdempotencyStore{S3Client: client, BucketName: "trigger-bucket"}
+
+		// 記録が無い事を確認してから書き込むまでの間に、別の実行環境が同じイベントを Acquire する
+		client.beforePut = func() {
+			if err := another.Acquire(ctx, key, leaseDuration); err != nil {
+				t.Fatal("Error failed to Acquire", err)
+			}
+		}
+
+		if err := store.Acquire(ctx, key, leaseDuration); !errors.Is(err, ErrProcessingInProgress) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrProcessingInProgress)
+		}
+	})
+
+	t.Run("Failure the expired lease is taken over by another process at the same time", func(t *testing.T) {
+		ctx := context.Background()
+
+		now := time.Date(2022, 3, 19, 12, 0, 0, 0, time.UTC)
+		clock := func() time.Time { return now }
+
+		client := &fakeConditionalS3Client{}
+		store := &S3IdempotencyStore{S3Client: client, BucketName: "trigger-bucket", Now: clock}
+		another := &S3IdempotencyStore{S3Client: client, BucketName: "trigger-bucket", Now: clock}
+
+		if err := store.Acquire(ctx, key, leaseDuration); err != nil {
+			t.Fatal("Error failed to Acquire", err)
+		}
+
+		now = now.Add(leaseDuration)
+
+		client.beforePut = func() {
+			if err := another.Acquire(ctx, key, leaseDuration); err != nil {
+				t.Fatal("Error failed to Acquire", err)
+			}
+		}
+
+		if err := store.Acquire(ctx, key, leaseDuration); !errors.Is(err, ErrProcessingInProgress) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrProcessingInProgress)
+		}
+	})
+}
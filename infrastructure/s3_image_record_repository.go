@@ -0,0 +1,85 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultImageRecordPrefix は ImageRecord を保存するS3のフォルダ
+// tmp/ 配下に保存すると isacceptablecatimage が実行されてしまうので別のフォルダにする
+const DefaultImageRecordPrefix = "image-records/"
+
+// S3ImageRecordRepository はS3オブジェクトとして保存する ImageRecordRepository の実装
+// imagerecognition, isacceptablecatimage 等、複数のLambda関数で処理状況を共有する為に利用する
+type S3ImageRecordRepository struct {
+	S3Client   S3Client
+	BucketName string
+	// Prefix が空の場合は DefaultImageRecordPrefix を利用する
+	Prefix string
+}
+
+func (r *S3ImageRecordRepository) Save(ctx context.Context, record *ImageRecord) error {
+	recordJson, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to json.Marshal")
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(r.BucketName),
+		Key:         aws.String(r.key(record.ImageId)),
+		Body:        bytes.NewReader(recordJson),
+		ContentType: aws.String("application/json"),
+	}
+
+	if _, err := r.S3Client.PutObject(ctx, input); err != nil {
+		return errors.Wrap(err, "failed to S3Client.PutObject")
+	}
+
+	return nil
+}
+
+func (r *S3ImageRecordRepository) FindById(ctx context.Context, imageId string) (*ImageRecord, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(r.BucketName),
+		Key:    aws.String(r.key(imageId)),
+	}
+
+	output, err := r.S3Client.GetObject(ctx, input)
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrImageRecordNotFound
+		}
+
+		return nil, errors.Wrap(err, "failed to S3Client.GetObject")
+	}
+	defer output.Body.Close()
+
+	recordJson, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read s3 object body")
+	}
+
+	var record ImageRecord
+	if err := json.Unmarshal(recordJson, &record); err != nil {
+		return nil, errors.Wrap(err, "failed to json.Unmarshal")
+	}
+
+	return &record, nil
+}
+
+func (r *S3ImageRecordRepository) key(imageId string) string {
+	prefix := r.Prefix
+	if prefix == "" {
+		prefix = DefaultImageRecordPrefix
+	}
+
+	return prefix + imageId + ".json"
+}
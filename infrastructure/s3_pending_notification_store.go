@@ -0,0 +1,97 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultPendingNotificationPrefix は再送待ちの通知を保存するS3のフォルダ
+// tmp/ 配下に保存すると isacceptablecatimage が実行されてしまうので別のフォルダにする
+const DefaultPendingNotificationPrefix = "pending-notifications/"
+
+// S3PendingNotificationStore は "Prefix/{Key}.json" というS3オブジェクトとして保存する PendingNotificationStore の実装
+// S3イベントの再実行は別の実行環境（コンテナ）に配信される事があるので、Lambdaではこれを利用する
+type S3PendingNotificationStore struct {
+	S3Client   S3Client
+	BucketName string
+	// Prefix が空の場合は DefaultPendingNotificationPrefix を利用する
+	Prefix string
+}
+
+func (s *S3PendingNotificationStore) Save(ctx context.Context, key string, notification *PendingNotification) error {
+	notificationJson, err := json.Marshal(notification)
+	if err != nil {
+		return errors.Wrap(err, "failed to json.Marshal")
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.BucketName),
+		Key:         aws.String(s.key(key)),
+		Body:        bytes.NewReader(notificationJson),
+		ContentType: aws.String("application/json"),
+	}
+
+	if _, err := s.S3Client.PutObject(ctx, input); err != nil {
+		return errors.Wrap(err, "failed to S3Client.PutObject")
+	}
+
+	return nil
+}
+
+func (s *S3PendingNotificationStore) Find(ctx context.Context, key string) (*PendingNotification, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(s.key(key)),
+	}
+
+	output, err := s.S3Client.GetObject(ctx, input)
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrPendingNotificationNotFound
+		}
+
+		return nil, errors.Wrap(err, "failed to S3Client.GetObject")
+	}
+	defer output.Body.Close()
+
+	notificationJson, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read s3 object body")
+	}
+
+	var notification PendingNotification
+	if err := json.Unmarshal(notificationJson, &notification); err != nil {
+		return nil, errors.Wrap(err, "failed to json.Unmarshal")
+	}
+
+	return &notification, nil
+}
+
+func (s *S3PendingNotificationStore) Delete(ctx context.Context, key string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(s.key(key)),
+	}
+
+	if _, err := s.S3Client.DeleteObject(ctx, input); err != nil {
+		return errors.Wrap(err, "failed to S3Client.DeleteObject")
+	}
+
+	return nil
+}
+
+func (s *S3PendingNotificationStore) key(key string) string {
+	if s.Prefix == "" {
+		return DefaultPendingNotificationPrefix + key + ".json"
+	}
+
+	return s.Prefix + key + ".json"
+}
@@ -0,0 +1,211 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultPerceptualHashPrefix は知覚ハッシュを保存するS3のフォルダ
+// tmp/ 配下に保存すると isacceptablecatimage が実行されてしまうので別のフォルダにする
+const DefaultPerceptualHashPrefix = "perceptual-hashes/"
+
+// perceptualHashHexLength は64ビットの知覚ハッシュを16進数で表した場合の桁数
+const perceptualHashHexLength = 16
+
+// perceptualHashBands は知覚ハッシュを分割するバンドの数、1バンドは8ビット
+// ハミング距離が perceptualHashBands 未満の2つのハッシュは鳩の巣原理で少なくとも1つのバンドが一致する
+const perceptualHashBands = 8
+
+// perceptualHashKeysFolder は画像毎に現在の知覚ハッシュを保存するフォルダ
+const perceptualHashKeysFolder = "keys/"
+
+// S3PerceptualHashIndex は知覚ハッシュを8ビットずつのバンドに分割し
+// "Prefix/{バンド番号}/{バンドの値}/{知覚ハッシュ}/{画像のKey}" という空のS3オブジェクトとして保存する PerceptualHashIndex の実装
+// maxDistance が8未満の場合は一致するバンドのフォルダだけを ListObjectsV2 すれば良いので、全ての知覚ハッシュを取得する必要が無い
+// 複数のLambda関数から同時に追加されても、1つのファイルを更新する場合のように追加した内容が失われる事が無い
+type S3PerceptualHashIndex struct {
+	S3Client   S3Client
+	BucketName string
+	// Prefix が空の場合は DefaultPerceptualHashPrefix を利用する
+	Prefix string
+}
+
+func (i *S3PerceptualHashIndex) FindSimilar(
+	ctx context.Context,
+	hash uint64,
+	maxDistance int,
+) ([]PerceptualHashMatch, error) {
+	hashes := map[string]uint64{}
+
+	// 一致するバンドが無い可能性がある場合は、全ての画像が含まれるバンド0のフォルダ全体を検索する
+	// 同じ画像が複数のバンドで見つかっても hashes はKey毎なので重複しない
+	prefixes := []string{i.prefix() + "0/"}
+	if maxDistance < perceptualHashBands {
+		prefixes = make([]string, 0, perceptualHashBands)
+		for band := 0; band < perceptualHashBands; band++ {
+			prefixes = append(prefixes, i.bandPrefix(band, hash))
+		}
+	}
+
+	for _, prefix := range prefixes {
+		if err := i.listHashes(ctx, prefix, hashes); err != nil {
+			return nil, err
+		}
+	}
+
+	return findSimilarPerceptualHashes(hashes, hash, maxDistance), nil
+}
+
+// Add は全てのバンドのフォルダに追加した後で、同じKeyで以前に追加した知覚ハッシュが異なる場合は削除する
+// 途中で失敗しても、画像毎の知覚ハッシュは最後に更新するので再実行すれば古い知覚ハッシュが削除される
+func (i *S3PerceptualHashIndex) Add(ctx context.Context, s3ObjectKey string, hash uint64) error {
+	previous, found, err := i.currentHash(ctx, s3ObjectKey)
+	if err != nil {
+		return err
+	}
+
+	for band := 0; band < perceptualHashBands; band++ {
+		input := &s3.PutObjectInput{
+			Bucket: aws.String(i.BucketName),
+			Key:    aws.String(i.entryKey(band, hash, s3ObjectKey)),
+			Body:   bytes.NewReader(nil),
+		}
+
+		if _, err := i.S3Client.PutObject(ctx, input); err != nil {
+			return errors.Wrap(err, "failed to S3Client.PutObject")
+		}
+	}
+
+	if found && previous != hash {
+		for band := 0; band < perceptualHashBands; band++ {
+			input := &s3.DeleteObjectInput{
+				Bucket: aws.String(i.BucketName),
+				Key:    aws.String(i.entryKey(band, previous, s3ObjectKey)),
+			}
+
+			if _, err := i.S3Client.DeleteObject(ctx, input); err != nil {
+				return errors.Wrap(err, "failed to S3Client.DeleteObject")
+			}
+		}
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(i.BucketName),
+		Key:    aws.String(i.prefix() + perceptualHashKeysFolder + s3ObjectKey),
+		Body:   strings.NewReader(fmt.Sprintf("%016x", hash)),
+	}
+
+	if _, err := i.S3Client.PutObject(ctx, input); err != nil {
+		return errors.Wrap(err, "failed to S3Client.PutObject")
+	}
+
+	return nil
+}
+
+// currentHash は画像毎に保存している現在の知覚ハッシュを返す、まだ追加されていない場合は false を返す
+func (i *S3PerceptualHashIndex) currentHash(ctx context.Context, s3ObjectKey string) (uint64, bool, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(i.BucketName),
+		Key:    aws.String(i.prefix() + perceptualHashKeysFolder + s3ObjectKey),
+	}
+
+	output, err := i.S3Client.GetObject(ctx, input)
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return 0, false, nil
+		}
+
+		return 0, false, errors.Wrap(err, "failed to S3Client.GetObject")
+	}
+	defer output.Body.Close()
+
+	b, err := io.ReadAll(output.Body)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed to read s3 object body")
+	}
+
+	hash, err := strconv.ParseUint(string(b), 16, 64)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed to strconv.ParseUint")
+	}
+
+	return hash, true, nil
+}
+
+// listHashes は prefix 配下の知覚ハッシュを全てのページを辿って hashes に追加する
+func (i *S3PerceptualHashIndex) listHashes(ctx context.Context, prefix string, hashes map[string]uint64) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(i.BucketName),
+		Prefix: aws.String(prefix),
+	}
+
+	for {
+		output, err := i.S3Client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return errors.Wrap(err, "failed to S3Client.ListObjectsV2")
+		}
+
+		for _, object := range output.Contents {
+			s3ObjectKey, h, ok := i.parseKey(aws.ToString(object.Key))
+			if ok {
+				hashes[s3ObjectKey] = h
+			}
+		}
+
+		if !output.IsTruncated {
+			return nil
+		}
+
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
+// bandPrefix は "Prefix/{バンド番号}/{バンドの値}/" を返す
+func (i *S3PerceptualHashIndex) bandPrefix(band int, hash uint64) string {
+	return fmt.Sprintf("%s%d/%02x/", i.prefix(), band, byte(hash>>(8*band)))
+}
+
+func (i *S3PerceptualHashIndex) entryKey(band int, hash uint64, s3ObjectKey string) string {
+	return fmt.Sprintf("%s%016x/%s", i.bandPrefix(band, hash), hash, s3ObjectKey)
+}
+
+// parseKey は "Prefix/{バンド番号}/{バンドの値}/{知覚ハッシュ}/{画像のKey}" から画像のKeyと知覚ハッシュを取り出す
+func (i *S3PerceptualHashIndex) parseKey(key string) (string, uint64, bool) {
+	// "{バンド番号}/{バンドの値}/" の5文字を読み飛ばす
+	const bandPrefixLength = 5
+
+	rest := strings.TrimPrefix(key, i.prefix())
+	if len(rest) <= bandPrefixLength+perceptualHashHexLength+1 {
+		return "", 0, false
+	}
+
+	rest = rest[bandPrefixLength:]
+	if rest[perceptualHashHexLength] != '/' {
+		return "", 0, false
+	}
+
+	hash, err := strconv.ParseUint(rest[:perceptualHashHexLength], 16, 64)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return rest[perceptualHashHexLength+1:], hash, true
+}
+
+func (i *S3PerceptualHashIndex) prefix() string {
+	if i.Prefix == "" {
+		return DefaultPerceptualHashPrefix
+	}
+
+	return i.Prefix
+}
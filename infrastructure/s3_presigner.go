@@ -0,0 +1,26 @@
+package infrastructure
+
+import (
+	"context"
+	"strconv"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type S3Presigner interface {
+	PresignPutObject(
+		ctx context.Context,
+		params *s3.PutObjectInput,
+		optFns ...func(*s3.PresignOptions),
+	) (*v4.PresignedHTTPRequest, error)
+}
+
+// WithPresignContentLength は署名付きURLの署名に Content-Length を含める
+// aws-sdk-go-v2 はボディの無いリクエストの Content-Length を0にしてしまい PutObjectInput.ContentLength が署名されないので、
+// シリアライズした後にヘッダーとして設定し直す
+func WithPresignContentLength(contentLength int64) func(*s3.PresignOptions) {
+	return func(o *s3.PresignOptions) {
+		o.ClientOptions = append(o.ClientOptions, withS3RequestHeader("Content-Length", strconv.FormatInt(contentLength, 10)))
+	}
+}
@@ -0,0 +1,74 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultRekognitionCachePrefix はキャッシュを保存するS3のフォルダ
+// tmp/ 配下に保存すると isacceptablecatimage が実行されてしまうので別のフォルダにする
+const DefaultRekognitionCachePrefix = "rekognition-cache/"
+
+// S3RekognitionCacheStore はS3オブジェクトとして保存する RekognitionCacheStore の実装
+// imagerecognition, isacceptablecatimage 等、複数のLambda関数でキャッシュを共有する為に利用する
+type S3RekognitionCacheStore struct {
+	S3Client   S3Client
+	BucketName string
+	// Prefix が空の場合は DefaultRekognitionCachePrefix を利用する
+	Prefix string
+}
+
+func (s *S3RekognitionCacheStore) Get(ctx context.Context, key string) ([]byte, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(s.key(key)),
+	}
+
+	output, err := s.S3Client.GetObject(ctx, input)
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrRekognitionCacheMiss
+		}
+
+		return nil, errors.Wrap(err, "failed to S3Client.GetObject")
+	}
+	defer output.Body.Close()
+
+	value, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read s3 object body")
+	}
+
+	return value, nil
+}
+
+func (s *S3RekognitionCacheStore) Set(ctx context.Context, key string, value []byte) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.BucketName),
+		Key:         aws.String(s.key(key)),
+		Body:        bytes.NewReader(value),
+		ContentType: aws.String("application/json"),
+	}
+
+	if _, err := s.S3Client.PutObject(ctx, input); err != nil {
+		return errors.Wrap(err, "failed to S3Client.PutObject")
+	}
+
+	return nil
+}
+
+func (s *S3RekognitionCacheStore) key(key string) string {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = DefaultRekognitionCachePrefix
+	}
+
+	return prefix + key + ".json"
+}
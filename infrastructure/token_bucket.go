@@ -0,0 +1,114 @@
+package infrastructure
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrRateLimitWait = errors.New("rate limit wait exceeds the context deadline")
+
+// TokenBucket は1秒間に Rate 個のトークンを補充し、最大 Burst 個まで貯められるトークンバケット
+// トークンが無い場合は補充されるまで待つので、APIの呼び出しを一定のTPS以下に抑えられる
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	// 以下は待った回数と待った時間の合計（ナノ秒）
+	waits     int64
+	waitNanos int64
+}
+
+// TokenBucketStats は TokenBucket.Wait で待った回数と待った時間の合計
+type TokenBucketStats struct {
+	Waits        int64
+	WaitDuration time.Duration
+}
+
+// NewTokenBucket は最初から Burst 個のトークンが貯まった状態の TokenBucket を作成する
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait はトークンを1つ取得する、トークンが無い場合は補充されるまで待つ
+// 補充される前に context の期限が来る事が分かっている場合は、待たずに ErrRateLimitWait を返す
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	wait := b.reserve()
+	if wait <= 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		b.cancel()
+
+		return errors.Wrap(ErrRateLimitWait, "wait "+wait.String())
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		b.cancel()
+
+		return errors.Wrap(ctx.Err(), "failed to wait for the rate limit")
+	case <-timer.C:
+	}
+
+	atomic.AddInt64(&b.waits, 1)
+	atomic.AddInt64(&b.waitNanos, int64(wait))
+
+	return nil
+}
+
+func (b *TokenBucket) Stats() TokenBucketStats {
+	return TokenBucketStats{
+		Waits:        atomic.LoadInt64(&b.waits),
+		WaitDuration: time.Duration(atomic.LoadInt64(&b.waitNanos)),
+	}
+}
+
+// reserve はトークンを1つ予約し、予約したトークンが使えるようになるまでの時間を返す
+// 並行して呼ばれても順番に待つように、トークンが足りない場合はマイナスにする
+func (b *TokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel は待つのをやめた場合に予約したトークンを戻す
+func (b *TokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens++
+}
@@ -0,0 +1,104 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/pkg/errors"
+)
+
+//nolint:funlen
+func TestTokenBucket(t *testing.T) {
+	t.Run("Successful wait until the token is refilled", func(t *testing.T) {
+		bucket := NewTokenBucket(20, 2)
+
+		start := time.Now()
+
+		for i := 0; i < 3; i++ {
+			if err := bucket.Wait(context.Background()); err != nil {
+				t.Fatal("Error failed to Wait", err)
+			}
+		}
+
+		// 3つ目のトークンは 1/20 秒後に補充される
+		const expectedWait = 40 * time.Millisecond
+
+		if elapsed := time.Since(start); elapsed < expectedWait {
+			t.Error("\nActually: ", elapsed, "\nExpected: ", ">= ", expectedWait)
+		}
+
+		stats := bucket.Stats()
+		if stats.Waits != 1 || stats.WaitDuration < expectedWait {
+			t.Error("\nActually: ", stats, "\nExpected: ", 1, ">= ", expectedWait)
+		}
+	})
+
+	t.Run("Failure do not wait beyond the context deadline", func(t *testing.T) {
+		bucket := NewTokenBucket(1, 1)
+
+		if err := bucket.Wait(context.Background()); err != nil {
+			t.Fatal("Error failed to Wait", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := bucket.Wait(ctx); !errors.Is(err, ErrRateLimitWait) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrRateLimitWait)
+		}
+
+		if stats := bucket.Stats(); stats.Waits != 0 {
+			t.Error("\nActually: ", stats, "\nExpected: ", 0)
+		}
+	})
+}
+
+func TestRateLimitedRekognitionClient(t *testing.T) {
+	t.Run("Successful limit only the configured operation", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		fake := &fakeRekognitionClient{}
+		client := &RateLimitedRekognitionClient{
+			Client:              fake,
+			DetectLabelsLimiter: NewTokenBucket(1, 1),
+			Metrics:             metrics.New(&buf, "TestNamespace", nil),
+		}
+
+		if _, err := client.DetectLabels(context.Background(), &rekognition.DetectLabelsInput{}); err != nil {
+			t.Fatal("Error failed to DetectLabels", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		// トークンが補充される前にタイムアウトするのでRekognitionは呼ばれない
+		if _, err := client.DetectLabels(ctx, &rekognition.DetectLabelsInput{}); !errors.Is(err, ErrRateLimitWait) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrRateLimitWait)
+		}
+
+		if fake.calls != 1 {
+			t.Error("\nActually: ", fake.calls, "\nExpected: ", 1)
+		}
+
+		if _, ok := client.Stats()["DetectFaces"]; ok || len(client.Stats()) != 1 {
+			t.Error("\nActually: ", client.Stats(), "\nExpected: ", "only DetectLabels")
+		}
+
+		// 待たずにタイムアウトした場合も含めて、呼び出し毎に待ち時間を出力する
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		for _, line := range lines {
+			if !strings.Contains(line, `"RekognitionRateLimitWait":`) || !strings.Contains(line, `"Operation":"DetectLabels"`) {
+				t.Error("\nActually: ", line, "\nExpected: ", "RekognitionRateLimitWait of DetectLabels")
+			}
+		}
+
+		if len(lines) != 2 {
+			t.Error("\nActually: ", len(lines), "\nExpected: ", 2)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TracingRekognitionClient はAPIの呼び出し毎に span を作成する RekognitionClient のデコレーター
+// キャッシュが使われた場合やリトライした場合も分かるように、NewFromEnv で作成するデコレーターの一番外側で包む
+type TracingRekognitionClient struct {
+	Client RekognitionClient
+}
+
+func (c *TracingRekognitionClient) DetectLabels(
+	ctx context.Context,
+	params *rekognition.DetectLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectLabelsOutput, error) {
+	ctx, span := tracing.Start(ctx, "Rekognition.DetectLabels", rekognitionImageAttributes(params.Image)...)
+	output, err := c.Client.DetectLabels(ctx, params, optFns...)
+	tracing.End(span, err)
+
+	return output, err
+}
+
+func (c *TracingRekognitionClient) DetectFaces(
+	ctx context.Context,
+	params *rekognition.DetectFacesInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectFacesOutput, error) {
+	ctx, span := tracing.Start(ctx, "Rekognition.DetectFaces", rekognitionImageAttributes(params.Image)...)
+	output, err := c.Client.DetectFaces(ctx, params, optFns...)
+	tracing.End(span, err)
+
+	return output, err
+}
+
+func (c *TracingRekognitionClient) DetectModerationLabels(
+	ctx context.Context,
+	params *rekognition.DetectModerationLabelsInput,
+	optFns ...func(*rekognition.Options),
+) (*rekognition.DetectModerationLabelsOutput, error) {
+	ctx, span := tracing.Start(ctx, "Rekognition.DetectModerationLabels", rekognitionImageAttributes(params.Image)...)
+	output, err := c.Client.DetectModerationLabels(ctx, params, optFns...)
+	tracing.End(span, err)
+
+	return output, err
+}
+
+// rekognitionImageAttributes は解析する画像のS3オブジェクト、または画像のサイズを span の属性にする
+// 画像そのものは属性に含めない
+func rekognitionImageAttributes(image *types.Image) []attribute.KeyValue {
+	if image == nil {
+		return nil
+	}
+
+	if image.S3Object != nil {
+		return tracing.S3ObjectAttributes(aws.ToString(image.S3Object.Bucket), aws.ToString(image.S3Object.Name))
+	}
+
+	return []attribute.KeyValue{attribute.Int("aws.rekognition.image_size", len(image.Bytes))}
+}
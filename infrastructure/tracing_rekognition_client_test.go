@@ -0,0 +1,51 @@
+package infrastructure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingRekognitionClient(t *testing.T) {
+	t.Run("Successful record the span of the failed request", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+		defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+		throttlingErr := &smithy.GenericAPIError{Code: "ThrottlingException"}
+		client := &TracingRekognitionClient{Client: &fakeRekognitionClient{errs: []error{throttlingErr}}}
+
+		params := &rekognition.DetectLabelsInput{
+			Image: &types.Image{
+				S3Object: &types.S3Object{Bucket: aws.String("trigger-bucket"), Name: aws.String("tmp/moko-cat.jpg")},
+			},
+		}
+
+		if _, err := client.DetectLabels(context.Background(), params); !errors.Is(err, throttlingErr) {
+			t.Error("\nActually: ", err, "\nExpected: ", throttlingErr)
+		}
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 || spans[0].Name != "Rekognition.DetectLabels" || spans[0].Status.Code != codes.Error {
+			t.Fatal("\nActually: ", spans, "\nExpected: ", "Rekognition.DetectLabels", codes.Error)
+		}
+
+		expected := attribute.String("aws.s3.key", "tmp/moko-cat.jpg")
+		for _, attr := range spans[0].Attributes {
+			if attr.Key == expected.Key && attr.Value != expected.Value {
+				t.Error("\nActually: ", attr, "\nExpected: ", expected)
+			}
+		}
+	})
+}
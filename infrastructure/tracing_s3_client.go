@@ -0,0 +1,146 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TracingS3Client はAPIの呼び出し毎に span を作成する S3Client のデコレーター
+type TracingS3Client struct {
+	Client S3Client
+}
+
+func (c *TracingS3Client) CopyObject(
+	ctx context.Context,
+	params *s3.CopyObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.CopyObjectOutput, error) {
+	attrs := tracing.S3ObjectAttributes(aws.ToString(params.Bucket), aws.ToString(params.Key))
+	if source := aws.ToString(params.CopySource); source != "" {
+		attrs = append(attrs, attribute.String("aws.s3.copy_source", source))
+	}
+
+	ctx, span := tracing.Start(ctx, "S3.CopyObject", attrs...)
+	output, err := c.Client.CopyObject(ctx, params, optFns...)
+	tracing.End(span, err)
+
+	return output, err
+}
+
+func (c *TracingS3Client) GetObject(
+	ctx context.Context,
+	params *s3.GetObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.GetObjectOutput, error) {
+	attrs := tracing.S3ObjectAttributes(aws.ToString(params.Bucket), aws.ToString(params.Key))
+
+	ctx, span := tracing.Start(ctx, "S3.GetObject", attrs...)
+	output, err := c.Client.GetObject(ctx, params, optFns...)
+	tracing.End(span, err)
+
+	return output, err
+}
+
+func (c *TracingS3Client) DeleteObject(
+	ctx context.Context,
+	params *s3.DeleteObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.DeleteObjectOutput, error) {
+	attrs := tracing.S3ObjectAttributes(aws.ToString(params.Bucket), aws.ToString(params.Key))
+
+	ctx, span := tracing.Start(ctx, "S3.DeleteObject", attrs...)
+	output, err := c.Client.DeleteObject(ctx, params, optFns...)
+	tracing.End(span, err)
+
+	return output, err
+}
+
+func (c *TracingS3Client) HeadObject(
+	ctx context.Context,
+	params *s3.HeadObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.HeadObjectOutput, error) {
+	attrs := tracing.S3ObjectAttributes(aws.ToString(params.Bucket), aws.ToString(params.Key))
+
+	ctx, span := tracing.Start(ctx, "S3.HeadObject", attrs...)
+	output, err := c.Client.HeadObject(ctx, params, optFns...)
+	tracing.End(span, err)
+
+	return output, err
+}
+
+func (c *TracingS3Client) ListObjectsV2(
+	ctx context.Context,
+	params *s3.ListObjectsV2Input,
+	optFns ...func(*s3.Options),
+) (*s3.ListObjectsV2Output, error) {
+	attrs := tracing.S3ObjectAttributes(aws.ToString(params.Bucket), "")
+	if prefix := aws.ToString(params.Prefix); prefix != "" {
+		attrs = append(attrs, attribute.String("aws.s3.prefix", prefix))
+	}
+
+	ctx, span := tracing.Start(ctx, "S3.ListObjectsV2", attrs...)
+	output, err := c.Client.ListObjectsV2(ctx, params, optFns...)
+	tracing.End(span, err)
+
+	return output, err
+}
+
+func (c *TracingS3Client) PutObject(
+	ctx context.Context,
+	params *s3.PutObjectInput,
+	optFns ...func(*s3.Options),
+) (*s3.PutObjectOutput, error) {
+	attrs := tracing.S3ObjectAttributes(aws.ToString(params.Bucket), aws.ToString(params.Key))
+
+	ctx, span := tracing.Start(ctx, "S3.PutObject", attrs...)
+	output, err := c.Client.PutObject(ctx, params, optFns...)
+	tracing.End(span, err)
+
+	return output, err
+}
+
+// TracingS3Uploader はアップロード毎に span を作成する S3Uploader のデコレーター
+type TracingS3Uploader struct {
+	Uploader S3Uploader
+}
+
+func (u *TracingS3Uploader) Upload(
+	ctx context.Context,
+	input *s3.PutObjectInput,
+	opts ...func(*manager.Uploader),
+) (*manager.UploadOutput, error) {
+	attrs := tracing.S3ObjectAttributes(aws.ToString(input.Bucket), aws.ToString(input.Key))
+
+	ctx, span := tracing.Start(ctx, "S3.Upload", attrs...)
+	output, err := u.Uploader.Upload(ctx, input, opts...)
+	tracing.End(span, err)
+
+	return output, err
+}
+
+// TracingS3Presigner は署名付きURLの作成毎に span を作成する S3Presigner のデコレーター
+// 署名はローカルで計算するのでS3へのリクエストは発生しないが、認証情報の取得に時間が掛かる場合がある
+type TracingS3Presigner struct {
+	Presigner S3Presigner
+}
+
+func (p *TracingS3Presigner) PresignPutObject(
+	ctx context.Context,
+	params *s3.PutObjectInput,
+	optFns ...func(*s3.PresignOptions),
+) (*v4.PresignedHTTPRequest, error) {
+	attrs := tracing.S3ObjectAttributes(aws.ToString(params.Bucket), aws.ToString(params.Key))
+
+	ctx, span := tracing.Start(ctx, "S3.PresignPutObject", attrs...)
+	output, err := p.Presigner.PresignPutObject(ctx, params, optFns...)
+	tracing.End(span, err)
+
+	return output, err
+}
@@ -0,0 +1,154 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeS3Uploader は err を返す S3Uploader
+type fakeS3Uploader struct {
+	err error
+}
+
+func (u *fakeS3Uploader) Upload(
+	ctx context.Context,
+	input *s3.PutObjectInput,
+	opts ...func(*manager.Uploader),
+) (*manager.UploadOutput, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+
+	return &manager.UploadOutput{}, nil
+}
+
+func newInMemoryExporter(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+
+	return exporter
+}
+
+func hasAttribute(span tracetest.SpanStub, expected attribute.KeyValue) bool {
+	for _, attr := range span.Attributes {
+		if attr == expected {
+			return true
+		}
+	}
+
+	return false
+}
+
+//nolint:funlen
+func TestTracingS3Client(t *testing.T) {
+	t.Run("Successful record the span of the request", func(t *testing.T) {
+		exporter := newInMemoryExporter(t)
+
+		client := &TracingS3Client{Client: &fakeListObjectsS3Client{}}
+
+		params := &s3.PutObjectInput{
+			Bucket: aws.String("trigger-bucket"),
+			Key:    aws.String("perceptual-hashes/keys/cat-images/moko-cat.jpg"),
+			Body:   bytes.NewReader(nil),
+		}
+
+		if _, err := client.PutObject(context.Background(), params); err != nil {
+			t.Fatal("Error failed to PutObject", err)
+		}
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 || spans[0].Name != "S3.PutObject" || spans[0].Status.Code == codes.Error {
+			t.Fatal("\nActually: ", spans, "\nExpected: ", "S3.PutObject")
+		}
+
+		expected := attribute.String("aws.s3.key", "perceptual-hashes/keys/cat-images/moko-cat.jpg")
+		if !hasAttribute(spans[0], expected) {
+			t.Error("\nActually: ", spans[0].Attributes, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful record the span of the failed request", func(t *testing.T) {
+		exporter := newInMemoryExporter(t)
+
+		client := &TracingS3Client{Client: &fakeListObjectsS3Client{}}
+
+		params := &s3.GetObjectInput{Bucket: aws.String("trigger-bucket"), Key: aws.String("tmp/not-found.jpg")}
+
+		var noSuchKey *s3types.NoSuchKey
+		if _, err := client.GetObject(context.Background(), params); !errors.As(err, &noSuchKey) {
+			t.Error("\nActually: ", err, "\nExpected: ", "NoSuchKey")
+		}
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 || spans[0].Name != "S3.GetObject" || spans[0].Status.Code != codes.Error {
+			t.Fatal("\nActually: ", spans, "\nExpected: ", "S3.GetObject", codes.Error)
+		}
+	})
+
+	t.Run("Successful record the span of the failed upload", func(t *testing.T) {
+		exporter := newInMemoryExporter(t)
+
+		uploadErr := errors.New("upload failed")
+		uploader := &TracingS3Uploader{Uploader: &fakeS3Uploader{err: uploadErr}}
+
+		params := &s3.PutObjectInput{Bucket: aws.String("trigger-bucket"), Key: aws.String("tmp/moko-cat.jpg")}
+
+		if _, err := uploader.Upload(context.Background(), params); !errors.Is(err, uploadErr) {
+			t.Error("\nActually: ", err, "\nExpected: ", uploadErr)
+		}
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 || spans[0].Name != "S3.Upload" || spans[0].Status.Code != codes.Error {
+			t.Fatal("\nActually: ", spans, "\nExpected: ", "S3.Upload", codes.Error)
+		}
+
+		expected := attribute.String("aws.s3.bucket", "trigger-bucket")
+		if !hasAttribute(spans[0], expected) {
+			t.Error("\nActually: ", spans[0].Attributes, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful record the span of the presign", func(t *testing.T) {
+		exporter := newInMemoryExporter(t)
+
+		presigner := &TracingS3Presigner{
+			Presigner: s3.NewPresignClient(s3.New(s3.Options{
+				Region:      "ap-northeast-1",
+				Credentials: credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "SECRET", ""),
+			})),
+		}
+
+		params := &s3.PutObjectInput{Bucket: aws.String("trigger-bucket"), Key: aws.String("tmp/moko-cat.jpg")}
+
+		if _, err := presigner.PresignPutObject(context.Background(), params); err != nil {
+			t.Fatal("Error failed to PresignPutObject", err)
+		}
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 || spans[0].Name != "S3.PresignPutObject" || spans[0].Status.Code == codes.Error {
+			t.Fatal("\nActually: ", spans, "\nExpected: ", "S3.PresignPutObject")
+		}
+
+		expected := attribute.String("aws.s3.key", "tmp/moko-cat.jpg")
+		if !hasAttribute(spans[0], expected) {
+			t.Error("\nActually: ", spans[0].Attributes, "\nExpected: ", expected)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package infrastructure
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
+	"github.com/pkg/errors"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+const (
+	// WebhookSignatureHeader には "sha256=" に続けて HMAC-SHA256 の署名を16進数で設定する
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	// WebhookTimestampHeader には署名したUNIX時間（秒）を設定する、受信側はリプレイ攻撃対策として古いリクエストを拒否出来る
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+
+	DefaultWebhookTimeout        = 3 * time.Second
+	DefaultWebhookMaxAttempts    = 3
+	DefaultWebhookInitialBackoff = 200 * time.Millisecond
+	DefaultWebhookMaxBackoff     = 2 * time.Second
+)
+
+var ErrWebhookDelivery = errors.New("failed to deliver webhook")
+
+type WebhookSender interface {
+	Send(ctx context.Context, url string, body []byte) error
+}
+
+// HttpWebhookSender は署名付きのJSONをPOSTする WebhookSender の実装
+// ネットワークエラー、429、5xx の場合のみ指数バックオフでリトライする、それ以外の4xxは何度送っても結果が変わらないのでリトライしない
+type HttpWebhookSender struct {
+	// Client が設定されていない場合は DefaultWebhookTimeout をタイムアウトにした http.Client を利用する
+	Client *http.Client
+	Secret string
+	// 以下が設定されていない場合は DefaultWebhook〇〇 を利用する
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Now はテストで時刻を固定する為に利用する、設定されていない場合は time.Now を利用する
+	Now func() time.Time
+}
+
+// SignWebhookPayload は "{timestamp}.{body}" の HMAC-SHA256 を16進数で返す
+// 受信側は同じ方法で計算した値と WebhookSignatureHeader の値を hmac.Equal で比較する
+func SignWebhookPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send はリトライを含めた全体を "Webhook.Send"、1回分のリクエストを "Webhook.POST" という span にする
+func (s *HttpWebhookSender) Send(ctx context.Context, url string, body []byte) error {
+	ctx, span := tracing.Start(ctx, "Webhook.Send")
+	err := s.send(ctx, url, body)
+	tracing.End(span, err)
+
+	return err
+}
+
+func (s *HttpWebhookSender) send(ctx context.Context, url string, body []byte) error {
+	backoff := s.initialBackoff()
+
+	var lastErr error
+
+	for attempt := 1; attempt <= s.maxAttempts(); attempt++ {
+		retryable, err := s.post(ctx, url, body)
+		if err == nil {
+			return nil
+		}
+
+		lastErr = err
+
+		if !retryable || attempt == s.maxAttempts() {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ErrWebhookDelivery, ctx.Err().Error())
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.maxBackoff() {
+			backoff = s.maxBackoff()
+		}
+	}
+
+	return errors.Wrap(ErrWebhookDelivery, lastErr.Error())
+}
+
+// post は1回分のリクエストを送る、戻り値の bool はリトライすべきエラーかどうか
+// URLのパスやクエリにはトークンが含まれる事があるので、span にはホストだけを記録する
+func (s *HttpWebhookSender) post(ctx context.Context, url string, body []byte) (retryable bool, err error) {
+	ctx, span := tracing.Start(ctx, "Webhook.POST", semconv.HTTPMethodKey.String(http.MethodPost))
+	defer func() { tracing.End(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to http.NewRequestWithContext")
+	}
+
+	span.SetAttributes(semconv.HTTPHostKey.String(req.URL.Host))
+
+	// リトライの度に署名し直すので、受信側でタイムスタンプを検証してもリトライが拒否される事は無い
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(s.Secret, timestamp, body))
+
+	res, err := s.client().Do(req)
+	if err != nil {
+		return ctx.Err() == nil, errors.Wrap(err, "failed to http.Client.Do")
+	}
+	defer res.Body.Close()
+
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(res.StatusCode))
+
+	// コネクションを再利用する為にレスポンスボディは読み捨てる
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusMultipleChoices {
+		return false, nil
+	}
+
+	retryable = res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+
+	return retryable, errors.New("unexpected status code " + strconv.Itoa(res.StatusCode) + " from " + url)
+}
+
+func (s *HttpWebhookSender) client() *http.Client {
+	if s.Client == nil {
+		return &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+
+	return s.Client
+}
+
+func (s *HttpWebhookSender) maxAttempts() int {
+	if s.MaxAttempts <= 0 {
+		return DefaultWebhookMaxAttempts
+	}
+
+	return s.MaxAttempts
+}
+
+func (s *HttpWebhookSender) initialBackoff() time.Duration {
+	if s.InitialBackoff <= 0 {
+		return DefaultWebhookInitialBackoff
+	}
+
+	return s.InitialBackoff
+}
+
+func (s *HttpWebhookSender) maxBackoff() time.Duration {
+	if s.MaxBackoff <= 0 {
+		return DefaultWebhookMaxBackoff
+	}
+
+	return s.MaxBackoff
+}
+
+func (s *HttpWebhookSender) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+
+	return s.Now()
+}
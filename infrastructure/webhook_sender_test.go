@@ -0,0 +1,197 @@
+package infrastructure
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+//nolint:funlen
+func TestHttpWebhookSender(t *testing.T) {
+	const secret = "test-secret"
+
+	body := []byte(`{"imageId":"aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa","decision":"accepted"}`)
+	now := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	newSender := func() *HttpWebhookSender {
+		return &HttpWebhookSender{
+			Secret:         secret,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+			Now:            func() time.Time { return now },
+		}
+	}
+
+	t.Run("Successful send a signed request", func(t *testing.T) {
+		var (
+			receivedBody      []byte
+			receivedSignature string
+			receivedTimestamp string
+		)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			receivedBody, _ = io.ReadAll(r.Body)
+			receivedSignature = r.Header.Get(WebhookSignatureHeader)
+			receivedTimestamp = r.Header.Get(WebhookTimestampHeader)
+
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		if err := newSender().Send(context.Background(), server.URL, body); err != nil {
+			t.Fatal("Error failed to Send", err)
+		}
+
+		if string(receivedBody) != string(body) {
+			t.Error("\nActually: ", string(receivedBody), "\nExpected: ", string(body))
+		}
+
+		expectedTimestamp := "1635724800"
+		if receivedTimestamp != expectedTimestamp {
+			t.Error("\nActually: ", receivedTimestamp, "\nExpected: ", expectedTimestamp)
+		}
+
+		expectedSignature := "sha256=" + SignWebhookPayload(secret, expectedTimestamp, body)
+		if receivedSignature != expectedSignature {
+			t.Error("\nActually: ", receivedSignature, "\nExpected: ", expectedSignature)
+		}
+	})
+
+	t.Run("Successful retry when the server returns 5xx", func(t *testing.T) {
+		var count int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&count, 1) < DefaultWebhookMaxAttempts {
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		if err := newSender().Send(context.Background(), server.URL, body); err != nil {
+			t.Fatal("Error failed to Send", err)
+		}
+
+		if atomic.LoadInt32(&count) != DefaultWebhookMaxAttempts {
+			t.Error("\nActually: ", count, "\nExpected: ", DefaultWebhookMaxAttempts)
+		}
+	})
+
+	t.Run("Failure retries are exhausted", func(t *testing.T) {
+		var count int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&count, 1)
+
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		sender := newSender()
+		sender.MaxAttempts = 2
+
+		err := sender.Send(context.Background(), server.URL, body)
+		if !errors.Is(err, ErrWebhookDelivery) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrWebhookDelivery)
+		}
+
+		if atomic.LoadInt32(&count) != 2 {
+			t.Error("\nActually: ", count, "\nExpected: ", 2)
+		}
+	})
+
+	t.Run("Failure do not retry when the server returns 4xx", func(t *testing.T) {
+		var count int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&count, 1)
+
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		err := newSender().Send(context.Background(), server.URL, body)
+		if !errors.Is(err, ErrWebhookDelivery) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrWebhookDelivery)
+		}
+
+		if atomic.LoadInt32(&count) != 1 {
+			t.Error("\nActually: ", count, "\nExpected: ", 1)
+		}
+	})
+
+	t.Run("Failure the server does not respond within the timeout", func(t *testing.T) {
+		done := make(chan struct{})
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-done:
+			case <-r.Context().Done():
+			}
+		}))
+		defer server.Close()
+		defer close(done)
+
+		sender := newSender()
+		sender.Client = &http.Client{Timeout: 10 * time.Millisecond}
+		sender.MaxAttempts = 1
+
+		err := sender.Send(context.Background(), server.URL, body)
+		if !errors.Is(err, ErrWebhookDelivery) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrWebhookDelivery)
+		}
+	})
+	t.Run("Successful record the spans of each attempt", func(t *testing.T) {
+		exporter := newInMemoryExporter(t)
+
+		var count int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&count, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		if err := newSender().Send(context.Background(), server.URL+"/hooks/secret-token", body); err != nil {
+			t.Fatal("Error failed to Send", err)
+		}
+
+		spans := exporter.GetSpans()
+		if len(spans) != 3 || spans[0].Name != "Webhook.POST" || spans[2].Name != "Webhook.Send" {
+			t.Fatal("\nActually: ", spans, "\nExpected: ", "Webhook.POST", "Webhook.POST", "Webhook.Send")
+		}
+
+		if spans[0].Status.Code != codes.Error || spans[1].Status.Code == codes.Error {
+			t.Error("\nActually: ", spans[0].Status, spans[1].Status, "\nExpected: ", codes.Error, codes.Unset)
+		}
+
+		expected := []attribute.KeyValue{
+			semconv.HTTPHostKey.String(strings.TrimPrefix(server.URL, "http://")),
+			semconv.HTTPStatusCodeKey.Int(http.StatusServiceUnavailable),
+		}
+
+		for _, attr := range expected {
+			if !hasAttribute(spans[0], attr) {
+				t.Error("\nActually: ", spans[0].Attributes, "\nExpected: ", attr)
+			}
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package catimageevent
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/imageprocessing"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/internal/rekognitionclient"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/catimage"
+	"github.com/pkg/errors"
+)
+
+// NewProcessorFromEnv は環境変数の設定から Processor を作成する
+// isacceptablecatimage（S3イベント）、isacceptablecatimagesqs（SQS経由のS3イベント）で同じ設定を利用する
+func NewProcessorFromEnv(ctx context.Context, logger *logging.Logger, recorder *metrics.Recorder) (*Processor, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(os.Getenv("REGION")))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to config.LoadDefaultConfig")
+	}
+
+	s3Client := &infrastructure.TracingS3Client{Client: s3.NewFromConfig(cfg)}
+
+	rekognitionClient, err := rekognitionclient.NewFromEnv(cfg, logger, recorder)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to rekognitionclient.NewFromEnv")
+	}
+
+	policy := catimage.DefaultPolicy()
+	if policyPath := os.Getenv("CAT_IMAGE_POLICY_PATH"); policyPath != "" {
+		policy, err = catimage.LoadPolicy(policyPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to catimage.LoadPolicy")
+		}
+	}
+
+	cropOptions, err := LoadCropOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	idempotencyStore, err := newIdempotencyStore(s3Client)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency, err := loadConcurrency()
+	if err != nil {
+		return nil, err
+	}
+
+	webhookUrls := LoadWebhookUrls()
+
+	webhookSecret, err := LoadWebhookSecret(webhookUrls)
+	if err != nil {
+		return nil, err
+	}
+
+	useCase := &catimage.UseCase{
+		S3Client:          s3Client,
+		RekognitionClient: rekognitionClient,
+		Policy:            policy,
+		ImageRecordRepository: &infrastructure.S3ImageRecordRepository{
+			S3Client:   s3Client,
+			BucketName: os.Getenv("TRIGGER_BUCKET_NAME"),
+		},
+		WebhookSender:            &infrastructure.HttpWebhookSender{Secret: webhookSecret},
+		WebhookUrls:              webhookUrls,
+		PendingNotificationStore: newPendingNotificationStore(s3Client),
+		PerceptualHashIndex: &infrastructure.S3PerceptualHashIndex{
+			S3Client:   s3Client,
+			BucketName: os.Getenv("TRIGGER_BUCKET_NAME"),
+		},
+		Logger:  logger,
+		Metrics: recorder,
+	}
+
+	return &Processor{
+		UseCase:          useCase,
+		IdempotencyStore: idempotencyStore,
+		CropOptions:      cropOptions,
+		Concurrency:      concurrency,
+		// アップロードした際にメタデータに保存したトレースコンテキストは、トレースを送信する場合のみ取り出す
+		PropagateTraceContext: tracing.IsConfigured(),
+	}, nil
+}
+
+// loadConcurrency は同時に処理するレコード数を環境変数 CAT_IMAGE_CONCURRENCY から読み込む
+// 指定されていない場合は DefaultConcurrency を利用する
+func loadConcurrency() (int, error) {
+	v := os.Getenv("CAT_IMAGE_CONCURRENCY")
+	if v == "" {
+		return DefaultConcurrency, nil
+	}
+
+	concurrency, err := strconv.Atoi(v)
+	if err != nil || concurrency < 1 {
+		return 0, errors.New("CAT_IMAGE_CONCURRENCY must be a positive integer")
+	}
+
+	return concurrency, nil
+}
+
+// newIdempotencyStore は処理済みのイベントの記録先を決める
+//   - IDEMPOTENCY_DIR が指定されている場合はファイル
+//   - Lambdaで実行されている場合はS3（異なる実行環境に配信された重複イベントも検出する為）
+//   - それ以外はメモリ
+func newIdempotencyStore(s3Client infrastructure.S3Client) (infrastructure.IdempotencyStore, error) {
+	if dir := os.Getenv("IDEMPOTENCY_DIR"); dir != "" {
+		store, err := infrastructure.NewFileIdempotencyStore(dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to infrastructure.NewFileIdempotencyStore")
+		}
+
+		return store, nil
+	}
+
+	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		return &infrastructure.S3IdempotencyStore{
+			S3Client:   s3Client,
+			BucketName: os.Getenv("TRIGGER_BUCKET_NAME"),
+			Prefix:     os.Getenv("IDEMPOTENCY_PREFIX"),
+		}, nil
+	}
+
+	return infrastructure.NewMemoryIdempotencyStore(), nil
+}
+
+// newPendingNotificationStore は通知に失敗した判定結果の保存先を決める
+// Lambdaで実行されている場合、再実行されたS3イベントは異なる実行環境に配信される事があるのでS3に保存する
+func newPendingNotificationStore(s3Client infrastructure.S3Client) infrastructure.PendingNotificationStore {
+	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		return &infrastructure.S3PendingNotificationStore{
+			S3Client:   s3Client,
+			BucketName: os.Getenv("TRIGGER_BUCKET_NAME"),
+			Prefix:     os.Getenv("PENDING_NOTIFICATION_PREFIX"),
+		}
+	}
+
+	return infrastructure.NewMemoryPendingNotificationStore()
+}
+
+// LoadWebhookUrls は判定結果を通知するURLをカンマ区切りの環境変数 WEBHOOK_URLS から読み込む
+func LoadWebhookUrls() []string {
+	var urls []string
+
+	for _, v := range strings.Split(os.Getenv("WEBHOOK_URLS"), ",") {
+		if url := strings.TrimSpace(v); url != "" {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls
+}
+
+// LoadWebhookSecret はWebhookの署名に利用する秘密鍵を環境変数 WEBHOOK_SECRET から読み込む
+// 空の秘密鍵で計算した署名は誰でも偽造出来るので、通知先が指定されている場合は必須にする
+func LoadWebhookSecret(webhookUrls []string) (string, error) {
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if len(webhookUrls) > 0 && secret == "" {
+		return "", errors.New("WEBHOOK_SECRET must be set when WEBHOOK_URLS is set")
+	}
+
+	return secret, nil
+}
+
+// LoadCropOptions は切り抜く範囲の設定を環境変数から読み込む
+// 指定されていない場合は BoundingBox の範囲をそのまま切り抜く
+func LoadCropOptions() (imageprocessing.CropOptions, error) {
+	var opts imageprocessing.CropOptions
+
+	if v := os.Getenv("CROP_PADDING"); v != "" {
+		padding, err := strconv.ParseFloat(v, 64)
+		if err != nil || padding < 0 {
+			return opts, errors.New("CROP_PADDING must be a non-negative number")
+		}
+
+		opts.Padding = padding
+	}
+
+	if v := os.Getenv("CROP_ASPECT_RATIO"); v != "" {
+		aspectRatio, err := strconv.ParseFloat(v, 64)
+		if err != nil || aspectRatio < 0 {
+			return opts, errors.New("CROP_ASPECT_RATIO must be a non-negative number")
+		}
+
+		opts.AspectRatio = aspectRatio
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,428 @@
+package catimageevent
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/imageprocessing"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/catimage"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// DefaultConcurrency は同時に処理するレコード数
+	// 大きくし過ぎるとRekognitionのTPSの上限に達するので注意が必要
+	DefaultConcurrency = 4
+	// DefaultDeadlineMargin はLambdaのタイムアウトまでの残り時間がこれより短い場合に、新たなレコードの処理を開始しない為の余裕
+	DefaultDeadlineMargin = 5 * time.Second
+	// DefaultNotifyTimeout は1件のレコードの判定結果を全てのWebhookに通知するのにかけられる時間
+	DefaultNotifyTimeout = 10 * time.Second
+	// notifyDeadlineMargin は通知の後に処理済みの記録を行う為に、Lambdaのタイムアウトまでに残しておく時間
+	notifyDeadlineMargin = time.Second
+	// idempotencyLeaseMargin はLambdaのタイムアウトより少し後までリースを延ばして、Lambda間の時刻のずれを吸収する為の時間
+	idempotencyLeaseMargin = 10 * time.Second
+)
+
+var ErrInsufficientTime = errors.New("not enough time left before the deadline")
+
+// Processor はS3イベントのレコード1件毎に catimage.UseCase で受け入れ可能なねこ画像かどうかを判定する
+// S3から直接起動される場合、SQS経由で起動される場合の共通の処理
+type Processor struct {
+	UseCase *catimage.UseCase
+	// IdempotencyStore はS3イベントの重複配信で同じ画像を2回以上判定しないようにする為に利用する
+	IdempotencyStore infrastructure.IdempotencyStore
+	CropOptions      imageprocessing.CropOptions
+	// Concurrency が設定されていない場合は DefaultConcurrency を利用する
+	Concurrency int
+	// DeadlineMargin が設定されていない場合は DefaultDeadlineMargin を利用する
+	DeadlineMargin time.Duration
+	// NotifyTimeout が設定されていない場合は DefaultNotifyTimeout を利用する
+	NotifyTimeout time.Duration
+	// PropagateTraceContext が true の場合は、S3オブジェクトのメタデータからアップロードした際のトレースを引き継ぐ
+	// メタデータはS3イベントに含まれないので、レコード毎に HeadObject を呼び出す
+	PropagateTraceContext bool
+}
+
+// ProcessRecords は1件のレコードの処理に失敗しても残りのレコードを処理し、レコード毎の処理結果を返す
+// 最大 Concurrency 件のレコードを並行して処理するが、処理結果は完了した順番に関係なく records と同じ順番で返す
+// context がキャンセルされた場合やLambdaのタイムアウトが近い場合は、未処理のレコードを開始せずに失敗として返す
+func (p *Processor) ProcessRecords(ctx context.Context, records []events.S3EventRecord) []RecordResult {
+	results := make([]RecordResult, len(records))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < p.concurrency(len(records)); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for index := range indexes {
+				outcome, err := p.processRecord(ctx, records[index])
+				results[index] = newRecordResult(records[index], outcome, err)
+			}
+		}()
+	}
+
+	for index, record := range records {
+		if err := p.checkDeadline(ctx); err != nil {
+			results[index] = newRecordResult(record, RecordOutcomeFailed, err)
+
+			continue
+		}
+
+		select {
+		case indexes <- index:
+		case <-ctx.Done():
+			results[index] = newRecordResult(record, RecordOutcomeFailed, errors.Wrap(ctx.Err(), "record is not started"))
+		}
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+func newRecordResult(record events.S3EventRecord, outcome RecordOutcome, err error) RecordResult {
+	result := RecordResult{
+		BucketName: record.S3.Bucket.Name,
+		Key:        record.S3.Object.Key,
+		VersionId:  record.S3.Object.VersionID,
+		Outcome:    outcome,
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// checkDeadline は新たにレコードの処理を開始しても良いかを判定する
+// 処理の途中でタイムアウトすると処理中の記録が残ってしまい、リースの期限が切れるまで再実行されても処理出来なくなる
+func (p *Processor) checkDeadline(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "record is not started")
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < p.deadlineMargin() {
+		return errors.Wrap(ErrInsufficientTime, "record is not started")
+	}
+
+	return nil
+}
+
+func (p *Processor) concurrency(recordCount int) int {
+	concurrency := p.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	if concurrency > recordCount {
+		return recordCount
+	}
+
+	return concurrency
+}
+
+// notifyTimeout は NotifyTimeout とLambdaのタイムアウトまでの残り時間の短い方を返す
+func (p *Processor) notifyTimeout(ctx context.Context) time.Duration {
+	timeout := p.NotifyTimeout
+	if timeout <= 0 {
+		timeout = DefaultNotifyTimeout
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline) - notifyDeadlineMargin; remaining < timeout {
+			return remaining
+		}
+	}
+
+	return timeout
+}
+
+// leaseDuration はLambdaのタイムアウトまでの残り時間に idempotencyLeaseMargin を加えた時間を返す
+// レコードの処理がLambdaのタイムアウトを超えて続く事は無いので、処理中に他のプロセスにリースを引き継がれる事が無い
+// タイムアウトが設定されていない場合（ローカルサーバー等）は DefaultIdempotencyLeaseDuration を返す
+func (p *Processor) leaseDuration(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline) + idempotencyLeaseMargin
+	}
+
+	return infrastructure.DefaultIdempotencyLeaseDuration
+}
+
+func (p *Processor) deadlineMargin() time.Duration {
+	if p.DeadlineMargin <= 0 {
+		return DefaultDeadlineMargin
+	}
+
+	return p.DeadlineMargin
+}
+
+// processRecord は重複して配信されたイベントを除いてレコード1件分を処理する
+func (p *Processor) processRecord(ctx context.Context, record events.S3EventRecord) (outcome RecordOutcome, err error) {
+	// このレコードの処理中に出力されるログは、どの画像のログなのか分かるようにする
+	ctx = logging.WithFields(ctx, logging.Fields{
+		"s3BucketName": record.S3.Bucket.Name,
+		"s3ObjectKey":  record.S3.Object.Key,
+		"s3VersionId":  record.S3.Object.VersionID,
+		"imageId":      infrastructure.ImageIdFromS3ObjectKey(record.S3.Object.Key),
+	})
+
+	ctx, span := tracing.Start(
+		p.extractTraceContext(ctx, record),
+		"catimageevent.Processor.ProcessRecord",
+		tracing.S3ObjectAttributes(record.S3.Bucket.Name, record.S3.Object.Key)...,
+	)
+	defer func() {
+		span.SetAttributes(attribute.String("outcome", string(outcome)))
+		tracing.End(span, err)
+	}()
+
+	idempotencyKey := infrastructure.S3EventIdempotencyKey(
+		record.S3.Bucket.Name,
+		record.S3.Object.Key,
+		record.S3.Object.VersionID,
+		record.S3.Object.Sequencer,
+	)
+
+	// S3イベントは同じイベントが2回以上配信される事があるので、処理済み、処理中のイベントはRekognitionを呼ばずにスキップする
+	err = p.IdempotencyStore.Acquire(ctx, idempotencyKey, p.leaseDuration(ctx))
+	if errors.Is(err, infrastructure.ErrAlreadyProcessed) {
+		// 判定済みでも通知に失敗していた場合は、判定をやり直さずに通知だけを再送する
+		if err := p.UseCase.RedeliverPendingNotification(ctx, &catimage.RedeliverPendingNotificationRequest{
+			TargetS3ObjectKey: record.S3.Object.Key,
+			Timeout:           p.notifyTimeout(ctx),
+		}); err != nil {
+			return RecordOutcomeFailed, err
+		}
+
+		return RecordOutcomeSkipped, nil
+	}
+
+	if errors.Is(err, infrastructure.ErrProcessingInProgress) {
+		return RecordOutcomeSkipped, nil
+	}
+
+	if err != nil {
+		return RecordOutcomeFailed, err
+	}
+
+	outcome, err = p.handleRecord(ctx, record)
+	if errors.Is(err, catimage.ErrNotifyDecision) {
+		// 判定結果は保存済みなので処理済みとして記録し、再実行された際は通知だけを再送させる
+		if err := p.IdempotencyStore.Complete(ctx, idempotencyKey); err != nil {
+			p.UseCase.Logger.Error(ctx, "failed to complete the idempotency key", err)
+		}
+
+		return RecordOutcomeFailed, err
+	}
+
+	if err != nil {
+		// 再実行された際に処理出来るように処理中の記録を削除する
+		if releaseErr := p.IdempotencyStore.Release(ctx, idempotencyKey); releaseErr != nil {
+			p.UseCase.Logger.Error(ctx, "failed to release the idempotency key", releaseErr)
+		}
+
+		// 処理状況の更新に失敗しても元のエラーでS3イベントを再実行させたいので、ログを出すだけにする
+		if updateErr := p.UseCase.UpdateImageRecord(ctx, &catimage.UpdateImageRecordRequest{
+			TargetS3ObjectKey: record.S3.Object.Key,
+			Status:            infrastructure.ImageRecordStatusFailed,
+			Err:               err,
+		}); updateErr != nil {
+			p.UseCase.Logger.Error(ctx, "failed to update the image record", updateErr)
+		}
+
+		return RecordOutcomeFailed, err
+	}
+
+	// 判定結果は保存済みなので、記録に失敗してもエラーにはしない（エラーにすると判定からやり直しになる）
+	if err := p.IdempotencyStore.Complete(ctx, idempotencyKey); err != nil {
+		p.UseCase.Logger.Error(ctx, "failed to complete the idempotency key", err)
+	}
+
+	return outcome, nil
+}
+
+// extractTraceContext はS3オブジェクトのメタデータにトレースコンテキストが保存されている場合、それを引き継いだ context を返す
+// 取得に失敗してもレコードの処理は続けたいので、ログを出して ctx をそのまま返す
+func (p *Processor) extractTraceContext(ctx context.Context, record events.S3EventRecord) context.Context {
+	if !p.PropagateTraceContext {
+		return ctx
+	}
+
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(record.S3.Bucket.Name),
+		Key:    aws.String(record.S3.Object.Key),
+	}
+
+	if record.S3.Object.VersionID != "" {
+		input.VersionId = aws.String(record.S3.Object.VersionID)
+	}
+
+	output, err := p.UseCase.S3Client.HeadObject(ctx, input)
+	if err != nil {
+		p.UseCase.Logger.Warn(ctx, "failed to extract the trace context", logging.Fields{"error": err.Error()})
+
+		return ctx
+	}
+
+	return tracing.ExtractS3Metadata(ctx, output.Metadata)
+}
+
+func (p *Processor) handleRecord(ctx context.Context, record events.S3EventRecord) (RecordOutcome, error) {
+	// recordの中にイベント発生させたS3のBucket名やKeyが入っている
+	acceptableCatImageRequest := &catimage.Request{
+		TargetS3BucketName:      record.S3.Bucket.Name,
+		TargetS3ObjectKey:       record.S3.Object.Key,
+		TargetS3ObjectVersionId: record.S3.Object.VersionID,
+	}
+
+	err := p.UseCase.UpdateImageRecord(ctx, &catimage.UpdateImageRecordRequest{
+		TargetS3ObjectKey: acceptableCatImageRequest.TargetS3ObjectKey,
+		Status:            infrastructure.ImageRecordStatusEvaluating,
+	})
+	if err != nil {
+		return RecordOutcomeFailed, err
+	}
+
+	// ねこ画像かどうかを判定する
+	isAcceptableCatImageResponse, err := p.UseCase.IsAcceptableCatImage(ctx, acceptableCatImageRequest)
+	if err != nil {
+		// 拡張子が不正等、画像そのものに問題がある場合は何度実行しても結果は変わらないので受け入れ不可として扱う
+		rejectionReason, ok := catimage.RejectionReasonFromError(err)
+		if !ok {
+			return RecordOutcomeFailed, err
+		}
+
+		isAcceptableCatImageResponse = &catimage.IsAcceptableCatImageResponse{
+			RejectionReasons: []catimage.RejectionReason{rejectionReason},
+		}
+	}
+
+	// 受け入れ可能なねこ画像ではない場合、理由を付けて隔離用の場所に移動して処理を中断する
+	// 隔離すると tmp/ の画像が削除されて再実行しても判定出来なくなるので、判定結果を先に記録する
+	if !isAcceptableCatImageResponse.IsAcceptableCatImage {
+		err = p.UseCase.UpdateImageRecord(ctx, &catimage.UpdateImageRecordRequest{
+			TargetS3ObjectKey: acceptableCatImageRequest.TargetS3ObjectKey,
+			Status:            infrastructure.ImageRecordStatusRejected,
+			Response:          isAcceptableCatImageResponse,
+		})
+		if err != nil {
+			return RecordOutcomeFailed, err
+		}
+
+		err = p.UseCase.QuarantineRejectedImage(ctx, createQuarantineRejectedImageRequest(
+			acceptableCatImageRequest.TargetS3ObjectKey,
+			isAcceptableCatImageResponse.RejectionReasons,
+		))
+		if err != nil {
+			return RecordOutcomeFailed, err
+		}
+
+		err = p.notifyDecision(ctx, acceptableCatImageRequest.TargetS3ObjectKey, isAcceptableCatImageResponse)
+
+		return RecordOutcomeRejected, err
+	}
+
+	copyCatImageRequest := &catimage.CopyCatImageToDestinationBucketRequest{
+		// TriggerBucketName, DestinationBucketNameに同じ値が設定されているが、同じバケットの異なるディレクトリを使っているから
+		// 実運用の際は別のバケットを指定したほうが良い
+		TriggerBucketName:     os.Getenv("TRIGGER_BUCKET_NAME"),
+		DestinationBucketName: os.Getenv("TRIGGER_BUCKET_NAME"),
+		TargetS3ObjectKey:     acceptableCatImageRequest.TargetS3ObjectKey,
+		PerceptualHash:        isAcceptableCatImageResponse.PerceptualHash,
+	}
+
+	// ここまで来るという事は受け入れ可能なねこ画像なので指定された場所にアップロードする
+	err = p.UseCase.CopyCatImageToDestinationBucket(ctx, copyCatImageRequest)
+	if err != nil {
+		return RecordOutcomeFailed, err
+	}
+
+	// "Cat" ラベルに Instances が含まれない場合は位置が分からないので切り抜いた画像は作成しない
+	if len(isAcceptableCatImageResponse.Cats) > 0 {
+		_, err = p.UseCase.CreateCroppedCatImage(ctx, &catimage.CreateCroppedCatImageRequest{
+			TriggerBucketName:       copyCatImageRequest.TriggerBucketName,
+			DestinationBucketName:   copyCatImageRequest.DestinationBucketName,
+			TargetS3ObjectKey:       acceptableCatImageRequest.TargetS3ObjectKey,
+			TargetS3ObjectVersionId: acceptableCatImageRequest.TargetS3ObjectVersionId,
+			Cats:                    isAcceptableCatImageResponse.Cats,
+			CropOptions:             p.CropOptions,
+		})
+		// 画素数が多過ぎてデコード出来ない画像は何度実行しても切り抜けないので、切り抜いた画像を作成せずに受け入れる
+		if errors.Is(err, imageprocessing.ErrTooManyPixels) {
+			p.UseCase.Logger.Warn(ctx, "skipped cropping the cat image", logging.Fields{"error": err.Error()})
+		} else if err != nil {
+			return RecordOutcomeFailed, err
+		}
+	}
+
+	err = p.UseCase.UpdateImageRecord(ctx, &catimage.UpdateImageRecordRequest{
+		TargetS3ObjectKey: acceptableCatImageRequest.TargetS3ObjectKey,
+		Status:            infrastructure.ImageRecordStatusAccepted,
+		Response:          isAcceptableCatImageResponse,
+	})
+	if err != nil {
+		return RecordOutcomeFailed, err
+	}
+
+	err = p.notifyDecision(ctx, acceptableCatImageRequest.TargetS3ObjectKey, isAcceptableCatImageResponse)
+
+	return RecordOutcomeAccepted, err
+}
+
+func createQuarantineRejectedImageRequest(
+	key string,
+	reasons []catimage.RejectionReason,
+) *catimage.QuarantineRejectedImageRequest {
+	// REJECTED_BUCKET_NAME が指定されていない場合はトリガーとなったバケットの REJECTED_PREFIX に移動する
+	quarantineBucketName := os.Getenv("REJECTED_BUCKET_NAME")
+	if quarantineBucketName == "" {
+		quarantineBucketName = os.Getenv("TRIGGER_BUCKET_NAME")
+	}
+
+	return &catimage.QuarantineRejectedImageRequest{
+		TriggerBucketName:    os.Getenv("TRIGGER_BUCKET_NAME"),
+		QuarantineBucketName: quarantineBucketName,
+		QuarantinePrefix:     os.Getenv("REJECTED_PREFIX"),
+		TargetS3ObjectKey:    key,
+		RejectionReasons:     reasons,
+	}
+}
+
+// notifyDecision は判定結果をWebhookで通知する
+// 判定結果はS3（cat-images/, 隔離用の場所）と ImageRecord に保存済みなので、判定からやり直さないように
+// PendingNotificationStore が設定されている場合だけ ErrNotifyDecision を返し、通知だけをS3イベントの再実行で再送させる
+// PendingNotificationStore が設定されていない場合は再送出来ないので、ログを出すだけにする
+// 通知先が応答しない場合にLambdaがタイムアウトしないように、リトライを含めて NotifyTimeout で打ち切る
+func (p *Processor) notifyDecision(ctx context.Context, key string, res *catimage.IsAcceptableCatImageResponse) error {
+	err := p.UseCase.NotifyDecision(ctx, &catimage.NotifyDecisionRequest{
+		TargetS3ObjectKey: key,
+		Response:          res,
+		Timeout:           p.notifyTimeout(ctx),
+	})
+	if err == nil {
+		return nil
+	}
+
+	if p.UseCase.PendingNotificationStore == nil {
+		p.UseCase.Logger.Error(ctx, "failed to notify the decision", err)
+
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,454 @@
+package catimageevent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/keitakn/aws-rekognition-sandbox/test"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
+	"github.com/keitakn/aws-rekognition-sandbox/usecase/catimage"
+)
+
+func newProcessor(mockS3Client *mock.MockS3Client, mockRekognitionClient *mock.MockRekognitionClient) *Processor {
+	return &Processor{
+		UseCase:          &catimage.UseCase{S3Client: mockS3Client, RekognitionClient: mockRekognitionClient},
+		IdempotencyStore: infrastructure.NewMemoryIdempotencyStore(),
+	}
+}
+
+// failOnceImageRecordRepository は Status の記録の保存に1回だけ失敗する
+type failOnceImageRecordRepository struct {
+	infrastructure.ImageRecordRepository
+	Status infrastructure.ImageRecordStatus
+	failed bool
+}
+
+func (r *failOnceImageRecordRepository) Save(ctx context.Context, record *infrastructure.ImageRecord) error {
+	if record.Status == r.Status && !r.failed {
+		r.failed = true
+
+		return errors.New("failed to save image record")
+	}
+
+	return r.ImageRecordRepository.Save(ctx, record)
+}
+
+func outcomes(results []RecordResult) []RecordOutcome {
+	res := make([]RecordOutcome, 0, len(results))
+	for _, result := range results {
+		res = append(res, result.Outcome)
+	}
+
+	return res
+}
+
+//nolint:funlen
+func TestProcessRecords(t *testing.T) {
+	const bucketName = "trigger-bucket"
+	const key = "tmp/abyssinian-cat.jpg"
+	const imgPath = "../../test/images/abyssinian-cat.jpg"
+
+	t.Run("Successful skip the duplicate deliveries of the same event", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		// 同じイベントが3回配信されても判定は1回だけ
+		test.ExpectAcceptableCatImage(t, mockS3Client, mockRekognitionClient, imgPath)
+
+		processor := newProcessor(mockS3Client, mockRekognitionClient)
+		// 並行して処理するとどちらが先に判定されるか決まらないので1件ずつ処理する
+		processor.Concurrency = 1
+
+		record := test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E5")
+
+		results := processor.ProcessRecords(ctx, []events.S3EventRecord{record, record})
+		results = append(results, processor.ProcessRecords(ctx, []events.S3EventRecord{record})...)
+
+		expected := []RecordOutcome{RecordOutcomeAccepted, RecordOutcomeSkipped, RecordOutcomeSkipped}
+		if reflect.DeepEqual(outcomes(results), expected) == false {
+			t.Error("\nActually: ", outcomes(results), "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful process the same key uploaded again", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		// 同じKeyでも sequencer が異なる場合は別のアップロードなので2回判定される
+		test.ExpectAcceptableCatImage(t, mockS3Client, mockRekognitionClient, imgPath)
+		test.ExpectAcceptableCatImage(t, mockS3Client, mockRekognitionClient, imgPath)
+
+		processor := newProcessor(mockS3Client, mockRekognitionClient)
+
+		results := processor.ProcessRecords(ctx, []events.S3EventRecord{
+			test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E5"),
+			test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E6"),
+		})
+
+		expected := []RecordOutcome{RecordOutcomeAccepted, RecordOutcomeAccepted}
+		if reflect.DeepEqual(outcomes(results), expected) == false {
+			t.Error("\nActually: ", outcomes(results), "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful process the event again after a failure", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		// 1回目はS3の障害で失敗、再実行された2回目で判定される
+		mockS3Client.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(nil, context.DeadlineExceeded)
+		test.ExpectAcceptableCatImage(t, mockS3Client, mockRekognitionClient, imgPath)
+
+		processor := newProcessor(mockS3Client, mockRekognitionClient)
+
+		records := []events.S3EventRecord{test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E5")}
+
+		results := processor.ProcessRecords(ctx, records)
+		results = append(results, processor.ProcessRecords(ctx, records)...)
+
+		expected := []RecordOutcome{RecordOutcomeFailed, RecordOutcomeAccepted}
+		if reflect.DeepEqual(outcomes(results), expected) == false {
+			t.Error("\nActually: ", outcomes(results), "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful process records concurrently up to Concurrency", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		const recordCount = 6
+		const concurrency = 3
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		var mu sync.Mutex
+		inFlight := 0
+		maxInFlight := 0
+
+		// 同時に処理されているレコードの数を数える為に、少し時間の掛かるS3の障害を発生させる
+		mockS3Client.EXPECT().GetObject(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+				mu.Lock()
+				inFlight++
+				if inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				mu.Unlock()
+
+				time.Sleep(50 * time.Millisecond)
+
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+
+				return nil, context.DeadlineExceeded
+			},
+		).Times(recordCount)
+
+		processor := newProcessor(mockS3Client, mockRekognitionClient)
+		processor.Concurrency = concurrency
+
+		records := make([]events.S3EventRecord, 0, recordCount)
+		for i := 0; i < recordCount; i++ {
+			records = append(records, test.NewS3EventRecord(bucketName, fmt.Sprintf("tmp/cat-%d.jpg", i), "0055AED6DCD90281E5"))
+		}
+
+		results := processor.ProcessRecords(ctx, records)
+
+		if maxInFlight < 2 || maxInFlight > concurrency {
+			t.Error("\nActually: ", maxInFlight, "\nExpected: ", "2 to ", concurrency)
+		}
+
+		// 処理が完了した順番に関係なく、結果はレコードと同じ順番で返される
+		for i, result := range results {
+			if result.Key != records[i].S3.Object.Key || result.Outcome != RecordOutcomeFailed {
+				t.Error("\nActually: ", result, "\nExpected: ", records[i].S3.Object.Key)
+			}
+		}
+	})
+
+	t.Run("Successful reject the image again after failing to record the decision", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		// 判定結果の記録に失敗した1回目は隔離しないので、再実行された2回目も tmp/ の画像を判定出来る
+		mockS3Client.EXPECT().CopyObject(gomock.Any(), gomock.Any()).Return(&s3.CopyObjectOutput{}, nil)
+		mockS3Client.EXPECT().DeleteObject(gomock.Any(), gomock.Any()).Return(&s3.DeleteObjectOutput{}, nil)
+
+		repository := &failOnceImageRecordRepository{
+			ImageRecordRepository: infrastructure.NewMemoryImageRecordRepository(),
+			Status:                infrastructure.ImageRecordStatusRejected,
+		}
+
+		processor := newProcessor(mockS3Client, mockRekognitionClient)
+		processor.UseCase.ImageRecordRepository = repository
+
+		// 拡張子が無いのでS3から画像を取得せずに受け入れ不可になる
+		const rejectedKey = "tmp/abyssinian-cat"
+
+		records := []events.S3EventRecord{test.NewS3EventRecord(bucketName, rejectedKey, "0055AED6DCD90281E5")}
+
+		results := processor.ProcessRecords(ctx, records)
+		results = append(results, processor.ProcessRecords(ctx, records)...)
+
+		expected := []RecordOutcome{RecordOutcomeFailed, RecordOutcomeRejected}
+		if reflect.DeepEqual(outcomes(results), expected) == false {
+			t.Error("\nActually: ", outcomes(results), "\nExpected: ", expected)
+		}
+
+		record, err := repository.FindById(ctx, "abyssinian-cat")
+		if err != nil {
+			t.Fatal("Error failed to FindById", err)
+		}
+
+		if record.Status != infrastructure.ImageRecordStatusRejected {
+			t.Error("\nActually: ", record.Status, "\nExpected: ", infrastructure.ImageRecordStatusRejected)
+		}
+	})
+
+	t.Run("Successful stop notifying the decision after NotifyTimeout", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockWebhookSender := mock.NewMockWebhookSender(ctrl)
+
+		test.ExpectAcceptableCatImage(t, mockS3Client, mockRekognitionClient, imgPath)
+
+		// 通知先が応答しないので、打ち切られるまで待ち続ける
+		mockWebhookSender.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, url string, body []byte) error {
+				<-ctx.Done()
+
+				return ctx.Err()
+			},
+		)
+
+		processor := newProcessor(mockS3Client, mockRekognitionClient)
+		processor.UseCase.WebhookSender = mockWebhookSender
+		processor.UseCase.WebhookUrls = []string{"https://example.com/webhooks/cat-images"}
+		processor.NotifyTimeout = 50 * time.Millisecond
+
+		start := time.Now()
+
+		results := processor.ProcessRecords(ctx, []events.S3EventRecord{
+			test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E5"),
+		})
+
+		// 再送出来ないので、通知に失敗しても受け入れ可能として扱う
+		expected := []RecordOutcome{RecordOutcomeAccepted}
+		if reflect.DeepEqual(outcomes(results), expected) == false {
+			t.Error("\nActually: ", outcomes(results), "\nExpected: ", expected)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Error("\nActually: ", elapsed, "\nExpected: ", "less than ", time.Second)
+		}
+	})
+
+	t.Run("Successful redeliver only the notification when the event is retried", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockWebhookSender := mock.NewMockWebhookSender(ctrl)
+
+		// 再実行されても判定は1回だけ
+		test.ExpectAcceptableCatImage(t, mockS3Client, mockRekognitionClient, imgPath)
+
+		gomock.InOrder(
+			mockWebhookSender.EXPECT().
+				Send(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(errors.New("failed webhookSender send")),
+			mockWebhookSender.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+		)
+
+		processor := newProcessor(mockS3Client, mockRekognitionClient)
+		processor.UseCase.WebhookSender = mockWebhookSender
+		processor.UseCase.WebhookUrls = []string{"https://example.com/webhooks/cat-images"}
+		processor.UseCase.PendingNotificationStore = infrastructure.NewMemoryPendingNotificationStore()
+
+		record := test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E5")
+
+		// 通知に失敗した場合は判定結果を失わないように、S3イベントを再実行させる
+		results := processor.ProcessRecords(ctx, []events.S3EventRecord{record})
+		results = append(results, processor.ProcessRecords(ctx, []events.S3EventRecord{record})...)
+		results = append(results, processor.ProcessRecords(ctx, []events.S3EventRecord{record})...)
+
+		expected := []RecordOutcome{RecordOutcomeFailed, RecordOutcomeSkipped, RecordOutcomeSkipped}
+		if reflect.DeepEqual(outcomes(results), expected) == false {
+			t.Error("\nActually: ", outcomes(results), "\nExpected: ", expected)
+		}
+
+		if !strings.Contains(results[0].Error, catimage.ErrNotifyDecision.Error()) {
+			t.Error("\nActually: ", results[0].Error, "\nExpected: ", catimage.ErrNotifyDecision)
+		}
+	})
+
+	t.Run("Successful hold the lease until the Lambda timeout", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		// 1分より長いタイムアウトのLambdaでも、処理中にリースの期限が切れないようにする
+		const timeout = 15 * time.Minute
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var leaseDuration time.Duration
+
+		mockIdempotencyStore := mock.NewMockIdempotencyStore(ctrl)
+		mockIdempotencyStore.EXPECT().
+			Acquire(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, d time.Duration) error {
+				leaseDuration = d
+
+				return infrastructure.ErrAlreadyProcessed
+			})
+
+		processor := newProcessor(mock.NewMockS3Client(ctrl), mock.NewMockRekognitionClient(ctrl))
+		processor.IdempotencyStore = mockIdempotencyStore
+
+		processor.ProcessRecords(ctx, []events.S3EventRecord{test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E5")})
+
+		if leaseDuration <= timeout-time.Minute || leaseDuration > timeout+idempotencyLeaseMargin {
+			t.Error("\nActually: ", leaseDuration, "\nExpected: ", timeout+idempotencyLeaseMargin)
+		}
+	})
+
+	t.Run("Failure records are not started when the deadline is near", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		// Lambdaのタイムアウトまでの残り時間が DeadlineMargin より短い
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		processor := newProcessor(mockS3Client, mockRekognitionClient)
+		processor.DeadlineMargin = 10 * time.Second
+
+		results := processor.ProcessRecords(ctx, []events.S3EventRecord{
+			test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E5"),
+			test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E6"),
+		})
+
+		for _, result := range results {
+			if result.Outcome != RecordOutcomeFailed || !strings.Contains(result.Error, ErrInsufficientTime.Error()) {
+				t.Error("\nActually: ", result, "\nExpected: ", ErrInsufficientTime)
+			}
+		}
+	})
+
+	t.Run("Failure records are not started when the context is canceled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		processor := newProcessor(mockS3Client, mockRekognitionClient)
+
+		results := processor.ProcessRecords(ctx, []events.S3EventRecord{
+			test.NewS3EventRecord(bucketName, key, "0055AED6DCD90281E5"),
+		})
+
+		expected := []RecordOutcome{RecordOutcomeFailed}
+		if reflect.DeepEqual(outcomes(results), expected) == false {
+			t.Error("\nActually: ", outcomes(results), "\nExpected: ", expected)
+		}
+	})
+}
+
+func TestProcessRecordsTraceContext(t *testing.T) {
+	t.Run("Successful continue the trace of the upload request", func(t *testing.T) {
+		exporter := test.SetInMemoryTracerProvider(t)
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		// imageRecognition でアップロードした際にメタデータに保存されるトレースコンテキスト
+		uploadCtx, uploadSpan := tracing.Start(context.Background(), "imageRecognition.Handler")
+		metadata := tracing.InjectS3Metadata(uploadCtx, nil)
+		uploadSpan.End()
+
+		mockS3Client.EXPECT().HeadObject(gomock.Any(), gomock.Any()).Return(&s3.HeadObjectOutput{Metadata: metadata}, nil)
+		test.ExpectAcceptableCatImage(t, mockS3Client, mockRekognitionClient, "../../test/images/abyssinian-cat.jpg")
+
+		processor := newProcessor(mockS3Client, mockRekognitionClient)
+		processor.PropagateTraceContext = true
+
+		results := processor.ProcessRecords(context.Background(), []events.S3EventRecord{
+			test.NewS3EventRecord("trigger-bucket", "tmp/abyssinian-cat.jpg", "0055AED6DCD90281E5"),
+		})
+
+		if expected := []RecordOutcome{RecordOutcomeAccepted}; reflect.DeepEqual(outcomes(results), expected) == false {
+			t.Fatal("\nActually: ", outcomes(results), "\nExpected: ", expected)
+		}
+
+		for _, span := range exporter.GetSpans() {
+			if span.SpanContext.TraceID() != uploadSpan.SpanContext().TraceID() {
+				t.Error("\nActually: ", span.Name, span.SpanContext.TraceID(), "\nExpected: ", uploadSpan.SpanContext().TraceID())
+			}
+		}
+
+		expected := []string{
+			"imageRecognition.Handler",
+			"catimage.UseCase.IsAcceptableCatImage",
+			"catimage.UseCase.CopyCatImageToDestinationBucket",
+			"catimageevent.Processor.ProcessRecord",
+		}
+
+		if names := test.SpanNames(exporter); reflect.DeepEqual(names, expected) == false {
+			t.Error("\nActually: ", names, "\nExpected: ", expected)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package catimageevent
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RecordOutcome はS3イベントのレコード1件分の処理結果
+type RecordOutcome string
+
+const (
+	RecordOutcomeAccepted RecordOutcome = "accepted"
+	RecordOutcomeRejected RecordOutcome = "rejected"
+	// RecordOutcomeSkipped は重複して配信されたイベントなので判定しなかった事を表す
+	RecordOutcomeSkipped RecordOutcome = "skipped"
+	RecordOutcomeFailed  RecordOutcome = "failed"
+)
+
+type RecordResult struct {
+	BucketName string        `json:"bucketName"`
+	Key        string        `json:"key"`
+	VersionId  string        `json:"versionId,omitempty"`
+	Outcome    RecordOutcome `json:"outcome"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// BatchError は処理に失敗したレコードだけをまとめたエラー
+// Lambdaのエラーメッセージとしてそのままログに出力されるので、どのレコードが失敗したのか分かるようにJSONで表す
+type BatchError struct {
+	Total    int            `json:"total"`
+	Failures []RecordResult `json:"failures"`
+}
+
+func (e *BatchError) Error() string {
+	failuresJson, _ := json.Marshal(e)
+
+	return fmt.Sprintf("failed to process %d of %d records: %s", len(e.Failures), e.Total, failuresJson)
+}
+
+// NewBatchError は失敗したレコードがある場合のみ BatchError を返す
+func NewBatchError(results []RecordResult) error {
+	batchErr := &BatchError{Total: len(results)}
+
+	for _, result := range results {
+		if result.Outcome == RecordOutcomeFailed {
+			batchErr.Failures = append(batchErr.Failures, result)
+		}
+	}
+
+	if len(batchErr.Failures) == 0 {
+		return nil
+	}
+
+	return batchErr
+}
@@ -0,0 +1,150 @@
+package rekognitionclient
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/pkg/errors"
+)
+
+// NewFromEnv は環境変数の設定から全てのLambda関数とローカルサーバーで共通の RekognitionClient を作成する
+// 外側から順にトレース、キャッシュ、リトライ、TPSの制限、メトリクスのデコレーターで aws-sdk-go-v2 のクライアントを包む
+// スロットリングされた場合は aws-sdk-go-v2 のリトライに加えてバックオフを長めに取ってリトライする
+// リトライも1回の呼び出しとしてTPSの制限に含めたいので、RetryingRekognitionClient の内側でTPSを制限する
+func NewFromEnv(
+	cfg aws.Config,
+	logger *logging.Logger,
+	recorder *metrics.Recorder,
+) (infrastructure.RekognitionClient, error) {
+	rateLimitedClient := &infrastructure.RateLimitedRekognitionClient{
+		Client: &infrastructure.MetricsRekognitionClient{
+			Client:  rekognition.NewFromConfig(cfg),
+			Metrics: recorder,
+		},
+		Metrics: recorder,
+	}
+
+	var err error
+
+	rateLimitedClient.DetectLabelsLimiter, err = loadTokenBucket("REKOGNITION_DETECT_LABELS_TPS")
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitedClient.DetectFacesLimiter, err = loadTokenBucket("REKOGNITION_DETECT_FACES_TPS")
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitedClient.DetectModerationLabelsLimiter, err = loadTokenBucket("REKOGNITION_DETECT_MODERATION_LABELS_TPS")
+	if err != nil {
+		return nil, err
+	}
+
+	var client infrastructure.RekognitionClient = &infrastructure.RetryingRekognitionClient{
+		Client:  rateLimitedClient,
+		Logger:  logger,
+		Metrics: recorder,
+	}
+
+	s3Client := &infrastructure.TracingS3Client{Client: s3.NewFromConfig(cfg)}
+
+	store, err := newCacheStore(s3Client)
+	if err != nil {
+		return nil, err
+	}
+
+	if store == nil {
+		return &infrastructure.TracingRekognitionClient{Client: client}, nil
+	}
+
+	ttl, err := loadCacheTTL()
+	if err != nil {
+		return nil, err
+	}
+
+	// キャッシュが使われた場合はTPSの制限もリトライも必要無いので、トレース以外の一番外側でキャッシュする
+	return &infrastructure.TracingRekognitionClient{
+		Client: &infrastructure.CachingRekognitionClient{
+			Client:   client,
+			Store:    store,
+			S3Client: s3Client,
+			TTL:      ttl,
+			Logger:   logger,
+			Metrics:  recorder,
+		},
+	}, nil
+}
+
+// newCacheStore は以下の優先順位で DetectLabels の結果を保存する場所を決める、どれも指定されていない場合はキャッシュしない
+// REKOGNITION_CACHE_BUCKET: S3（Lambda関数同士で共有する場合）
+// REKOGNITION_CACHE_DIR: ファイル（ローカルサーバーを再起動しても残したい場合）
+// REKOGNITION_CACHE_SIZE: メモリ上に指定した件数まで
+func newCacheStore(s3Client infrastructure.S3Client) (infrastructure.RekognitionCacheStore, error) {
+	if bucketName := os.Getenv("REKOGNITION_CACHE_BUCKET"); bucketName != "" {
+		return &infrastructure.S3RekognitionCacheStore{
+			S3Client:   s3Client,
+			BucketName: bucketName,
+			Prefix:     os.Getenv("REKOGNITION_CACHE_PREFIX"),
+		}, nil
+	}
+
+	if dir := os.Getenv("REKOGNITION_CACHE_DIR"); dir != "" {
+		store, err := infrastructure.NewFileRekognitionCacheStore(dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to infrastructure.NewFileRekognitionCacheStore")
+		}
+
+		return store, nil
+	}
+
+	if v := os.Getenv("REKOGNITION_CACHE_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 1 {
+			return nil, errors.New("REKOGNITION_CACHE_SIZE must be a positive integer")
+		}
+
+		return infrastructure.NewMemoryRekognitionCacheStore(size), nil
+	}
+
+	return nil, nil
+}
+
+// loadCacheTTL は REKOGNITION_CACHE_TTL（.e.g. 24h）を読み込む、指定されていない場合は DefaultRekognitionCacheTTL を利用する
+func loadCacheTTL() (time.Duration, error) {
+	v := os.Getenv("REKOGNITION_CACHE_TTL")
+	if v == "" {
+		return infrastructure.DefaultRekognitionCacheTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(v)
+	if err != nil || ttl <= 0 {
+		return 0, errors.New("REKOGNITION_CACHE_TTL must be a positive duration")
+	}
+
+	return ttl, nil
+}
+
+// loadTokenBucket は環境変数に指定されたTPSの TokenBucket を作成する、指定されていない場合は制限しないので nil を返す
+// 1秒分のリクエストはまとめて送れるように、TPSを切り上げた値をバーストの上限にする
+func loadTokenBucket(key string) (*infrastructure.TokenBucket, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	tps, err := strconv.ParseFloat(v, 64)
+	if err != nil || tps <= 0 {
+		return nil, errors.New(key + " must be a positive number")
+	}
+
+	return infrastructure.NewTokenBucket(tps, int(math.Ceil(tps))), nil
+}
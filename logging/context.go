@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+type contextKey struct{}
+
+// WithFields は Logger が出力するログに fields を追加した context を返す
+// ハンドラーでリクエストID、S3のKey等を設定しておくと、UseCase で出力するログにも自動的に含まれる
+func WithFields(ctx context.Context, fields Fields) context.Context {
+	return context.WithValue(ctx, contextKey{}, mergeFields(fieldsFromContext(ctx), fields))
+}
+
+// WithLambdaRequestId はLambdaのリクエストIDをログに追加した context を返す
+// Lambdaから起動されていない場合（ローカルサーバー、テスト）は何もしない
+func WithLambdaRequestId(ctx context.Context) context.Context {
+	lc, ok := lambdacontext.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	return WithFields(ctx, Fields{"lambdaRequestId": lc.AwsRequestID})
+}
+
+func fieldsFromContext(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(contextKey{}).(Fields)
+
+	return fields
+}
+
+// WithApiGatewayRequestId はAPI GatewayのリクエストIDをログに追加した context を返す
+// リクエストIDが空の場合（テスト等）は何もしない
+func WithApiGatewayRequestId(ctx context.Context, requestId string) context.Context {
+	if requestId == "" {
+		return ctx
+	}
+
+	return WithFields(ctx, Fields{"apiGatewayRequestId": requestId})
+}
@@ -0,0 +1,234 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var ErrInvalidLevel = errors.New("invalid log level")
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+
+	return LevelInfo, errors.Wrap(ErrInvalidLevel, s)
+}
+
+// Fields はログに出力する項目
+type Fields map[string]interface{}
+
+const (
+	redacted = "[REDACTED]"
+	// maxStringFieldLength を超える文字列はBase64エンコードされた画像等の可能性があるので出力しない
+	maxStringFieldLength = 1024
+	// minBase64RunLength 文字以上Base64の文字が続く文字列は、短くてもBase64エンコードされた画像の可能性があるので出力しない
+	minBase64RunLength = 256
+)
+
+// sensitiveFieldNames に一致する項目（大文字小文字は区別しない）は値を出力しない
+// Base64エンコードされた画像は個人情報を含む可能性があり、CloudWatch Logsの料金も増えてしまうので絶対に出力しない
+var sensitiveFieldNames = map[string]bool{
+	"image":       true,
+	"imagebase64": true,
+	"body":        true,
+	"requestbody": true,
+}
+
+// Logger はJSON Lines形式で1行に1件のログを出力する
+// nil の Logger のメソッドを呼んでも何も出力しないので、Loggerが設定されていない UseCase でもそのまま呼び出せる
+type Logger struct {
+	out    io.Writer
+	mu     *sync.Mutex
+	level  Level
+	fields Fields
+	// Now はテストで時刻を固定する為に利用する、設定されていない場合は time.Now を利用する
+	Now func() time.Time
+}
+
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{out: out, mu: &sync.Mutex{}, level: level}
+}
+
+// NewFromEnv は標準出力に LOG_LEVEL（debug, info, warn, error）以上のログを出力する Logger を作成する
+// LOG_LEVEL が指定されていないか不正な場合は info を利用する
+func NewFromEnv() *Logger {
+	level, err := ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		level = LevelInfo
+	}
+
+	return New(os.Stdout, level)
+}
+
+// With は常に fields を出力する Logger を返す
+func (l *Logger) With(fields Fields) *Logger {
+	if l == nil {
+		return nil
+	}
+
+	child := *l
+	child.fields = mergeFields(l.fields, fields)
+
+	return &child
+}
+
+func (l *Logger) Debug(ctx context.Context, message string, fields ...Fields) {
+	l.write(ctx, LevelDebug, message, fields)
+}
+
+func (l *Logger) Info(ctx context.Context, message string, fields ...Fields) {
+	l.write(ctx, LevelInfo, message, fields)
+}
+
+func (l *Logger) Warn(ctx context.Context, message string, fields ...Fields) {
+	l.write(ctx, LevelWarn, message, fields)
+}
+
+// Error は err のメッセージを "error" として出力する
+func (l *Logger) Error(ctx context.Context, message string, err error, fields ...Fields) {
+	if err != nil {
+		fields = append(fields, Fields{"error": err.Error()})
+	}
+
+	l.write(ctx, LevelError, message, fields)
+}
+
+// Fatal はエラーを出力してプロセスを終了する、Lambdaの初期化処理で続行出来ないエラーが発生した場合に利用する
+func (l *Logger) Fatal(ctx context.Context, message string, err error, fields ...Fields) {
+	if l == nil {
+		l = New(os.Stderr, LevelError)
+	}
+
+	l.Error(ctx, message, err, fields...)
+	os.Exit(1)
+}
+
+func (l *Logger) write(ctx context.Context, level Level, message string, fields []Fields) {
+	if l == nil || level < l.level {
+		return
+	}
+
+	entry := mergeFields(l.fields, fieldsFromContext(ctx))
+	for _, f := range fields {
+		entry = mergeFields(entry, f)
+	}
+
+	entry = redact(entry)
+
+	// 呼び出し元の項目で上書きされないように最後に設定する
+	entry["time"] = l.now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["message"] = message
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(Fields{"level": LevelError.String(), "message": "failed to json.Marshal log entry"})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, _ = l.out.Write(append(line, '\n'))
+}
+
+func (l *Logger) now() time.Time {
+	if l.Now == nil {
+		return time.Now()
+	}
+
+	return l.Now()
+}
+
+func mergeFields(base Fields, fields Fields) Fields {
+	merged := make(Fields, len(base)+len(fields))
+
+	for k, v := range base {
+		merged[k] = v
+	}
+
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+func redact(fields Fields) Fields {
+	for k, v := range fields {
+		if sensitiveFieldNames[strings.ToLower(k)] {
+			fields[k] = redacted
+
+			continue
+		}
+
+		switch value := v.(type) {
+		case []byte:
+			fields[k] = redacted
+		case string:
+			if len(value) > maxStringFieldLength || containsEncodedImage(value) {
+				fields[k] = redacted
+			}
+		}
+	}
+
+	return fields
+}
+
+// containsEncodedImage は data URI（data:image/...）か、minBase64RunLength 文字以上続くBase64の文字を含む場合に true を返す
+func containsEncodedImage(s string) bool {
+	if strings.Contains(strings.ToLower(s), "data:image/") {
+		return true
+	}
+
+	run := 0
+
+	for _, c := range s {
+		if !isBase64Char(c) {
+			run = 0
+
+			continue
+		}
+
+		run++
+		if run >= minBase64RunLength {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isBase64Char(c rune) bool {
+	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+		c == '+' || c == '/' || c == '=' || c == '-' || c == '_'
+}
@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/pkg/errors"
+)
+
+func newTestLogger(level Level) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+
+	logger := New(&buf, level)
+	logger.Now = func() time.Time { return time.Date(2022, 3, 19, 12, 0, 0, 0, time.UTC) }
+
+	return logger, &buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var entries []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal("Error failed to json.Unmarshal", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+//nolint:funlen
+func TestLogger(t *testing.T) {
+	t.Run("Successful write the fields in the context as a json line", func(t *testing.T) {
+		logger, buf := newTestLogger(LevelInfo)
+
+		ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "lambda-request"})
+		ctx = WithLambdaRequestId(ctx)
+		ctx = WithApiGatewayRequestId(ctx, "api-request")
+
+		logger.With(Fields{"function": "imageRecognition"}).Error(
+			ctx,
+			"failed to recognize image",
+			errors.New("rekognition is unavailable"),
+			Fields{"imageId": "adc9ba0c"},
+		)
+
+		expected := []map[string]interface{}{
+			{
+				"time":                "2022-03-19T12:00:00Z",
+				"level":               "error",
+				"message":             "failed to recognize image",
+				"error":               "rekognition is unavailable",
+				"function":            "imageRecognition",
+				"lambdaRequestId":     "lambda-request",
+				"apiGatewayRequestId": "api-request",
+				"imageId":             "adc9ba0c",
+			},
+		}
+
+		if entries := decodeLines(t, buf); reflect.DeepEqual(entries, expected) == false {
+			t.Error("\nActually: ", entries, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful skip the logs below the level", func(t *testing.T) {
+		logger, buf := newTestLogger(LevelWarn)
+
+		logger.Debug(context.Background(), "debug")
+		logger.Info(context.Background(), "info")
+		logger.Warn(context.Background(), "warn")
+
+		if entries := decodeLines(t, buf); len(entries) != 1 || entries[0]["message"] != "warn" {
+			t.Error("\nActually: ", entries, "\nExpected: ", "only warn")
+		}
+	})
+
+	t.Run("Successful never write the image", func(t *testing.T) {
+		logger, buf := newTestLogger(LevelInfo)
+
+		base64Image := strings.Repeat("/9j/4AAQSkZJRgABAQ", 100)
+
+		logger.Info(context.Background(), "received request", Fields{
+			"image":      base64Image,
+			"Body":       `{"image":"` + base64Image + `"}`,
+			"imageBytes": []byte("raw image"),
+			"unexpected": base64Image,
+			"dataUri":    "data:image/jpeg;base64,/9j/4AAQSkZJRgABAQ",
+			"shortImage": "invalid image: " + base64Image[:minBase64RunLength],
+		})
+
+		if strings.Contains(buf.String(), "/9j/4AAQSkZJRgABAQ") || strings.Contains(buf.String(), "raw image") {
+			t.Error("\nActually: ", buf.String(), "\nExpected: ", "the image is redacted")
+		}
+
+		entry := decodeLines(t, buf)[0]
+		for _, name := range []string{"image", "Body", "imageBytes", "unexpected", "dataUri", "shortImage"} {
+			if entry[name] != redacted {
+				t.Error("\nActually: ", name, entry[name], "\nExpected: ", redacted)
+			}
+		}
+	})
+
+	t.Run("Successful write the short messages as they are", func(t *testing.T) {
+		logger, buf := newTestLogger(LevelInfo)
+
+		const key = "tmp/adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a.jpg"
+
+		logger.Info(context.Background(), "evaluated cat image", Fields{"s3ObjectKey": key})
+
+		entry := decodeLines(t, buf)[0]
+		if entry["s3ObjectKey"] != key {
+			t.Error("\nActually: ", entry["s3ObjectKey"], "\nExpected: ", key)
+		}
+	})
+
+	t.Run("Successful do nothing with the nil logger", func(t *testing.T) {
+		var logger *Logger
+
+		logger.With(Fields{"imageId": "adc9ba0c"}).Info(context.Background(), "nothing happens")
+	})
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("WARN"); err != nil || level != LevelWarn {
+		t.Error("\nActually: ", level, err, "\nExpected: ", LevelWarn)
+	}
+
+	if _, err := ParseLevel("verbose"); !errors.Is(err, ErrInvalidLevel) {
+		t.Error("\nActually: ", err, "\nExpected: ", ErrInvalidLevel)
+	}
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Unit はCloudWatchのメトリクスの単位
+type Unit string
+
+const (
+	UnitCount        Unit = "Count"
+	UnitMilliseconds Unit = "Milliseconds"
+	UnitBytes        Unit = "Bytes"
+)
+
+const DefaultNamespace = "AwsRekognitionSandbox"
+
+// Dimensions はメトリクスのディメンション、値が空のディメンションは出力しない
+type Dimensions map[string]string
+
+// Recorder はCloudWatch Embedded Metric Format（EMF）のJSONを1行に1件出力する
+// Lambdaの標準出力にEMFのJSONを出力するとCloudWatch Logsが自動的にメトリクスとして取り込むので、PutMetricData を呼ぶ必要が無い
+// nil の Recorder のメソッドを呼んでも何も出力しないので、Recorderが設定されていない UseCase でもそのまま呼び出せる
+type Recorder struct {
+	out        io.Writer
+	mu         *sync.Mutex
+	namespace  string
+	dimensions Dimensions
+	// Now はテストで時刻を固定する為に利用する、設定されていない場合は time.Now を利用する
+	Now func() time.Time
+}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit Unit   `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// New は全てのメトリクスに dimensions を付けて出力する Recorder を作成する
+func New(out io.Writer, namespace string, dimensions Dimensions) *Recorder {
+	return &Recorder{out: out, mu: &sync.Mutex{}, namespace: namespace, dimensions: dimensions}
+}
+
+// NewFromEnv は標準出力に出力する Recorder を作成する
+// METRICS_NAMESPACE が指定されていない場合は DefaultNamespace を利用する
+// Lambda関数名（AWS_LAMBDA_FUNCTION_NAME）とステージ（DEPLOY_STAGE）をディメンションにする
+func NewFromEnv() *Recorder {
+	namespace := os.Getenv("METRICS_NAMESPACE")
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	return New(os.Stdout, namespace, Dimensions{
+		"FunctionName": os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		"Stage":        os.Getenv("DEPLOY_STAGE"),
+	})
+}
+
+// Count は回数を1件として出力する
+func (r *Recorder) Count(name string, dimensions Dimensions) {
+	r.Put(name, 1, UnitCount, dimensions)
+}
+
+// Duration は時間をミリ秒で出力する
+func (r *Recorder) Duration(name string, d time.Duration, dimensions Dimensions) {
+	r.Put(name, float64(d)/float64(time.Millisecond), UnitMilliseconds, dimensions)
+}
+
+// Put は共通のディメンションに dimensions を加えてメトリクスを1件出力する
+func (r *Recorder) Put(name string, value float64, unit Unit, dimensions Dimensions) {
+	if r == nil {
+		return
+	}
+
+	entry := map[string]interface{}{}
+
+	dimensionKeys := []string{}
+
+	for _, d := range []Dimensions{r.dimensions, dimensions} {
+		for k, v := range d {
+			if v == "" {
+				continue
+			}
+
+			if _, ok := entry[k]; !ok {
+				dimensionKeys = append(dimensionKeys, k)
+			}
+
+			entry[k] = v
+		}
+	}
+
+	sort.Strings(dimensionKeys)
+
+	entry[name] = value
+	entry["_aws"] = emfMetadata{
+		Timestamp: r.now().UnixNano() / int64(time.Millisecond),
+		CloudWatchMetrics: []emfDirective{
+			{
+				Namespace:  r.namespace,
+				Dimensions: [][]string{dimensionKeys},
+				Metrics:    []emfMetricDefinition{{Name: name, Unit: unit}},
+			},
+		},
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, _ = r.out.Write(append(line, '\n'))
+}
+
+func (r *Recorder) now() time.Time {
+	if r.Now == nil {
+		return time.Now()
+	}
+
+	return r.Now()
+}
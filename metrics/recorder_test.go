@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRecorder() (*Recorder, *bytes.Buffer) {
+	var buf bytes.Buffer
+
+	recorder := New(&buf, "TestNamespace", Dimensions{"FunctionName": "isAcceptableCatImage", "Stage": ""})
+	recorder.Now = func() time.Time { return time.Date(2022, 3, 19, 12, 0, 0, 0, time.UTC) }
+
+	return recorder, &buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var entries []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal("Error failed to json.Unmarshal", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+//nolint:funlen
+func TestRecorder(t *testing.T) {
+	t.Run("Successful write the metric in the embedded metric format", func(t *testing.T) {
+		recorder, buf := newTestRecorder()
+
+		recorder.Count("DetectedCatBreeds", Dimensions{"Breed": "Scottish Fold"})
+
+		expected := []map[string]interface{}{
+			{
+				"_aws": map[string]interface{}{
+					"Timestamp": float64(1647691200000),
+					"CloudWatchMetrics": []interface{}{
+						map[string]interface{}{
+							"Namespace":  "TestNamespace",
+							"Dimensions": []interface{}{[]interface{}{"Breed", "FunctionName"}},
+							"Metrics": []interface{}{
+								map[string]interface{}{"Name": "DetectedCatBreeds", "Unit": "Count"},
+							},
+						},
+					},
+				},
+				"FunctionName":      "isAcceptableCatImage",
+				"Breed":             "Scottish Fold",
+				"DetectedCatBreeds": float64(1),
+			},
+		}
+
+		if entries := decodeLines(t, buf); reflect.DeepEqual(entries, expected) == false {
+			t.Error("\nActually: ", entries, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful write the duration in milliseconds", func(t *testing.T) {
+		recorder, buf := newTestRecorder()
+
+		recorder.Duration("RekognitionLatency", 1500*time.Microsecond, Dimensions{"Operation": "DetectLabels"})
+
+		entry := decodeLines(t, buf)[0]
+		if entry["RekognitionLatency"] != 1.5 || entry["Operation"] != "DetectLabels" {
+			t.Error("\nActually: ", entry, "\nExpected: ", 1.5, "DetectLabels")
+		}
+	})
+
+	t.Run("Successful do nothing with the nil recorder", func(t *testing.T) {
+		var recorder *Recorder
+
+		recorder.Count("AcceptedCatImages", nil)
+	})
+}
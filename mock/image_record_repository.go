@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: infrastructure/image_record_repository.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	infrastructure "github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+)
+
+// MockImageRecordRepository is a mock of ImageRecordRepository interface.
+type MockImageRecordRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockImageRecordRepositoryMockRecorder
+}
+
+// MockImageRecordRepositoryMockRecorder is the mock recorder for MockImageRecordRepository.
+type MockImageRecordRepositoryMockRecorder struct {
+	mock *MockImageRecordRepository
+}
+
+// NewMockImageRecordRepository creates a new mock instance.
+func NewMockImageRecordRepository(ctrl *gomock.Controller) *MockImageRecordRepository {
+	mock := &MockImageRecordRepository{ctrl: ctrl}
+	mock.recorder = &MockImageRecordRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockImageRecordRepository) EXPECT() *MockImageRecordRepositoryMockRecorder {
+	return m.recorder
+}
+
+// FindById mocks base method.
+func (m *MockImageRecordRepository) FindById(ctx context.Context, imageId string) (*infrastructure.ImageRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindById", ctx, imageId)
+	ret0, _ := ret[0].(*infrastructure.ImageRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindById indicates an expected call of FindById.
+func (mr *MockImageRecordRepositoryMockRecorder) FindById(ctx, imageId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockImageRecordRepository)(nil).FindById), ctx, imageId)
+}
+
+// Save mocks base method.
+func (m *MockImageRecordRepository) Save(ctx context.Context, record *infrastructure.ImageRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, record)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockImageRecordRepositoryMockRecorder) Save(ctx, record interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockImageRecordRepository)(nil).Save), ctx, record)
+}
@@ -74,3 +74,23 @@ func (mr *MockRekognitionClientMockRecorder) DetectLabels(ctx, params interface{
 	varargs := append([]interface{}{ctx, params}, optFns...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetectLabels", reflect.TypeOf((*MockRekognitionClient)(nil).DetectLabels), varargs...)
 }
+
+// DetectModerationLabels mocks base method.
+func (m *MockRekognitionClient) DetectModerationLabels(ctx context.Context, params *rekognition.DetectModerationLabelsInput, optFns ...func(*rekognition.Options)) (*rekognition.DetectModerationLabelsOutput, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DetectModerationLabels", varargs...)
+	ret0, _ := ret[0].(*rekognition.DetectModerationLabelsOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DetectModerationLabels indicates an expected call of DetectModerationLabels.
+func (mr *MockRekognitionClientMockRecorder) DetectModerationLabels(ctx, params interface{}, optFns ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetectModerationLabels", reflect.TypeOf((*MockRekognitionClient)(nil).DetectModerationLabels), varargs...)
+}
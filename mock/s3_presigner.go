@@ -0,0 +1,57 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: infrastructure/s3_presigner.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	s3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockS3Presigner is a mock of S3Presigner interface.
+type MockS3Presigner struct {
+	ctrl     *gomock.Controller
+	recorder *MockS3PresignerMockRecorder
+}
+
+// MockS3PresignerMockRecorder is the mock recorder for MockS3Presigner.
+type MockS3PresignerMockRecorder struct {
+	mock *MockS3Presigner
+}
+
+// NewMockS3Presigner creates a new mock instance.
+func NewMockS3Presigner(ctrl *gomock.Controller) *MockS3Presigner {
+	mock := &MockS3Presigner{ctrl: ctrl}
+	mock.recorder = &MockS3PresignerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockS3Presigner) EXPECT() *MockS3PresignerMockRecorder {
+	return m.recorder
+}
+
+// PresignPutObject mocks base method.
+func (m *MockS3Presigner) PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, params}
+	for _, a := range optFns {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PresignPutObject", varargs...)
+	ret0, _ := ret[0].(*v4.PresignedHTTPRequest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PresignPutObject indicates an expected call of PresignPutObject.
+func (mr *MockS3PresignerMockRecorder) PresignPutObject(ctx, params interface{}, optFns ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, params}, optFns...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PresignPutObject", reflect.TypeOf((*MockS3Presigner)(nil).PresignPutObject), varargs...)
+}
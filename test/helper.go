@@ -1,8 +1,21 @@
 package test
 
 import (
+	"bytes"
 	"encoding/base64"
+	"io"
+	"mime/multipart"
+	"net/textproto"
 	"os"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
 )
 
 func EncodeImageToBase64(imgPath string) (string, error) {
@@ -22,3 +35,98 @@ func DecodeImageFromBase64(base64Img string) ([]byte, error) {
 
 	return decodedImg, nil
 }
+
+// CreateMultipartBody は画像ファイルを1つ含む multipart/form-data のリクエストボディとContent-Typeを作成する
+func CreateMultipartBody(
+	fieldName string,
+	fileName string,
+	partContentType string,
+	img []byte,
+) ([]byte, string, error) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="`+fieldName+`"; filename="`+fileName+`"`)
+	header.Set("Content-Type", partContentType)
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := part.Write(img); err != nil {
+		return nil, "", err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+// NewS3EventRecord はS3イベントのレコードを作成する、sequencer を変えると同じKeyへの別のアップロードとして扱われる
+func NewS3EventRecord(bucketName string, key string, sequencer string) events.S3EventRecord {
+	return events.S3EventRecord{
+		S3: events.S3Entity{
+			Bucket: events.S3Bucket{Name: bucketName},
+			Object: events.S3Object{Key: key, Sequencer: sequencer},
+		},
+	}
+}
+
+type getObjectKeyMatcher struct {
+	key string
+}
+
+func (m getObjectKeyMatcher) Matches(x interface{}) bool {
+	input, ok := x.(*s3.GetObjectInput)
+	if !ok {
+		return false
+	}
+
+	return aws.ToString(input.Key) == m.key
+}
+
+func (m getObjectKeyMatcher) String() string {
+	return "is GetObjectInput with key " + m.key
+}
+
+// GetObjectInputWithKey は指定したKeyの GetObjectInput にマッチする
+// 複数のレコードを並行して処理する場合は呼び出し順が決まらないので、Keyで期待する呼び出しを区別する
+func GetObjectInputWithKey(key string) gomock.Matcher {
+	return getObjectKeyMatcher{key: key}
+}
+
+// ExpectAcceptableCatImage は catimage.DefaultPolicy で受け入れ可能なねこ画像として1回だけ判定される事を期待する
+func ExpectAcceptableCatImage(
+	t *testing.T,
+	mockS3Client *mock.MockS3Client,
+	mockRekognitionClient *mock.MockRekognitionClient,
+	imgPath string,
+) {
+	t.Helper()
+
+	img, err := os.ReadFile(imgPath)
+	if err != nil {
+		t.Fatal("Error failed to os.ReadFile", err)
+	}
+
+	mockS3Client.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(
+		&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(img))},
+		nil,
+	)
+	mockS3Client.EXPECT().CopyObject(gomock.Any(), gomock.Any()).Return(&s3.CopyObjectOutput{}, nil)
+
+	mockRekognitionClient.EXPECT().DetectLabels(gomock.Any(), gomock.Any()).Return(
+		&rekognition.DetectLabelsOutput{
+			Labels: []types.Label{{Confidence: aws.Float32(99.1), Name: aws.String("Cat")}},
+		},
+		nil,
+	)
+	mockRekognitionClient.EXPECT().DetectModerationLabels(gomock.Any(), gomock.Any()).Return(
+		&rekognition.DetectModerationLabelsOutput{},
+		nil,
+	)
+}
@@ -0,0 +1,36 @@
+package test
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SetInMemoryTracerProvider はテストの間だけ終了した span をメモリ上に保存する TracerProvider をグローバルに登録する
+// テストが終わると何もしない TracerProvider に戻すので、他のテストの context には span が含まれない
+func SetInMemoryTracerProvider(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+
+	return exporter
+}
+
+// SpanNames は exporter に保存された span の名前を終了した順に返す
+func SpanNames(exporter *tracetest.InMemoryExporter) []string {
+	var names []string
+
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+	}
+
+	return names
+}
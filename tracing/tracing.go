@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/keitakn/aws-rekognition-sandbox"
+
+// propagator はS3オブジェクトのメタデータ（x-amz-meta-traceparent）でトレースコンテキストを受け渡す為に利用する
+var propagator = propagation.TraceContext{}
+
+// IsConfigured はトレースの送信先（OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_TRACES_ENDPOINT）が指定されているかどうか
+func IsConfigured() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// NewProviderFromEnv はOTLP（HTTP）でトレースを送信する TracerProvider を作成してグローバルに登録する
+// 送信先が指定されていない場合は何もせずに nil を返すので、Start で作成される span は全て何もしない
+// 送信先の設定は OTEL_EXPORTER_OTLP_ENDPOINT 等の OpenTelemetry の標準の環境変数で行う
+func NewProviderFromEnv(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	if !IsConfigured() {
+		return nil, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to otlptracehttp.New")
+	}
+
+	serviceName := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	if serviceName == "" {
+		serviceName = "aws-rekognition-sandbox"
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider, nil
+}
+
+// Flush はまだ送信されていない span を送信する
+// Lambdaはレスポンスを返すと次の呼び出しまで停止するので、ハンドラーの最後に呼び出す必要がある
+func Flush(ctx context.Context) {
+	if provider, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		_ = provider.ForceFlush(ctx)
+	}
+}
+
+// Start は span を開始する
+// TracerProvider が登録されていない場合は context をそのまま返す（UseCase のテストで context を比較出来るようにする為）
+func Start(ctx context.Context, spanName string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	spanCtx, span := otel.Tracer(tracerName).Start(ctx, spanName, trace.WithAttributes(attrs...))
+	if !span.SpanContext().IsValid() {
+		return ctx, span
+	}
+
+	return spanCtx, span
+}
+
+// End は err がある場合は span をエラーとして記録してから終了する
+func End(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
+
+// RecordError は err がある場合に span をエラーとして記録する
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// InjectS3Metadata はアップロードするS3オブジェクトのメタデータにトレースコンテキストを追加する
+// S3イベントで非同期に起動される isacceptablecatimage は、このメタデータからアップロードした際のトレースを引き継ぐ
+// トレースしていない場合は metadata をそのまま返す
+func InjectS3Metadata(ctx context.Context, metadata map[string]string) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+
+	if len(carrier) == 0 {
+		return metadata
+	}
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+
+	for k, v := range carrier {
+		metadata[k] = v
+	}
+
+	return metadata
+}
+
+// ExtractS3Metadata はS3オブジェクトのメタデータに保存されたトレースコンテキストを引き継いだ context を返す
+func ExtractS3Metadata(ctx context.Context, metadata map[string]string) context.Context {
+	return propagator.Extract(ctx, propagation.MapCarrier(metadata))
+}
+
+// S3ObjectAttributes はS3オブジェクトを span の属性にする、空の値は含めない
+func S3ObjectAttributes(bucketName string, key string) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+
+	if bucketName != "" {
+		attrs = append(attrs, attribute.String("aws.s3.bucket", bucketName))
+	}
+
+	if key != "" {
+		attrs = append(attrs, attribute.String("aws.s3.key", key))
+	}
+
+	return attrs
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//nolint:funlen
+func TestTracing(t *testing.T) {
+	t.Run("Successful return the context as it is without the tracer provider", func(t *testing.T) {
+		ctx := context.Background()
+
+		spanCtx, span := Start(ctx, "catimage.UseCase.IsAcceptableCatImage")
+		defer span.End()
+
+		if spanCtx != ctx {
+			t.Error("\nActually: ", spanCtx, "\nExpected: ", ctx)
+		}
+
+		if metadata := InjectS3Metadata(spanCtx, nil); metadata != nil {
+			t.Error("\nActually: ", metadata, "\nExpected: ", nil)
+		}
+	})
+
+	t.Run("Successful propagate the trace context through the s3 object metadata", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+		defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+		uploadCtx, uploadSpan := Start(context.Background(), "imageRecognition.Handler")
+		metadata := InjectS3Metadata(uploadCtx, map[string]string{"owner": "moko"})
+		End(uploadSpan, nil)
+
+		if metadata["owner"] != "moko" || metadata["traceparent"] == "" {
+			t.Fatal("\nActually: ", metadata, "\nExpected: ", "owner and traceparent")
+		}
+
+		_, span := Start(ExtractS3Metadata(context.Background(), metadata), "catimageevent.Processor.ProcessRecord")
+		End(span, errors.New("failed to DetectLabels"))
+
+		spans := exporter.GetSpans()
+		if len(spans) != 2 {
+			t.Fatal("\nActually: ", len(spans), "\nExpected: ", 2)
+		}
+
+		if spans[1].Parent.SpanID() != uploadSpan.SpanContext().SpanID() {
+			t.Error("\nActually: ", spans[1].Parent.SpanID(), "\nExpected: ", uploadSpan.SpanContext().SpanID())
+		}
+
+		if spans[1].Status.Code != codes.Error || spans[1].Status.Description != "failed to DetectLabels" {
+			t.Error("\nActually: ", spans[1].Status, "\nExpected: ", codes.Error)
+		}
+	})
+
+	t.Run("Successful skip the empty s3 attributes", func(t *testing.T) {
+		expected := []attribute.KeyValue{attribute.String("aws.s3.bucket", "trigger-bucket")}
+
+		if attrs := S3ObjectAttributes("trigger-bucket", ""); reflect.DeepEqual(attrs, expected) == false {
+			t.Error("\nActually: ", attrs, "\nExpected: ", expected)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package catimage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/imageprocessing"
+	"github.com/pkg/errors"
+)
+
+// CroppedCatImagePrefix は切り抜いたねこ画像の保存先
+// CopyCatImageToDestinationBucket のコピー先（cat-images/）と同じ階層に保存する
+const CroppedCatImagePrefix = "cat-images/cropped/"
+
+var ErrCatNotFound = errors.New("cat not found")
+
+type CreateCroppedCatImageRequest struct {
+	TriggerBucketName     string
+	DestinationBucketName string
+	TargetS3ObjectKey     string
+	// TargetS3ObjectVersionId が設定されている場合は、判定したバージョンの画像を切り抜く
+	TargetS3ObjectVersionId string
+	// Cats には IsAcceptableCatImageResponse.Cats をそのまま設定する
+	Cats        []CatInstance
+	CropOptions imageprocessing.CropOptions
+}
+
+type CreateCroppedCatImageResponse struct {
+	CroppedS3ObjectKey string
+}
+
+// CreateCroppedCatImage は画像内で一番大きく写っているねこを中心に切り抜いた画像を作成する
+// 大きさが同じ場合は信頼度が高いねこを優先する
+func (
+	u *UseCase,
+) CreateCroppedCatImage(
+	ctx context.Context,
+	req *CreateCroppedCatImageRequest,
+) (*CreateCroppedCatImageResponse, error) {
+	primaryCat, ok := findPrimaryCat(req.Cats)
+	if !ok {
+		return nil, errors.Wrap(ErrCatNotFound, "cats is empty")
+	}
+
+	b, err := u.getS3ObjectBody(ctx, req.TriggerBucketName, req.TargetS3ObjectKey, req.TargetS3ObjectVersionId)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to UseCase.getS3ObjectBody")
+	}
+
+	img, format, err := imageprocessing.Decode(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to imageprocessing.Decode")
+	}
+
+	box := imageprocessing.RelativeBox{
+		Left:   float64(primaryCat.BoundingBox.Left),
+		Top:    float64(primaryCat.BoundingBox.Top),
+		Width:  float64(primaryCat.BoundingBox.Width),
+		Height: float64(primaryCat.BoundingBox.Height),
+	}
+
+	rect := imageprocessing.CropRectangle(img.Bounds().Dx(), img.Bounds().Dy(), box, req.CropOptions)
+	if rect.Empty() {
+		return nil, errors.Wrap(ErrCatNotFound, "bounding box is empty")
+	}
+
+	encoded, encodedFormat, err := imageprocessing.Encode(imageprocessing.Crop(img, rect), format)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to imageprocessing.Encode")
+	}
+
+	// WebP等はPNGとして保存されるので、拡張子をエンコードした形式に合わせる
+	key := strings.ReplaceAll(req.TargetS3ObjectKey, "tmp/", "")
+	uploadKey := CroppedCatImagePrefix + strings.TrimSuffix(key, filepath.Ext(key)) + encodedFormat.Extension()
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(req.DestinationBucketName),
+		Key:         aws.String(uploadKey),
+		Body:        bytes.NewReader(encoded),
+		ContentType: aws.String(encodedFormat.ContentType()),
+	}
+
+	if _, err := u.S3Client.PutObject(ctx, input); err != nil {
+		return nil, errors.Wrap(err, "failed to S3Client.PutObject")
+	}
+
+	return &CreateCroppedCatImageResponse{CroppedS3ObjectKey: uploadKey}, nil
+}
+
+func findPrimaryCat(cats []CatInstance) (CatInstance, bool) {
+	var (
+		primaryCat CatInstance
+		found      bool
+		maxArea    float32
+	)
+
+	for _, cat := range cats {
+		area := cat.BoundingBox.Width * cat.BoundingBox.Height
+		if area <= 0 {
+			continue
+		}
+
+		if !found || area > maxArea || (area == maxArea && cat.Confidence > primaryCat.Confidence) {
+			primaryCat = cat
+			maxArea = area
+			found = true
+		}
+	}
+
+	return primaryCat, found
+}
+
+// getS3ObjectBody は versionId が空の場合は最新のバージョンを取得する
+// 判定の途中で同じKeyに上書きされても、Rekognitionで解析したものと同じ画像を扱えるように versionId を指定する
+func (u *UseCase) getS3ObjectBody(ctx context.Context, bucketName, key, versionId string) ([]byte, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(key),
+	}
+
+	if versionId != "" {
+		input.VersionId = aws.String(versionId)
+	}
+
+	output, err := u.S3Client.GetObject(ctx, input)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to S3Client.GetObject")
+	}
+	defer output.Body.Close()
+
+	b, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read s3 object body")
+	}
+
+	return b, nil
+}
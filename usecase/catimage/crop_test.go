@@ -0,0 +1,142 @@
+package catimage
+
+import (
+	"context"
+	"image"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/imageprocessing"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/pkg/errors"
+)
+
+//nolint:funlen
+func TestCreateCroppedCatImage(t *testing.T) {
+	const destinationBucketName = "destination-bucket"
+	const targetS3ObjectKey = "tmp/munchkin-cat.png"
+
+	getObjectInput := &s3.GetObjectInput{
+		Bucket:    aws.String(expectedTriggerBucketName),
+		Key:       aws.String(targetS3ObjectKey),
+		VersionId: aws.String(expectedTargetS3ObjectVersionId),
+	}
+
+	newRequest := func(cats []CatInstance) *CreateCroppedCatImageRequest {
+		return &CreateCroppedCatImageRequest{
+			TriggerBucketName:       expectedTriggerBucketName,
+			DestinationBucketName:   destinationBucketName,
+			TargetS3ObjectKey:       targetS3ObjectKey,
+			TargetS3ObjectVersionId: expectedTargetS3ObjectVersionId,
+			Cats:                    cats,
+			CropOptions:             imageprocessing.CropOptions{AspectRatio: 1},
+		}
+	}
+
+	t.Run("Successful crop the largest cat", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		cats := []CatInstance{
+			{BoundingBox: BoundingBox{Width: 0.1, Height: 0.1, Left: 0, Top: 0}, Confidence: 99.5},
+			{BoundingBox: BoundingBox{Width: 0.5, Height: 0.25, Left: 0.25, Top: 0.25}, Confidence: 91.2},
+		}
+
+		var putObjectInput *s3.PutObjectInput
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockS3Client.EXPECT().GetObject(ctx, getObjectInput).Return(
+			newGetObjectOutput(t, "../../test/images/munchkin-cat.png"),
+			nil,
+		)
+		mockS3Client.EXPECT().PutObject(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				putObjectInput = input
+
+				return &s3.PutObjectOutput{}, nil
+			},
+		)
+
+		u := UseCase{S3Client: mockS3Client}
+
+		res, err := u.CreateCroppedCatImage(ctx, newRequest(cats))
+		if err != nil {
+			t.Fatal("Failed CreateCroppedCatImage", err)
+		}
+
+		expectedKey := "cat-images/cropped/munchkin-cat.png"
+		if res.CroppedS3ObjectKey != expectedKey {
+			t.Error("\nActually: ", res.CroppedS3ObjectKey, "\nExpected: ", expectedKey)
+		}
+
+		if aws.ToString(putObjectInput.Bucket) != destinationBucketName ||
+			aws.ToString(putObjectInput.Key) != expectedKey ||
+			aws.ToString(putObjectInput.ContentType) != "image/png" {
+			t.Error("\nActually: ", putObjectInput)
+		}
+
+		b, err := io.ReadAll(putObjectInput.Body)
+		if err != nil {
+			t.Fatal("Error failed to io.ReadAll", err)
+		}
+
+		cropped, _, err := imageprocessing.Decode(b)
+		if err != nil {
+			t.Fatal("Error failed to imageprocessing.Decode", err)
+		}
+
+		// AspectRatio に 1 を指定しているので正方形になる
+		size := cropped.Bounds().Size()
+		if size.X != size.Y || size == (image.Point{}) {
+			t.Error("\nActually: ", size, "\nExpected: square")
+		}
+	})
+
+	t.Run("Failure cats is empty", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+
+		u := UseCase{S3Client: mockS3Client}
+
+		_, err := u.CreateCroppedCatImage(ctx, newRequest(nil))
+		if !errors.Is(err, ErrCatNotFound) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrCatNotFound)
+		}
+	})
+
+	t.Run("Failure upload to S3", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		cats := []CatInstance{
+			{BoundingBox: BoundingBox{Width: 0.5, Height: 0.5, Left: 0.25, Top: 0.25}, Confidence: 99.5},
+		}
+
+		expected := errors.New("failed s3Client putObject")
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockS3Client.EXPECT().GetObject(ctx, getObjectInput).Return(
+			newGetObjectOutput(t, "../../test/images/munchkin-cat.png"),
+			nil,
+		)
+		mockS3Client.EXPECT().PutObject(ctx, gomock.Any()).Return(nil, expected)
+
+		u := UseCase{S3Client: mockS3Client}
+
+		_, err := u.CreateCroppedCatImage(ctx, newRequest(cats))
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package catimage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/pkg/errors"
+)
+
+type UpdateImageRecordRequest struct {
+	TargetS3ObjectKey string
+	Status            infrastructure.ImageRecordStatus
+	// Response が設定されている場合は判定結果として保存する
+	Response *IsAcceptableCatImageResponse
+	// Err が設定されている場合はエラーメッセージとして保存する
+	Err error
+}
+
+// UpdateImageRecord は画像の処理状況を更新する
+// imagerecognition 以外（署名付きURL等）でアップロードされた画像は記録が無いので新規に作成する
+// ImageRecordRepository が設定されていない場合は何もしない
+func (u *UseCase) UpdateImageRecord(ctx context.Context, req *UpdateImageRecordRequest) error {
+	if u.ImageRecordRepository == nil {
+		return nil
+	}
+
+	imageId := infrastructure.ImageIdFromS3ObjectKey(req.TargetS3ObjectKey)
+	now := time.Now().UTC()
+
+	record, err := u.ImageRecordRepository.FindById(ctx, imageId)
+	if err != nil {
+		if !errors.Is(err, infrastructure.ErrImageRecordNotFound) {
+			return errors.Wrap(err, "failed to ImageRecordRepository.FindById")
+		}
+
+		record = &infrastructure.ImageRecord{
+			ImageId:   imageId,
+			CreatedAt: now,
+		}
+	}
+
+	record.Status = req.Status
+	record.S3ObjectKey = req.TargetS3ObjectKey
+	record.UpdatedAt = now
+	record.ErrorMessage = ""
+
+	if req.Err != nil {
+		record.ErrorMessage = req.Err.Error()
+	}
+
+	if req.Response != nil {
+		evaluation, err := json.Marshal(req.Response)
+		if err != nil {
+			return errors.Wrap(err, "failed to json.Marshal")
+		}
+
+		record.Evaluation = evaluation
+	}
+
+	if err := u.ImageRecordRepository.Save(ctx, record); err != nil {
+		return errors.Wrap(err, "failed to ImageRecordRepository.Save")
+	}
+
+	return nil
+}
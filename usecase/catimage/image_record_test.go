@@ -0,0 +1,143 @@
+package catimage
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/pkg/errors"
+)
+
+//nolint:funlen
+func TestUpdateImageRecord(t *testing.T) {
+	const imageId = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+	const targetS3ObjectKey = "tmp/" + imageId + ".jpg"
+
+	t.Run("Successful update the uploaded record with the evaluation", func(t *testing.T) {
+		ctx := context.Background()
+
+		createdAt := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+
+		repository := infrastructure.NewMemoryImageRecordRepository()
+		err := repository.Save(ctx, &infrastructure.ImageRecord{
+			ImageId:     imageId,
+			Status:      infrastructure.ImageRecordStatusUploaded,
+			S3ObjectKey: targetS3ObjectKey,
+			CreatedAt:   createdAt,
+			UpdatedAt:   createdAt,
+		})
+		if err != nil {
+			t.Fatal("Error failed to Save", err)
+		}
+
+		u := UseCase{ImageRecordRepository: repository}
+
+		response := &IsAcceptableCatImageResponse{
+			IsAcceptableCatImage: true,
+			TypesOfCats:          []string{"Abyssinian"},
+			CatCount:             1,
+		}
+
+		err = u.UpdateImageRecord(ctx, &UpdateImageRecordRequest{
+			TargetS3ObjectKey: targetS3ObjectKey,
+			Status:            infrastructure.ImageRecordStatusAccepted,
+			Response:          response,
+		})
+		if err != nil {
+			t.Fatal("Error failed to UpdateImageRecord", err)
+		}
+
+		record, err := repository.FindById(ctx, imageId)
+		if err != nil {
+			t.Fatal("Error failed to FindById", err)
+		}
+
+		if record.Status != infrastructure.ImageRecordStatusAccepted {
+			t.Error("\nActually: ", record.Status, "\nExpected: ", infrastructure.ImageRecordStatusAccepted)
+		}
+
+		if !record.CreatedAt.Equal(createdAt) || !record.UpdatedAt.After(createdAt) {
+			t.Error("\nActually: ", record.CreatedAt, record.UpdatedAt, "\nExpected: ", createdAt)
+		}
+
+		var evaluation IsAcceptableCatImageResponse
+		if err := json.Unmarshal(record.Evaluation, &evaluation); err != nil {
+			t.Fatal("Error failed to json.Unmarshal", err)
+		}
+
+		if reflect.DeepEqual(&evaluation, response) == false {
+			t.Error("\nActually: ", evaluation, "\nExpected: ", response)
+		}
+	})
+
+	t.Run("Successful create a record when the image was not uploaded by imagerecognition", func(t *testing.T) {
+		ctx := context.Background()
+
+		repository := infrastructure.NewMemoryImageRecordRepository()
+
+		u := UseCase{ImageRecordRepository: repository}
+
+		expectedErr := errors.New("failed rekognitionClient detectLabels")
+
+		err := u.UpdateImageRecord(ctx, &UpdateImageRecordRequest{
+			TargetS3ObjectKey: targetS3ObjectKey,
+			Status:            infrastructure.ImageRecordStatusFailed,
+			Err:               expectedErr,
+		})
+		if err != nil {
+			t.Fatal("Error failed to UpdateImageRecord", err)
+		}
+
+		record, err := repository.FindById(ctx, imageId)
+		if err != nil {
+			t.Fatal("Error failed to FindById", err)
+		}
+
+		if record.Status != infrastructure.ImageRecordStatusFailed ||
+			record.S3ObjectKey != targetS3ObjectKey ||
+			record.ErrorMessage != expectedErr.Error() ||
+			record.Evaluation != nil ||
+			record.CreatedAt.IsZero() {
+			t.Error("\nActually: ", record)
+		}
+	})
+
+	t.Run("Successful do nothing when the repository is not set", func(t *testing.T) {
+		u := UseCase{}
+
+		err := u.UpdateImageRecord(context.Background(), &UpdateImageRecordRequest{
+			TargetS3ObjectKey: targetS3ObjectKey,
+			Status:            infrastructure.ImageRecordStatusEvaluating,
+		})
+		if err != nil {
+			t.Error("\nActually: ", err, "\nExpected: ", nil)
+		}
+	})
+
+	t.Run("Failure find the image record", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		expected := errors.New("failed imageRecordRepository findById")
+
+		mockImageRecordRepository := mock.NewMockImageRecordRepository(ctrl)
+		mockImageRecordRepository.EXPECT().FindById(ctx, imageId).Return(nil, expected)
+
+		u := UseCase{ImageRecordRepository: mockImageRecordRepository}
+
+		err := u.UpdateImageRecord(ctx, &UpdateImageRecordRequest{
+			TargetS3ObjectKey: targetS3ObjectKey,
+			Status:            infrastructure.ImageRecordStatusEvaluating,
+		})
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package catimage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/keitakn/aws-rekognition-sandbox/imageprocessing"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/pkg/errors"
+)
+
+type NearDuplicateAction string
+
+const (
+	// NearDuplicateActionReject はほぼ同じ画像が受け入れ済みの場合に受け入れ不可にする
+	NearDuplicateActionReject NearDuplicateAction = "reject"
+	// NearDuplicateActionFlag はほぼ同じ画像が受け入れ済みでも受け入れるが、レスポンスの NearDuplicate で分かるようにする
+	NearDuplicateActionFlag NearDuplicateAction = "flag"
+)
+
+// maxPerceptualHashDistance は64ビットの知覚ハッシュのハミング距離の最大値
+const maxPerceptualHashDistance = 64
+
+// NearDuplicateRule はサイズや圧縮率が異なるだけの同じ写真を見つける為の条件
+// 知覚ハッシュ（dHash）のハミング距離が MaxDistance 以下の画像が受け入れ済みの場合にほぼ同じ画像と見なす
+type NearDuplicateRule struct {
+	MaxDistance int                 `json:"maxDistance"`
+	Action      NearDuplicateAction `json:"action"`
+}
+
+// NearDuplicate はほぼ同じ画像と見なされた受け入れ済みの画像
+type NearDuplicate struct {
+	S3ObjectKey string `json:"s3ObjectKey"`
+	Distance    int    `json:"distance"`
+}
+
+func (r *NearDuplicateRule) validate() error {
+	if r.MaxDistance < 0 || r.MaxDistance > maxPerceptualHashDistance {
+		return errors.Wrap(
+			ErrInvalidPolicy,
+			fmt.Sprintf("nearDuplicate maxDistance must be between 0 and %d", maxPerceptualHashDistance),
+		)
+	}
+
+	if r.Action != NearDuplicateActionReject && r.Action != NearDuplicateActionFlag {
+		return errors.Wrap(ErrInvalidPolicy, "nearDuplicate action must be reject or flag")
+	}
+
+	return nil
+}
+
+// evaluateNearDuplicate は受け入れ可能と判定された画像の知覚ハッシュを計算し、受け入れ済みの画像の中からほぼ同じ画像を探す
+// PerceptualHashIndex か Policy.NearDuplicate が設定されていない場合は何もしない
+// 知覚ハッシュは cat-images/ にコピーした後で追加するので、同時に判定されたほぼ同じ画像同士はどちらも受け入れ可能になる
+func (u *UseCase) evaluateNearDuplicate(
+	ctx context.Context,
+	req *Request,
+	policy *Policy,
+	response *IsAcceptableCatImageResponse,
+) error {
+	if u.PerceptualHashIndex == nil || policy.NearDuplicate == nil || !response.IsAcceptableCatImage {
+		return nil
+	}
+
+	b, err := u.getS3ObjectBody(ctx, req.TargetS3BucketName, req.TargetS3ObjectKey, req.TargetS3ObjectVersionId)
+	if err != nil {
+		return errors.Wrap(err, "failed to UseCase.getS3ObjectBody")
+	}
+
+	// Rekognitionは解析出来てもGoではデコード出来ない画像（HEIC等）は、ほぼ同じ画像かどうか判定せずに受け入れる
+	// 画素数が多過ぎる等、それ以外の理由でデコード出来なかった場合も受け入れるが、判定を省略した事が分かるようにログを出す
+	img, _, err := imageprocessing.Decode(b)
+	if err != nil {
+		if !errors.Is(err, imageprocessing.ErrUnsupportedImageFormat) {
+			u.Logger.Warn(ctx, "skipped evaluating the near duplicate", logging.Fields{
+				"s3ObjectKey": req.TargetS3ObjectKey,
+				"error":       err.Error(),
+			})
+		}
+
+		return nil
+	}
+
+	hash := imageprocessing.DHash(img)
+	response.PerceptualHash = fmt.Sprintf("%016x", hash)
+
+	matches, err := u.PerceptualHashIndex.FindSimilar(ctx, hash, policy.NearDuplicate.MaxDistance)
+	if err != nil {
+		return errors.Wrap(err, "failed to PerceptualHashIndex.FindSimilar")
+	}
+
+	// 判定の途中で失敗して再実行された場合に、前回登録した自分自身をほぼ同じ画像と見なさないようにする
+	ownKey := catImageKey(req.TargetS3ObjectKey)
+
+	for _, match := range matches {
+		if match.S3ObjectKey == ownKey {
+			continue
+		}
+
+		response.NearDuplicate = &NearDuplicate{S3ObjectKey: match.S3ObjectKey, Distance: match.Distance}
+
+		break
+	}
+
+	if response.NearDuplicate == nil || policy.NearDuplicate.Action != NearDuplicateActionReject {
+		return nil
+	}
+
+	response.IsAcceptableCatImage = false
+	response.RejectionReasons = append(response.RejectionReasons, RejectionReason{
+		Code: RejectionReasonNearDuplicate,
+		Message: fmt.Sprintf(
+			"near duplicate of %s is already accepted with distance %d",
+			response.NearDuplicate.S3ObjectKey,
+			response.NearDuplicate.Distance,
+		),
+	})
+
+	return nil
+}
+
+// addPerceptualHash は cat-images/ にコピーした画像を次回以降の判定で見つけられるように PerceptualHashIndex に追加する
+func (u *UseCase) addPerceptualHash(ctx context.Context, s3ObjectKey string, perceptualHash string) error {
+	if u.PerceptualHashIndex == nil || perceptualHash == "" {
+		return nil
+	}
+
+	hash, err := strconv.ParseUint(perceptualHash, 16, 64)
+	if err != nil {
+		return errors.Wrap(err, "failed to strconv.ParseUint")
+	}
+
+	if err := u.PerceptualHashIndex.Add(ctx, s3ObjectKey, hash); err != nil {
+		return errors.Wrap(err, "failed to PerceptualHashIndex.Add")
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package catimage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/imageprocessing"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/pkg/errors"
+)
+
+// newTooManyPixelsPng は画素数（ヘッダーの幅×高さ）だけが imageprocessing.MaxPixels を超えるPNGを返す
+func newTooManyPixelsPng(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal("Error failed to png.Encode", err)
+	}
+
+	// シグネチャ（8バイト）の後の IHDR チャンクの幅、高さを書き換えて CRC を計算し直す
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[16:20], 10000)
+	binary.BigEndian.PutUint32(b[20:24], 10000)
+	binary.BigEndian.PutUint32(b[29:33], crc32.ChecksumIEEE(b[12:29]))
+
+	return b
+}
+
+//nolint:funlen
+func TestNearDuplicate(t *testing.T) {
+	const imgPath = "../../test/images/abyssinian-cat.jpg"
+	const targetS3ObjectKey = "tmp/abyssinian-cat.jpg"
+	const existingS3ObjectKey = "cat-images/existing-abyssinian-cat.jpg"
+
+	b, err := os.ReadFile(imgPath)
+	if err != nil {
+		t.Fatal("Error failed to os.ReadFile", err)
+	}
+
+	img, _, err := imageprocessing.Decode(b)
+	if err != nil {
+		t.Fatal("Error failed to imageprocessing.Decode", err)
+	}
+
+	hash := imageprocessing.DHash(img)
+
+	newPolicy := func(action NearDuplicateAction) *Policy {
+		policy := DefaultPolicy()
+		policy.ModerationLabels = nil
+		policy.NearDuplicate = &NearDuplicateRule{MaxDistance: 5, Action: action}
+
+		return policy
+	}
+
+	// 画像形式の判定、ラベルの検出、知覚ハッシュの計算の為に画像全体を取得する
+	expectEvaluation := func(
+		ctx context.Context,
+		mockS3Client *mock.MockS3Client,
+		mockRekognitionClient *mock.MockRekognitionClient,
+	) {
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(targetS3ObjectKey)).Return(newGetObjectOutput(t, imgPath), nil)
+		mockRekognitionClient.EXPECT().
+			DetectLabels(ctx, newDetectLabelsInput(targetS3ObjectKey)).
+			Return(newAcceptableCatLabelsOutput(), nil)
+		mockS3Client.EXPECT().GetObject(ctx, &s3.GetObjectInput{
+			Bucket:    aws.String(expectedTriggerBucketName),
+			Key:       aws.String(targetS3ObjectKey),
+			VersionId: aws.String(expectedTargetS3ObjectVersionId),
+		}).Return(newGetObjectOutput(t, imgPath), nil)
+	}
+
+	req := &Request{
+		TargetS3BucketName:      expectedTriggerBucketName,
+		TargetS3ObjectKey:       targetS3ObjectKey,
+		TargetS3ObjectVersionId: expectedTargetS3ObjectVersionId,
+	}
+
+	tests := []struct {
+		name               string
+		action             NearDuplicateAction
+		indexedKey         string
+		expectedAcceptable bool
+		expectedDuplicate  *NearDuplicate
+	}{
+		{
+			name:               "Successful reject the near duplicate",
+			action:             NearDuplicateActionReject,
+			indexedKey:         existingS3ObjectKey,
+			expectedAcceptable: false,
+			expectedDuplicate:  &NearDuplicate{S3ObjectKey: existingS3ObjectKey, Distance: 0},
+		},
+		{
+			name:               "Successful flag the near duplicate",
+			action:             NearDuplicateActionFlag,
+			indexedKey:         existingS3ObjectKey,
+			expectedAcceptable: true,
+			expectedDuplicate:  &NearDuplicate{S3ObjectKey: existingS3ObjectKey, Distance: 0},
+		},
+		{
+			name:               "Successful ignore the image itself added in the previous attempt",
+			action:             NearDuplicateActionReject,
+			indexedKey:         catImageKey(targetS3ObjectKey),
+			expectedAcceptable: true,
+			expectedDuplicate:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+
+			mockS3Client := mock.NewMockS3Client(ctrl)
+			mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+			expectEvaluation(ctx, mockS3Client, mockRekognitionClient)
+
+			index := infrastructure.NewMemoryPerceptualHashIndex()
+			_ = index.Add(ctx, tt.indexedKey, hash)
+
+			u := UseCase{
+				S3Client:            mockS3Client,
+				RekognitionClient:   mockRekognitionClient,
+				Policy:              newPolicy(tt.action),
+				PerceptualHashIndex: index,
+			}
+
+			res, err := u.IsAcceptableCatImage(ctx, req)
+			if err != nil {
+				t.Fatal("Error failed to IsAcceptableCatImage", err)
+			}
+
+			if res.IsAcceptableCatImage != tt.expectedAcceptable {
+				t.Error("\nActually: ", res.IsAcceptableCatImage, "\nExpected: ", tt.expectedAcceptable)
+			}
+
+			if reflect.DeepEqual(res.NearDuplicate, tt.expectedDuplicate) == false {
+				t.Error("\nActually: ", res.NearDuplicate, "\nExpected: ", tt.expectedDuplicate)
+			}
+
+			if res.PerceptualHash != fmt.Sprintf("%016x", hash) {
+				t.Error("\nActually: ", res.PerceptualHash, "\nExpected: ", fmt.Sprintf("%016x", hash))
+			}
+
+			if !tt.expectedAcceptable && res.RejectionReasons[0].Code != RejectionReasonNearDuplicate {
+				t.Error("\nActually: ", res.RejectionReasons, "\nExpected: ", RejectionReasonNearDuplicate)
+			}
+		})
+	}
+
+	t.Run("Successful accept the image with too many pixels to calculate the perceptual hash", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		const pngS3ObjectKey = "tmp/too-many-pixels.png"
+
+		b := newTooManyPixelsPng(t)
+		newOutput := func() *s3.GetObjectOutput {
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(b))}
+		}
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(pngS3ObjectKey)).Return(newOutput(), nil)
+		mockRekognitionClient.EXPECT().
+			DetectLabels(ctx, newDetectLabelsInput(pngS3ObjectKey)).
+			Return(newAcceptableCatLabelsOutput(), nil)
+		mockS3Client.EXPECT().GetObject(ctx, gomock.Any()).Return(newOutput(), nil)
+
+		var logBuf bytes.Buffer
+
+		u := UseCase{
+			S3Client:            mockS3Client,
+			RekognitionClient:   mockRekognitionClient,
+			Policy:              newPolicy(NearDuplicateActionReject),
+			PerceptualHashIndex: infrastructure.NewMemoryPerceptualHashIndex(),
+			Logger:              logging.New(&logBuf, logging.LevelInfo),
+		}
+
+		res, err := u.IsAcceptableCatImage(ctx, &Request{
+			TargetS3BucketName:      expectedTriggerBucketName,
+			TargetS3ObjectKey:       pngS3ObjectKey,
+			TargetS3ObjectVersionId: expectedTargetS3ObjectVersionId,
+		})
+		if err != nil {
+			t.Fatal("Error failed to IsAcceptableCatImage", err)
+		}
+
+		if !res.IsAcceptableCatImage || res.PerceptualHash != "" {
+			t.Error("\nActually: ", res, "\nExpected: ", "acceptable without the perceptual hash")
+		}
+
+		if !strings.Contains(logBuf.String(), imageprocessing.ErrTooManyPixels.Error()) {
+			t.Error("\nActually: ", logBuf.String(), "\nExpected: ", imageprocessing.ErrTooManyPixels)
+		}
+	})
+
+	t.Run("Successful add the copied image to the index", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockS3Client.EXPECT().CopyObject(ctx, gomock.Any()).Return(&s3.CopyObjectOutput{}, nil)
+
+		index := infrastructure.NewMemoryPerceptualHashIndex()
+
+		u := UseCase{S3Client: mockS3Client, PerceptualHashIndex: index}
+
+		err := u.CopyCatImageToDestinationBucket(ctx, &CopyCatImageToDestinationBucketRequest{
+			TriggerBucketName:     expectedTriggerBucketName,
+			DestinationBucketName: expectedTriggerBucketName,
+			TargetS3ObjectKey:     targetS3ObjectKey,
+			PerceptualHash:        fmt.Sprintf("%016x", hash),
+		})
+		if err != nil {
+			t.Fatal("Error failed to CopyCatImageToDestinationBucket", err)
+		}
+
+		matches, _ := index.FindSimilar(ctx, hash, 0)
+
+		expected := []infrastructure.PerceptualHashMatch{{S3ObjectKey: "cat-images/abyssinian-cat.jpg", Distance: 0}}
+		if reflect.DeepEqual(matches, expected) == false {
+			t.Error("\nActually: ", matches, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Failure the invalid near duplicate action", func(t *testing.T) {
+		policyJson := `{"maxLabels":10,"minConfidence":85,"nearDuplicate":{"maxDistance":5,"action":"delete"}}`
+
+		_, err := ParsePolicy([]byte(policyJson))
+		if !errors.Is(err, ErrInvalidPolicy) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrInvalidPolicy)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package catimage
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/pkg/errors"
+)
+
+type Decision string
+
+const (
+	DecisionAccepted Decision = "accepted"
+	DecisionRejected Decision = "rejected"
+)
+
+var ErrNotifyDecision = errors.New("failed to notify decision")
+
+// DecisionNotification は判定結果をWebhookで通知する際のペイロード
+type DecisionNotification struct {
+	ImageId          string            `json:"imageId"`
+	S3ObjectKey      string            `json:"s3ObjectKey"`
+	Decision         Decision          `json:"decision"`
+	TypesOfCats      []string          `json:"typesOfCats"`
+	RejectionReasons []RejectionReason `json:"rejectionReasons"`
+	DecidedAt        time.Time         `json:"decidedAt"`
+}
+
+type NotifyDecisionRequest struct {
+	TargetS3ObjectKey string
+	Response          *IsAcceptableCatImageResponse
+	// Timeout が設定されている場合はリトライを含めた通知をこの時間で打ち切る
+	// 通知に失敗した場合の PendingNotificationStore への保存は打ち切らない
+	Timeout time.Duration
+}
+
+// NotifyDecision は判定結果を WebhookUrls の全てにPOSTする
+// 一部のURLへの通知に失敗しても残りのURLには通知し、失敗したURLをまとめてエラーとして返す
+// PendingNotificationStore が設定されている場合は、失敗したURLとボディを RedeliverPendingNotification で再送出来るように保存する
+// WebhookSender, WebhookUrls が設定されていない場合は何もしない
+func (u *UseCase) NotifyDecision(ctx context.Context, req *NotifyDecisionRequest) error {
+	if u.WebhookSender == nil || len(u.WebhookUrls) == 0 {
+		return nil
+	}
+
+	decision := DecisionRejected
+	if req.Response.IsAcceptableCatImage {
+		decision = DecisionAccepted
+	}
+
+	notification := &DecisionNotification{
+		ImageId:          infrastructure.ImageIdFromS3ObjectKey(req.TargetS3ObjectKey),
+		S3ObjectKey:      req.TargetS3ObjectKey,
+		Decision:         decision,
+		TypesOfCats:      req.Response.TypesOfCats,
+		RejectionReasons: req.Response.RejectionReasons,
+		DecidedAt:        time.Now().UTC(),
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return errors.Wrap(err, "failed to json.Marshal")
+	}
+
+	return u.sendNotification(ctx, req.TargetS3ObjectKey, u.WebhookUrls, body, req.Timeout)
+}
+
+type RedeliverPendingNotificationRequest struct {
+	TargetS3ObjectKey string
+	// Timeout が設定されている場合はリトライを含めた再送をこの時間で打ち切る
+	Timeout time.Duration
+}
+
+// RedeliverPendingNotification は NotifyDecision で通知に失敗したURLに、保存しておいたボディを再送する
+// 全てのURLに再送出来た場合は保存した内容を削除し、再送にも失敗したURLだけを残す
+// 再送待ちの通知が無い場合、PendingNotificationStore, WebhookSender が設定されていない場合は何もしない
+func (u *UseCase) RedeliverPendingNotification(ctx context.Context, req *RedeliverPendingNotificationRequest) error {
+	if u.PendingNotificationStore == nil || u.WebhookSender == nil {
+		return nil
+	}
+
+	pending, err := u.PendingNotificationStore.Find(ctx, req.TargetS3ObjectKey)
+	if errors.Is(err, infrastructure.ErrPendingNotificationNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "failed to PendingNotificationStore.Find")
+	}
+
+	err = u.sendNotification(ctx, req.TargetS3ObjectKey, pending.Urls, pending.Body, req.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if err := u.PendingNotificationStore.Delete(ctx, req.TargetS3ObjectKey); err != nil {
+		return errors.Wrap(err, "failed to PendingNotificationStore.Delete")
+	}
+
+	return nil
+}
+
+// sendNotification は body を urls の全てにPOSTし、失敗したURLがある場合はそれを PendingNotificationStore に保存する
+func (u *UseCase) sendNotification(
+	ctx context.Context,
+	key string,
+	urls []string,
+	body []byte,
+	timeout time.Duration,
+) error {
+	sendCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		sendCtx, cancel = context.WithTimeout(ctx, timeout)
+
+		defer cancel()
+	}
+
+	var failedUrls, failedMessages []string
+
+	for _, webhookUrl := range urls {
+		if err := u.WebhookSender.Send(sendCtx, webhookUrl, body); err != nil {
+			failedUrls = append(failedUrls, webhookUrl)
+			failedMessages = append(failedMessages, err.Error())
+		}
+	}
+
+	if len(failedUrls) == 0 {
+		return nil
+	}
+
+	err := errors.Wrap(ErrNotifyDecision, strings.Join(failedMessages, ", "))
+
+	if u.PendingNotificationStore != nil {
+		pending := &infrastructure.PendingNotification{Urls: failedUrls, Body: body}
+		if saveErr := u.PendingNotificationStore.Save(ctx, key, pending); saveErr != nil {
+			return errors.Wrap(err, "failed to PendingNotificationStore.Save: "+saveErr.Error())
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,198 @@
+package catimage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/pkg/errors"
+)
+
+//nolint:funlen
+func TestNotifyDecision(t *testing.T) {
+	const imageId = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+	const targetS3ObjectKey = "tmp/" + imageId + ".jpg"
+	const secret = "test-secret"
+
+	t.Run("Successful notify the rejected decision to the webhook server", func(t *testing.T) {
+		received := make(chan *http.Request, 1)
+		receivedBody := make(chan []byte, 1)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			received <- r
+			receivedBody <- b
+
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		u := UseCase{
+			WebhookSender: &infrastructure.HttpWebhookSender{Secret: secret},
+			WebhookUrls:   []string{server.URL},
+		}
+
+		rejectionReasons := []RejectionReason{
+			{Code: RejectionReasonRequiredLabelMissing, Message: "Cat is not detected"},
+		}
+
+		err := u.NotifyDecision(context.Background(), &NotifyDecisionRequest{
+			TargetS3ObjectKey: targetS3ObjectKey,
+			Response:          &IsAcceptableCatImageResponse{RejectionReasons: rejectionReasons},
+		})
+		if err != nil {
+			t.Fatal("Error failed to NotifyDecision", err)
+		}
+
+		r := <-received
+		b := <-receivedBody
+
+		timestamp := r.Header.Get(infrastructure.WebhookTimestampHeader)
+		signature := r.Header.Get(infrastructure.WebhookSignatureHeader)
+		expectedSignature := "sha256=" + infrastructure.SignWebhookPayload(secret, timestamp, b)
+		if signature != expectedSignature {
+			t.Error("\nActually: ", signature, "\nExpected: ", expectedSignature)
+		}
+
+		var notification DecisionNotification
+		if err := json.Unmarshal(b, &notification); err != nil {
+			t.Fatal("Error failed to json.Unmarshal", err)
+		}
+
+		expected := DecisionNotification{
+			ImageId:          imageId,
+			S3ObjectKey:      targetS3ObjectKey,
+			Decision:         DecisionRejected,
+			RejectionReasons: rejectionReasons,
+			DecidedAt:        notification.DecidedAt,
+		}
+
+		if reflect.DeepEqual(notification, expected) == false || notification.DecidedAt.IsZero() {
+			t.Error("\nActually: ", notification, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful notify the other webhooks even if one of them fails", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		var decisions []Decision
+
+		captureDecision := func(_ context.Context, _ string, body []byte) error {
+			var notification DecisionNotification
+			if err := json.Unmarshal(body, &notification); err != nil {
+				t.Fatal("Error failed to json.Unmarshal", err)
+			}
+
+			decisions = append(decisions, notification.Decision)
+
+			return nil
+		}
+
+		expected := errors.New("failed webhookSender send")
+
+		mockWebhookSender := mock.NewMockWebhookSender(ctrl)
+		gomock.InOrder(
+			mockWebhookSender.EXPECT().Send(ctx, "https://example.com/1", gomock.Any()).Return(expected),
+			mockWebhookSender.EXPECT().Send(ctx, "https://example.com/2", gomock.Any()).DoAndReturn(captureDecision),
+		)
+
+		u := UseCase{
+			WebhookSender: mockWebhookSender,
+			WebhookUrls:   []string{"https://example.com/1", "https://example.com/2"},
+		}
+
+		err := u.NotifyDecision(ctx, &NotifyDecisionRequest{
+			TargetS3ObjectKey: targetS3ObjectKey,
+			Response:          &IsAcceptableCatImageResponse{IsAcceptableCatImage: true, TypesOfCats: []string{"Manx"}},
+		})
+		if !errors.Is(err, ErrNotifyDecision) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrNotifyDecision)
+		}
+
+		if reflect.DeepEqual(decisions, []Decision{DecisionAccepted}) == false {
+			t.Error("\nActually: ", decisions, "\nExpected: ", []Decision{DecisionAccepted})
+		}
+	})
+
+	t.Run("Successful redeliver the pending notification only to the failed webhook", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		var bodies [][]byte
+
+		captureBody := func(_ context.Context, _ string, body []byte) error {
+			bodies = append(bodies, body)
+
+			return nil
+		}
+
+		mockWebhookSender := mock.NewMockWebhookSender(ctrl)
+		gomock.InOrder(
+			mockWebhookSender.EXPECT().
+				Send(ctx, "https://example.com/1", gomock.Any()).
+				Return(errors.New("failed webhookSender send")),
+			mockWebhookSender.EXPECT().Send(ctx, "https://example.com/2", gomock.Any()).DoAndReturn(captureBody),
+			// 再送は失敗したURLだけに、最初に送ったボディのまま行う
+			mockWebhookSender.EXPECT().Send(ctx, "https://example.com/1", gomock.Any()).DoAndReturn(captureBody),
+		)
+
+		pendingNotificationStore := infrastructure.NewMemoryPendingNotificationStore()
+
+		u := UseCase{
+			WebhookSender:            mockWebhookSender,
+			WebhookUrls:              []string{"https://example.com/1", "https://example.com/2"},
+			PendingNotificationStore: pendingNotificationStore,
+		}
+
+		err := u.NotifyDecision(ctx, &NotifyDecisionRequest{
+			TargetS3ObjectKey: targetS3ObjectKey,
+			Response:          &IsAcceptableCatImageResponse{IsAcceptableCatImage: true, TypesOfCats: []string{"Manx"}},
+		})
+		if !errors.Is(err, ErrNotifyDecision) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrNotifyDecision)
+		}
+
+		err = u.RedeliverPendingNotification(ctx, &RedeliverPendingNotificationRequest{
+			TargetS3ObjectKey: targetS3ObjectKey,
+		})
+		if err != nil {
+			t.Fatal("Error failed to RedeliverPendingNotification", err)
+		}
+
+		if len(bodies) != 2 || reflect.DeepEqual(bodies[0], bodies[1]) == false {
+			t.Error("\nActually: ", bodies, "\nExpected: ", "the same body twice")
+		}
+
+		_, err = pendingNotificationStore.Find(ctx, targetS3ObjectKey)
+		if !errors.Is(err, infrastructure.ErrPendingNotificationNotFound) {
+			t.Error("\nActually: ", err, "\nExpected: ", infrastructure.ErrPendingNotificationNotFound)
+		}
+	})
+
+	t.Run("Successful do nothing when the webhook urls are not set", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		u := UseCase{WebhookSender: mock.NewMockWebhookSender(ctrl)}
+
+		err := u.NotifyDecision(context.Background(), &NotifyDecisionRequest{
+			TargetS3ObjectKey: targetS3ObjectKey,
+			Response:          &IsAcceptableCatImageResponse{},
+		})
+		if err != nil {
+			t.Error("\nActually: ", err, "\nExpected: ", nil)
+		}
+	})
+}
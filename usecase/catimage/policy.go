@@ -0,0 +1,475 @@
+package catimage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/pkg/errors"
+)
+
+// LabelRule はラベル名と信頼度（Confidence）の閾値の組み合わせ
+// ラベルの Confidence が ConfidenceThreshold より大きい場合にルールに一致したと見なす
+type LabelRule struct {
+	Name                string  `json:"name"`
+	ConfidenceThreshold float32 `json:"confidenceThreshold"`
+}
+
+// InstanceCountRule はラベルが画像内に何個写っているか（Label.Instances の数）の条件
+// Min, Max は省略可能で、省略した場合はその方向の制限は無い
+type InstanceCountRule struct {
+	Name string `json:"name"`
+	Min  *int   `json:"min,omitempty"`
+	Max  *int   `json:"max,omitempty"`
+}
+
+// Policy は受け入れ可能なねこ画像かどうかを判定する為の条件
+// JSONファイルから読み込む事が出来る、読み込み時に Validate で内容を検証する
+type Policy struct {
+	// 何個までラベルを取得するかの設定、ラベルは信頼度が高い順に並んでいる
+	MaxLabels int32 `json:"maxLabels"`
+	// 信頼度の閾値、Confidenceがここで設定した値未満の場合、そのラベルはレスポンスに含まれない
+	MinConfidence float32 `json:"minConfidence"`
+	// 全て満たす必要があるラベル
+	RequiredLabels []LabelRule `json:"requiredLabels,omitempty"`
+	// 1つでも一致した場合は受け入れ不可とするラベル .e.g. "Person", "Text"
+	ForbiddenLabels []LabelRule `json:"forbiddenLabels,omitempty"`
+	// ラベルが画像内に何個写っているかの条件
+	InstanceCounts []InstanceCountRule `json:"instanceCounts,omitempty"`
+	// 空ではない場合、判別されたねこの種類が全てこの中に含まれている必要がある
+	AllowedBreeds []string `json:"allowedBreeds,omitempty"`
+	// 不適切なコンテンツのカテゴリ毎の閾値、1つでも一致した場合は受け入れ不可とする
+	// Name にはRekognitionのモデレーションラベル名を指定する、上位カテゴリ .e.g. "Violence" を指定した場合は配下のラベルも対象になる
+	// 空の場合はモデレーションの判定は行わない
+	ModerationLabels []LabelRule `json:"moderationLabels,omitempty"`
+	// 受け入れ済みの画像とほぼ同じ画像の扱い、省略した場合は判定しない
+	NearDuplicate *NearDuplicateRule `json:"nearDuplicate,omitempty"`
+}
+
+type RejectionReasonCode string
+
+const (
+	RejectionReasonRequiredLabelMissing     RejectionReasonCode = "required-label-missing"
+	RejectionReasonBelowConfidenceThreshold RejectionReasonCode = "below-confidence-threshold"
+	RejectionReasonForbiddenLabel           RejectionReasonCode = "forbidden-label"
+	RejectionReasonInstanceCount            RejectionReasonCode = "instance-count"
+	RejectionReasonBreedNotAllowed          RejectionReasonCode = "breed-not-allowed"
+	RejectionReasonModeration               RejectionReasonCode = "moderation"
+	RejectionReasonNearDuplicate            RejectionReasonCode = "near-duplicate"
+)
+
+// RejectionReason は受け入れ不可と判定された理由
+type RejectionReason struct {
+	Code    RejectionReasonCode `json:"code"`
+	Message string              `json:"message"`
+}
+
+const (
+	catLabelName        = "Cat"
+	maxConfidence       = float32(100)
+	maxLabelsUpperLimit = int32(1000)
+)
+
+var ErrInvalidPolicy = errors.New("invalid cat image policy")
+
+// DefaultPolicy は "Cat" ラベルの Confidence が90より大きく、不適切なコンテンツが含まれていない場合に受け入れ可能とする
+// PerceptualHashIndex が設定されている場合は、受け入れ済みの画像とほぼ同じ画像も受け入れ不可とする
+func DefaultPolicy() *Policy {
+	const maxLabels = int32(10)
+	const minConfidence = float32(85)
+	const catConfidenceThreshold = float32(90)
+	const moderationConfidenceThreshold = float32(60)
+	const nearDuplicateMaxDistance = 5
+
+	return &Policy{
+		MaxLabels:     maxLabels,
+		MinConfidence: minConfidence,
+		RequiredLabels: []LabelRule{
+			{Name: catLabelName, ConfidenceThreshold: catConfidenceThreshold},
+		},
+		ModerationLabels: []LabelRule{
+			{Name: "Explicit Nudity", ConfidenceThreshold: moderationConfidenceThreshold},
+			{Name: "Violence", ConfidenceThreshold: moderationConfidenceThreshold},
+			{Name: "Visually Disturbing", ConfidenceThreshold: moderationConfidenceThreshold},
+			{Name: "Hate Symbols", ConfidenceThreshold: moderationConfidenceThreshold},
+		},
+		NearDuplicate: &NearDuplicateRule{MaxDistance: nearDuplicateMaxDistance, Action: NearDuplicateActionReject},
+	}
+}
+
+func LoadPolicy(policyPath string) (*Policy, error) {
+	policyJson, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to os.ReadFile")
+	}
+
+	return ParsePolicy(policyJson)
+}
+
+// ParsePolicy は未定義のフィールドが含まれている場合もタイプミスの可能性が高いのでエラーにする
+func ParsePolicy(policyJson []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(policyJson))
+	decoder.DisallowUnknownFields()
+
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, errors.Wrap(ErrInvalidPolicy, err.Error())
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+//nolint:gocyclo
+func (p *Policy) Validate() error {
+	if p.MaxLabels < 1 || p.MaxLabels > maxLabelsUpperLimit {
+		return errors.Wrap(ErrInvalidPolicy, fmt.Sprintf("maxLabels must be between 1 and %d", maxLabelsUpperLimit))
+	}
+
+	if !isValidConfidence(p.MinConfidence) {
+		return errors.Wrap(ErrInvalidPolicy, "minConfidence must be between 0 and 100")
+	}
+
+	requiredLabelNames := map[string]bool{}
+	for _, rule := range p.RequiredLabels {
+		if err := rule.validate("requiredLabels"); err != nil {
+			return err
+		}
+
+		requiredLabelNames[rule.Name] = true
+	}
+
+	for _, rule := range p.ForbiddenLabels {
+		if err := rule.validate("forbiddenLabels"); err != nil {
+			return err
+		}
+
+		if requiredLabelNames[rule.Name] {
+			return errors.Wrap(ErrInvalidPolicy, rule.Name+" is both required and forbidden")
+		}
+	}
+
+	for _, rule := range p.InstanceCounts {
+		if rule.Name == "" {
+			return errors.Wrap(ErrInvalidPolicy, "instanceCounts name is empty")
+		}
+
+		if rule.Min == nil && rule.Max == nil {
+			return errors.Wrap(ErrInvalidPolicy, "instanceCounts "+rule.Name+" must have min or max")
+		}
+
+		if (rule.Min != nil && *rule.Min < 0) || (rule.Max != nil && *rule.Max < 0) {
+			return errors.Wrap(ErrInvalidPolicy, "instanceCounts "+rule.Name+" must not be negative")
+		}
+
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return errors.Wrap(ErrInvalidPolicy, "instanceCounts "+rule.Name+" min is greater than max")
+		}
+	}
+
+	for _, rule := range p.ModerationLabels {
+		if err := rule.validate("moderationLabels"); err != nil {
+			return err
+		}
+	}
+
+	for _, breed := range p.AllowedBreeds {
+		if breed == "" {
+			return errors.Wrap(ErrInvalidPolicy, "allowedBreeds contains an empty name")
+		}
+	}
+
+	if p.NearDuplicate != nil {
+		if err := p.NearDuplicate.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r LabelRule) validate(field string) error {
+	if r.Name == "" {
+		return errors.Wrap(ErrInvalidPolicy, field+" name is empty")
+	}
+
+	if !isValidConfidence(r.ConfidenceThreshold) {
+		return errors.Wrap(ErrInvalidPolicy, field+" "+r.Name+" confidenceThreshold must be between 0 and 100")
+	}
+
+	return nil
+}
+
+func isValidConfidence(confidence float32) bool {
+	return confidence >= 0 && confidence <= maxConfidence
+}
+
+// Evaluate はRekognitionのラベルを元に受け入れ可能なねこ画像かどうかを判定する
+// 受け入れ不可の場合は全ての理由を RejectionReasons に設定する
+func (p *Policy) Evaluate(labels []types.Label) *IsAcceptableCatImageResponse {
+	response := &IsAcceptableCatImageResponse{
+		IsAcceptableCatImage: false,
+		TypesOfCats:          extractTypesOfCats(labels),
+		Cats:                 extractCats(labels),
+	}
+
+	response.CatCount = len(response.Cats)
+
+	var reasons []RejectionReason
+
+	reasons = append(reasons, p.evaluateRequiredLabels(labels)...)
+	reasons = append(reasons, p.evaluateForbiddenLabels(labels)...)
+	reasons = append(reasons, p.evaluateInstanceCounts(labels)...)
+	reasons = append(reasons, p.evaluateBreeds(response.TypesOfCats)...)
+
+	response.IsAcceptableCatImage = len(reasons) == 0
+	response.RejectionReasons = reasons
+
+	return response
+}
+
+// ModerationMinConfidence はモデレーションラベルを取得する際の信頼度の下限
+// 全てのカテゴリの閾値のうち最も低い値を利用する
+func (p *Policy) ModerationMinConfidence() float32 {
+	minConfidence := maxConfidence
+	for _, rule := range p.ModerationLabels {
+		if rule.ConfidenceThreshold < minConfidence {
+			minConfidence = rule.ConfidenceThreshold
+		}
+	}
+
+	return minConfidence
+}
+
+// EvaluateModerationLabels は閾値を超えた不適切なコンテンツのカテゴリを response に設定する
+// 1つでも該当した場合は受け入れ不可とする
+func (p *Policy) EvaluateModerationLabels(
+	response *IsAcceptableCatImageResponse,
+	moderationLabels []types.ModerationLabel,
+) {
+	for _, rule := range p.ModerationLabels {
+		label := findModerationLabel(moderationLabels, rule)
+		if label == nil {
+			continue
+		}
+
+		response.ModerationLabels = append(response.ModerationLabels, rule.Name)
+		response.RejectionReasons = append(response.RejectionReasons, RejectionReason{
+			Code:    RejectionReasonModeration,
+			Message: fmt.Sprintf("%s is detected with confidence %.2f", *label.Name, *label.Confidence),
+		})
+	}
+
+	response.IsAcceptableCatImage = response.IsAcceptableCatImage && len(response.ModerationLabels) == 0
+}
+
+func (p *Policy) evaluateRequiredLabels(labels []types.Label) []RejectionReason {
+	var reasons []RejectionReason
+
+	for _, rule := range p.RequiredLabels {
+		label := findLabel(labels, rule.Name)
+		if label == nil {
+			reasons = append(reasons, RejectionReason{
+				Code:    RejectionReasonRequiredLabelMissing,
+				Message: rule.Name + " is not detected",
+			})
+
+			continue
+		}
+
+		if *label.Confidence <= rule.ConfidenceThreshold {
+			reasons = append(reasons, RejectionReason{
+				Code: RejectionReasonBelowConfidenceThreshold,
+				Message: fmt.Sprintf(
+					"%s confidence %.2f is not greater than %.2f",
+					rule.Name,
+					*label.Confidence,
+					rule.ConfidenceThreshold,
+				),
+			})
+		}
+	}
+
+	return reasons
+}
+
+func (p *Policy) evaluateForbiddenLabels(labels []types.Label) []RejectionReason {
+	var reasons []RejectionReason
+
+	for _, rule := range p.ForbiddenLabels {
+		label := findLabel(labels, rule.Name)
+		if label != nil && *label.Confidence > rule.ConfidenceThreshold {
+			reasons = append(reasons, RejectionReason{
+				Code:    RejectionReasonForbiddenLabel,
+				Message: fmt.Sprintf("%s is detected with confidence %.2f", rule.Name, *label.Confidence),
+			})
+		}
+	}
+
+	return reasons
+}
+
+func (p *Policy) evaluateInstanceCounts(labels []types.Label) []RejectionReason {
+	var reasons []RejectionReason
+
+	for _, rule := range p.InstanceCounts {
+		count := 0
+		if label := findLabel(labels, rule.Name); label != nil {
+			count = len(label.Instances)
+		}
+
+		if (rule.Min != nil && count < *rule.Min) || (rule.Max != nil && count > *rule.Max) {
+			reasons = append(reasons, RejectionReason{
+				Code:    RejectionReasonInstanceCount,
+				Message: fmt.Sprintf("%d instances of %s are detected", count, rule.Name),
+			})
+		}
+	}
+
+	return reasons
+}
+
+func (p *Policy) evaluateBreeds(typesOfCats []string) []RejectionReason {
+	if len(p.AllowedBreeds) == 0 {
+		return nil
+	}
+
+	if len(typesOfCats) == 0 {
+		return []RejectionReason{{
+			Code:    RejectionReasonBreedNotAllowed,
+			Message: "breed of cat is not detected",
+		}}
+	}
+
+	var reasons []RejectionReason
+
+	for _, typeOfCat := range typesOfCats {
+		if !p.isAllowedBreed(typeOfCat) {
+			reasons = append(reasons, RejectionReason{
+				Code:    RejectionReasonBreedNotAllowed,
+				Message: typeOfCat + " is not allowed",
+			})
+		}
+	}
+
+	return reasons
+}
+
+func (p *Policy) isAllowedBreed(typeOfCat string) bool {
+	for _, v := range p.AllowedBreeds {
+		if v == typeOfCat {
+			return true
+		}
+	}
+
+	return false
+}
+
+func findLabel(labels []types.Label, name string) *types.Label {
+	for i := range labels {
+		if labels[i].Name != nil && *labels[i].Name == name && labels[i].Confidence != nil {
+			return &labels[i]
+		}
+	}
+
+	return nil
+}
+
+// findModerationLabel はカテゴリ名、またはその配下のラベル（孫以下も含む）のうち閾値を超えた最初のラベルを返す
+func findModerationLabel(moderationLabels []types.ModerationLabel, rule LabelRule) *types.ModerationLabel {
+	parents := map[string]string{}
+	for _, label := range moderationLabels {
+		if label.Name != nil && label.ParentName != nil {
+			parents[*label.Name] = *label.ParentName
+		}
+	}
+
+	for i := range moderationLabels {
+		label := &moderationLabels[i]
+		if label.Name == nil || label.Confidence == nil {
+			continue
+		}
+
+		if isModerationLabelUnder(*label.Name, rule.Name, parents) && *label.Confidence > rule.ConfidenceThreshold {
+			return label
+		}
+	}
+
+	return nil
+}
+
+// isModerationLabelUnder は name が category 自身か、ParentName を辿った祖先に category が含まれるかどうか
+// 各ラベルは直接の親しか持たないので、親のラベルもレスポンスに含まれている場合だけ祖先まで辿れる
+func isModerationLabelUnder(name string, category string, parents map[string]string) bool {
+	// 不正なレスポンスで親子関係が循環していても止まるように、辿る回数はラベルの数までにする
+	for i := 0; i <= len(parents); i++ {
+		if name == category {
+			return true
+		}
+
+		parent, ok := parents[name]
+		if !ok || parent == "" {
+			return false
+		}
+
+		name = parent
+	}
+
+	return false
+}
+
+// extractCats は "Cat" ラベルの Instances からねこ1匹ずつの位置と信頼度を取り出す
+// Rekognitionが位置を特定出来なかった場合は BoundingBox が空になる
+func extractCats(labels []types.Label) []CatInstance {
+	label := findLabel(labels, catLabelName)
+	if label == nil {
+		return nil
+	}
+
+	var cats []CatInstance
+
+	for _, instance := range label.Instances {
+		cat := CatInstance{}
+
+		if instance.Confidence != nil {
+			cat.Confidence = *instance.Confidence
+		}
+
+		if box := instance.BoundingBox; box != nil {
+			cat.BoundingBox = BoundingBox{
+				Width:  aws.ToFloat32(box.Width),
+				Height: aws.ToFloat32(box.Height),
+				Left:   aws.ToFloat32(box.Left),
+				Top:    aws.ToFloat32(box.Top),
+			}
+		}
+
+		cats = append(cats, cat)
+	}
+
+	return cats
+}
+
+// extractTypesOfCats はねこの種類を判別する
+// label.Parents に "Cat" が含まれていれば、そのラベルはねこの種類という事にしている
+// .e.g. test/images/abyssinian-cat.jpg の場合は ["Abyssinian"]
+// .e.g. test/images/manx-cat.jpg の場合は ["Manx"]
+func extractTypesOfCats(labels []types.Label) []string {
+	var typesOfCats []string
+
+	for _, label := range labels {
+		for _, parent := range label.Parents {
+			if *parent.Name == catLabelName {
+				typesOfCats = append(typesOfCats, *label.Name)
+			}
+		}
+	}
+
+	return typesOfCats
+}
@@ -0,0 +1,248 @@
+package catimage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/pkg/errors"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	t.Run("Successful the default policy file is the same as DefaultPolicy", func(t *testing.T) {
+		policy, err := LoadPolicy("../../config/cat_image_policy.json")
+		if err != nil {
+			t.Fatal("Error failed to LoadPolicy", err)
+		}
+
+		expected := DefaultPolicy()
+		if reflect.DeepEqual(policy, expected) == false {
+			t.Error("\nActually: ", policy, "\nExpected: ", expected)
+		}
+	})
+
+	invalidPolicyTests := []struct {
+		name       string
+		policyJson string
+	}{
+		{name: "unknown field", policyJson: `{"maxLabels": 10, "minConfidence": 85, "requiredLabel": []}`},
+		{name: "maxLabels is zero", policyJson: `{"maxLabels": 0, "minConfidence": 85}`},
+		{name: "minConfidence is over 100", policyJson: `{"maxLabels": 10, "minConfidence": 101}`},
+		{
+			name:       "required label name is empty",
+			policyJson: `{"maxLabels": 10, "minConfidence": 85, "requiredLabels": [{"confidenceThreshold": 90}]}`,
+		},
+		{
+			name: "label is both required and forbidden",
+			policyJson: `{"maxLabels": 10, "minConfidence": 85,
+				"requiredLabels": [{"name": "Cat", "confidenceThreshold": 90}],
+				"forbiddenLabels": [{"name": "Cat", "confidenceThreshold": 90}]}`,
+		},
+		{
+			name:       "instance count min is greater than max",
+			policyJson: `{"maxLabels": 10, "minConfidence": 85, "instanceCounts": [{"name": "Cat", "min": 2, "max": 1}]}`,
+		},
+		{
+			name:       "instance count has neither min nor max",
+			policyJson: `{"maxLabels": 10, "minConfidence": 85, "instanceCounts": [{"name": "Cat"}]}`,
+		},
+	}
+
+	for _, tt := range invalidPolicyTests {
+		tt := tt
+		t.Run("Failure "+tt.name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(tt.policyJson))
+			expected := ErrInvalidPolicy
+			if !errors.Is(err, expected) {
+				t.Error("\nActually: ", err, "\nExpected: ", expected)
+			}
+		})
+	}
+}
+
+//nolint:funlen
+func TestPolicyEvaluate(t *testing.T) {
+	labels := []types.Label{
+		{
+			Confidence: aws.Float32(98),
+			Name:       aws.String("Cat"),
+			Instances: []types.Instance{
+				{
+					BoundingBox: &types.BoundingBox{
+						Width:  aws.Float32(0.5),
+						Height: aws.Float32(0.25),
+						Left:   aws.Float32(0.125),
+						Top:    aws.Float32(0.375),
+					},
+					Confidence: aws.Float32(95),
+				},
+				{
+					BoundingBox: &types.BoundingBox{
+						Width:  aws.Float32(0.25),
+						Height: aws.Float32(0.5),
+						Left:   aws.Float32(0.625),
+						Top:    aws.Float32(0.25),
+					},
+					Confidence: aws.Float32(92.5),
+				},
+			},
+		},
+		{
+			Confidence: aws.Float32(91),
+			Name:       aws.String("Person"),
+		},
+		{
+			Confidence: aws.Float32(90),
+			Name:       aws.String("Abyssinian"),
+			Parents:    []types.Parent{{Name: aws.String("Cat")}},
+		},
+	}
+
+	expectedCats := []CatInstance{
+		{BoundingBox: BoundingBox{Width: 0.5, Height: 0.25, Left: 0.125, Top: 0.375}, Confidence: 95},
+		{BoundingBox: BoundingBox{Width: 0.25, Height: 0.5, Left: 0.625, Top: 0.25}, Confidence: 92.5},
+	}
+
+	one := 1
+	three := 3
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		expected *IsAcceptableCatImageResponse
+	}{
+		{
+			name:   "default policy",
+			policy: DefaultPolicy(),
+			expected: &IsAcceptableCatImageResponse{
+				IsAcceptableCatImage: true,
+				TypesOfCats:          []string{"Abyssinian"},
+				CatCount:             2,
+				Cats:                 expectedCats,
+			},
+		},
+		{
+			name: "forbidden label",
+			policy: &Policy{
+				MaxLabels:       10,
+				MinConfidence:   85,
+				RequiredLabels:  []LabelRule{{Name: "Cat", ConfidenceThreshold: 90}},
+				ForbiddenLabels: []LabelRule{{Name: "Person", ConfidenceThreshold: 90}, {Name: "Text"}},
+			},
+			expected: &IsAcceptableCatImageResponse{
+				IsAcceptableCatImage: false,
+				TypesOfCats:          []string{"Abyssinian"},
+				CatCount:             2,
+				Cats:                 expectedCats,
+				RejectionReasons: []RejectionReason{
+					{Code: RejectionReasonForbiddenLabel, Message: "Person is detected with confidence 91.00"},
+				},
+			},
+		},
+		{
+			name: "exactly one cat",
+			policy: &Policy{
+				MaxLabels:      10,
+				MinConfidence:  85,
+				InstanceCounts: []InstanceCountRule{{Name: "Cat", Min: &one, Max: &one}},
+			},
+			expected: &IsAcceptableCatImageResponse{
+				IsAcceptableCatImage: false,
+				TypesOfCats:          []string{"Abyssinian"},
+				CatCount:             2,
+				Cats:                 expectedCats,
+				RejectionReasons: []RejectionReason{
+					{Code: RejectionReasonInstanceCount, Message: "2 instances of Cat are detected"},
+				},
+			},
+		},
+		{
+			name: "at most three cats",
+			policy: &Policy{
+				MaxLabels:      10,
+				MinConfidence:  85,
+				InstanceCounts: []InstanceCountRule{{Name: "Cat", Max: &three}},
+			},
+			expected: &IsAcceptableCatImageResponse{
+				IsAcceptableCatImage: true,
+				TypesOfCats:          []string{"Abyssinian"},
+				CatCount:             2,
+				Cats:                 expectedCats,
+			},
+		},
+		{
+			name: "breed is not allowed",
+			policy: &Policy{
+				MaxLabels:     10,
+				MinConfidence: 85,
+				AllowedBreeds: []string{"Manx", "Persian"},
+			},
+			expected: &IsAcceptableCatImageResponse{
+				IsAcceptableCatImage: false,
+				TypesOfCats:          []string{"Abyssinian"},
+				CatCount:             2,
+				Cats:                 expectedCats,
+				RejectionReasons: []RejectionReason{
+					{Code: RejectionReasonBreedNotAllowed, Message: "Abyssinian is not allowed"},
+				},
+			},
+		},
+		{
+			name: "breed is allowed",
+			policy: &Policy{
+				MaxLabels:     10,
+				MinConfidence: 85,
+				AllowedBreeds: []string{"Abyssinian"},
+			},
+			expected: &IsAcceptableCatImageResponse{
+				IsAcceptableCatImage: true,
+				TypesOfCats:          []string{"Abyssinian"},
+				CatCount:             2,
+				Cats:                 expectedCats,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Successful evaluate "+tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); err != nil {
+				t.Fatal("Error failed to Validate", err)
+			}
+
+			res := tt.policy.Evaluate(labels)
+			if reflect.DeepEqual(res, tt.expected) == false {
+				t.Error("\nActually: ", res, "\nExpected: ", tt.expected)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluateModerationLabels(t *testing.T) {
+	t.Run("Successful match the label under the grandparent category", func(t *testing.T) {
+		policy := &Policy{ModerationLabels: []LabelRule{{Name: "Violence", ConfidenceThreshold: 60}}}
+
+		// "Violence" 自体は閾値未満だが、孫のラベルが閾値を超えている
+		moderationLabels := []types.ModerationLabel{
+			{Confidence: aws.Float32(55), Name: aws.String("Violence"), ParentName: aws.String("")},
+			{Confidence: aws.Float32(55), Name: aws.String("Weapons"), ParentName: aws.String("Violence")},
+			{Confidence: aws.Float32(90), Name: aws.String("Weapon Violence"), ParentName: aws.String("Weapons")},
+		}
+
+		res := &IsAcceptableCatImageResponse{IsAcceptableCatImage: true}
+		policy.EvaluateModerationLabels(res, moderationLabels)
+
+		expected := &IsAcceptableCatImageResponse{
+			IsAcceptableCatImage: false,
+			ModerationLabels:     []string{"Violence"},
+			RejectionReasons: []RejectionReason{
+				{Code: RejectionReasonModeration, Message: "Weapon Violence is detected with confidence 90.00"},
+			},
+		}
+
+		if reflect.DeepEqual(res, expected) == false {
+			t.Error("\nActually: ", res, "\nExpected: ", expected)
+		}
+	})
+}
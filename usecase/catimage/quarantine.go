@@ -0,0 +1,124 @@
+package catimage
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	RejectionReasonNotAllowedImageExtension RejectionReasonCode = "not-allowed-image-extension"
+	RejectionReasonImageFormatMismatch      RejectionReasonCode = "image-format-mismatch"
+	RejectionReasonImageTooLarge            RejectionReasonCode = "image-too-large"
+	RejectionReasonImageFormatNotSupported  RejectionReasonCode = "image-format-not-supported"
+)
+
+const (
+	// DefaultQuarantinePrefix は受け入れ不可となった画像の移動先
+	DefaultQuarantinePrefix = "rejected/"
+	// RejectionReasonsTagKey は受け入れ不可の理由をS3オブジェクトのタグに設定する際のKey
+	RejectionReasonsTagKey = "rejection-reasons"
+	// SourceKeyTagKey は移動元のS3オブジェクトのKeyをS3オブジェクトのタグに設定する際のKey
+	SourceKeyTagKey = "source-key"
+)
+
+type QuarantineRejectedImageRequest struct {
+	TriggerBucketName    string
+	QuarantineBucketName string
+	// QuarantinePrefix が空の場合は DefaultQuarantinePrefix を利用する
+	QuarantinePrefix  string
+	TargetS3ObjectKey string
+	RejectionReasons  []RejectionReason
+}
+
+// RejectionReasonFromError は IsAcceptableCatImage が返したエラーが画像そのものに起因する場合、受け入れ不可の理由に変換する
+// Rekognitionの障害等、再実行すれば成功する可能性のあるエラーの場合は false を返す
+func RejectionReasonFromError(err error) (RejectionReason, bool) {
+	//nolint:errorlint
+	switch errors.Cause(err) {
+	case ErrNotAllowedImageExtension:
+		return RejectionReason{Code: RejectionReasonNotAllowedImageExtension, Message: err.Error()}, true
+	case ErrImageFormatMismatch:
+		return RejectionReason{Code: RejectionReasonImageFormatMismatch, Message: err.Error()}, true
+	case ErrImageTooLarge:
+		return RejectionReason{Code: RejectionReasonImageTooLarge, Message: err.Error()}, true
+	case ErrImageFormatNotSupported:
+		return RejectionReason{Code: RejectionReasonImageFormatNotSupported, Message: err.Error()}, true
+	default:
+		return RejectionReason{}, false
+	}
+}
+
+// QuarantineRejectedImage は受け入れ不可となった画像を tmp/ から QuarantinePrefix に移動する
+// 後から理由を確認出来るように、移動先のS3オブジェクトのタグに受け入れ不可の理由を設定する
+func (
+	u *UseCase,
+) QuarantineRejectedImage(
+	ctx context.Context,
+	req *QuarantineRejectedImageRequest,
+) error {
+	prefix := req.QuarantinePrefix
+	if prefix == "" {
+		prefix = DefaultQuarantinePrefix
+	}
+
+	copySource := fmt.Sprintf(
+		"%s/%s",
+		req.TriggerBucketName,
+		req.TargetS3ObjectKey,
+	)
+
+	uploadKey := prefix + strings.ReplaceAll(req.TargetS3ObjectKey, "tmp/", "")
+
+	input := &s3.CopyObjectInput{
+		Bucket:           aws.String(req.QuarantineBucketName),
+		CopySource:       aws.String(copySource),
+		Key:              aws.String(uploadKey),
+		Tagging:          aws.String(u.createRejectionTagging(req)),
+		TaggingDirective: s3types.TaggingDirectiveReplace,
+	}
+
+	if _, err := u.S3Client.CopyObject(ctx, input); err != nil {
+		return errors.Wrap(err, "failed to S3Client.CopyObject")
+	}
+
+	deleteInput := &s3.DeleteObjectInput{
+		Bucket: aws.String(req.TriggerBucketName),
+		Key:    aws.String(req.TargetS3ObjectKey),
+	}
+
+	if _, err := u.S3Client.DeleteObject(ctx, deleteInput); err != nil {
+		return errors.Wrap(err, "failed to S3Client.DeleteObject")
+	}
+
+	return nil
+}
+
+// createRejectionTagging はS3のタグの形式（URLクエリパラメータ）を作成する
+// タグの値に利用出来る文字は制限されているので、理由はメッセージではなくコードを ":" 区切りで設定する
+// .e.g. rejection-reasons=required-label-missing%3Amoderation&source-key=tmp%2Fxxxx.jpg
+func (u *UseCase) createRejectionTagging(req *QuarantineRejectedImageRequest) string {
+	var codes []string
+
+	seen := map[RejectionReasonCode]bool{}
+	for _, reason := range req.RejectionReasons {
+		if seen[reason.Code] {
+			continue
+		}
+
+		seen[reason.Code] = true
+		codes = append(codes, string(reason.Code))
+	}
+
+	tags := url.Values{}
+	tags.Set(RejectionReasonsTagKey, strings.Join(codes, ":"))
+	tags.Set(SourceKeyTagKey, req.TargetS3ObjectKey)
+
+	return tags.Encode()
+}
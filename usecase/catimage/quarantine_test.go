@@ -0,0 +1,142 @@
+package catimage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/pkg/errors"
+)
+
+//nolint:funlen
+func TestQuarantineRejectedImage(t *testing.T) {
+	const quarantineBucketName = "quarantine-bucket"
+	const targetS3ObjectKey = "tmp/sample-dog-image.jpg"
+
+	req := &QuarantineRejectedImageRequest{
+		TriggerBucketName:    expectedTriggerBucketName,
+		QuarantineBucketName: quarantineBucketName,
+		TargetS3ObjectKey:    targetS3ObjectKey,
+		RejectionReasons: []RejectionReason{
+			{Code: RejectionReasonRequiredLabelMissing, Message: "Cat is not detected"},
+			{Code: RejectionReasonModeration, Message: "Violence is detected with confidence 88.50"},
+			{Code: RejectionReasonModeration, Message: "Emaciated Bodies is detected with confidence 72.25"},
+		},
+	}
+
+	copyObjectInput := &s3.CopyObjectInput{
+		Bucket:     aws.String(quarantineBucketName),
+		CopySource: aws.String(expectedTriggerBucketName + "/" + targetS3ObjectKey),
+		Key:        aws.String("rejected/sample-dog-image.jpg"),
+		Tagging: aws.String(
+			"rejection-reasons=required-label-missing%3Amoderation&source-key=tmp%2Fsample-dog-image.jpg",
+		),
+		TaggingDirective: s3types.TaggingDirectiveReplace,
+	}
+
+	deleteObjectInput := &s3.DeleteObjectInput{
+		Bucket: aws.String(expectedTriggerBucketName),
+		Key:    aws.String(targetS3ObjectKey),
+	}
+
+	t.Run("Successful move the rejected image to the quarantine prefix", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		gomock.InOrder(
+			mockS3Client.EXPECT().CopyObject(ctx, copyObjectInput).Return(&s3.CopyObjectOutput{}, nil),
+			mockS3Client.EXPECT().DeleteObject(ctx, deleteObjectInput).Return(&s3.DeleteObjectOutput{}, nil),
+		)
+
+		u := UseCase{S3Client: mockS3Client}
+
+		if err := u.QuarantineRejectedImage(ctx, req); err != nil {
+			t.Fatal("Failed QuarantineRejectedImage", err)
+		}
+	})
+
+	t.Run("Failure the original image is not deleted if the copy fails", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		expected := errors.New("failed s3Client copyObject")
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockS3Client.EXPECT().CopyObject(ctx, copyObjectInput).Return(nil, expected)
+
+		u := UseCase{S3Client: mockS3Client}
+
+		err := u.QuarantineRejectedImage(ctx, req)
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Failure because an error occurred in s3Client deleteObject", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		expected := errors.New("failed s3Client deleteObject")
+
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		mockS3Client.EXPECT().CopyObject(ctx, copyObjectInput).Return(&s3.CopyObjectOutput{}, nil)
+		mockS3Client.EXPECT().DeleteObject(ctx, deleteObjectInput).Return(nil, expected)
+
+		u := UseCase{S3Client: mockS3Client}
+
+		err := u.QuarantineRejectedImage(ctx, req)
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+	})
+}
+
+func TestRejectionReasonFromError(t *testing.T) {
+	tests := []struct {
+		err          error
+		expectedCode RejectionReasonCode
+		expectedOk   bool
+	}{
+		{
+			err:          errors.Wrap(ErrNotAllowedImageExtension, "image extension is empty"),
+			expectedCode: RejectionReasonNotAllowedImageExtension,
+			expectedOk:   true,
+		},
+		{
+			err:          errors.Wrap(ErrImageFormatMismatch, "image format is jpeg"),
+			expectedCode: RejectionReasonImageFormatMismatch,
+			expectedOk:   true,
+		},
+		{
+			err:          errors.Wrap(ErrImageTooLarge, "image size is 20971520 bytes"),
+			expectedCode: RejectionReasonImageTooLarge,
+			expectedOk:   true,
+		},
+		{
+			err:          errors.Wrap(ErrUnexpected, "failed to RekognitionClient.DetectLabels"),
+			expectedCode: "",
+			expectedOk:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run("Successful convert "+tt.err.Error(), func(t *testing.T) {
+			reason, ok := RejectionReasonFromError(tt.err)
+			if ok != tt.expectedOk || reason.Code != tt.expectedCode {
+				t.Error("\nActually: ", reason.Code, ok, "\nExpected: ", tt.expectedCode, tt.expectedOk)
+			}
+		})
+	}
+}
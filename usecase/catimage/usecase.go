@@ -3,20 +3,41 @@ package catimage
 import (
 	"context"
 	"fmt"
+	"io"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/imageformat"
 	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
 	"github.com/pkg/errors"
 )
 
 type UseCase struct {
 	S3Client          infrastructure.S3Client
 	RekognitionClient infrastructure.RekognitionClient
+	// Policy が設定されていない場合は DefaultPolicy で判定する
+	Policy *Policy
+	// ImageRecordRepository が設定されている場合は UpdateImageRecord で処理状況を保存する
+	ImageRecordRepository infrastructure.ImageRecordRepository
+	// WebhookUrls が設定されている場合は NotifyDecision で判定結果を WebhookSender で通知する
+	WebhookSender infrastructure.WebhookSender
+	WebhookUrls   []string
+	// PendingNotificationStore が設定されている場合は通知に失敗した判定結果を保存し、RedeliverPendingNotification で再送する
+	PendingNotificationStore infrastructure.PendingNotificationStore
+	// PerceptualHashIndex と Policy.NearDuplicate が設定されている場合は受け入れ済みの画像とほぼ同じ画像かどうかを判定する
+	PerceptualHashIndex infrastructure.PerceptualHashIndex
+	// Logger が設定されていない場合はログを出力しない
+	Logger *logging.Logger
+	// Metrics が設定されていない場合はメトリクスを出力しない
+	Metrics *metrics.Recorder
 }
 
 type Request struct {
@@ -26,12 +47,43 @@ type Request struct {
 }
 
 type IsAcceptableCatImageResponse struct {
-	IsAcceptableCatImage bool     `json:"isAcceptableCatImage"`
-	TypesOfCats          []string `json:"typesOfCats"`
+	IsAcceptableCatImage bool              `json:"isAcceptableCatImage"`
+	TypesOfCats          []string          `json:"typesOfCats"`
+	RejectionReasons     []RejectionReason `json:"rejectionReasons,omitempty"`
+	// ModerationLabels には閾値を超えた不適切なコンテンツのカテゴリが入る
+	ModerationLabels []string `json:"moderationLabels,omitempty"`
+	// CatCount は画像内に写っているねこの数（"Cat" ラベルの Instances の数）
+	CatCount int `json:"catCount"`
+	// Cats には画像内に写っているねこ1匹ずつの位置と信頼度が入る
+	Cats []CatInstance `json:"cats,omitempty"`
+	// PerceptualHash には知覚ハッシュ（dHash）を16進数で表した値が入る、ほぼ同じ画像かどうか判定しなかった場合は空
+	PerceptualHash string `json:"perceptualHash,omitempty"`
+	// NearDuplicate にはほぼ同じ画像と見なされた受け入れ済みの画像が入る
+	NearDuplicate *NearDuplicate `json:"nearDuplicate,omitempty"`
 }
 
+// BoundingBox は画像内の位置を画像全体の幅、高さに対する比率（0〜1）で表す
+type BoundingBox struct {
+	Width  float32 `json:"width"`
+	Height float32 `json:"height"`
+	Left   float32 `json:"left"`
+	Top    float32 `json:"top"`
+}
+
+type CatInstance struct {
+	BoundingBox BoundingBox `json:"boundingBox"`
+	Confidence  float32     `json:"confidence"`
+}
+
+// MaxImageSize はRekognitionがS3オブジェクトとして解析出来る画像の最大サイズ
+// https://docs.aws.amazon.com/ja_jp/rekognition/latest/dg/limits.html
+const MaxImageSize = 15 * 1024 * 1024
+
 var (
 	ErrNotAllowedImageExtension = errors.New("not allowed image extension")
+	ErrImageFormatMismatch      = errors.New("image format does not match the extension")
+	ErrImageTooLarge            = errors.New("image is too large")
+	ErrImageFormatNotSupported  = errors.New("image format is not supported by rekognition")
 	ErrUnexpected               = errors.New("unexpected error")
 )
 
@@ -40,7 +92,14 @@ func (
 ) IsAcceptableCatImage(
 	ctx context.Context,
 	req *Request,
-) (*IsAcceptableCatImageResponse, error) {
+) (res *IsAcceptableCatImageResponse, err error) {
+	ctx, span := tracing.Start(
+		ctx,
+		"catimage.UseCase.IsAcceptableCatImage",
+		tracing.S3ObjectAttributes(req.TargetS3BucketName, req.TargetS3ObjectKey)...,
+	)
+	defer func() { tracing.End(span, err) }()
+
 	s3Object := &types.S3Object{
 		Bucket:  aws.String(req.TargetS3BucketName),
 		Name:    aws.String(req.TargetS3ObjectKey),
@@ -53,13 +112,63 @@ func (
 		return nil, errors.Wrap(ErrNotAllowedImageExtension, "image extension is empty")
 	}
 
-	detectLabelsOutput, err := u.detectLabels(ctx, s3Object)
+	// 拡張子だけでは中身が画像かどうか分からないので、Rekognitionに送る前に画像の内容から形式を判定する
+	format, size, err := u.detectImageFormat(ctx, req)
 	if err != nil {
 		return nil, errors.Wrap(ErrUnexpected, err.Error())
 	}
 
+	u.Metrics.Put("UploadedImageSize", float64(size), metrics.UnitBytes, nil)
+
+	if format != imageformat.FromExtension(ext) {
+		return nil, errors.Wrap(ErrImageFormatMismatch, "image format is "+string(format)+", extension is "+ext)
+	}
+
+	// S3に直接アップロードされた画像のサイズは制限されていないので、Rekognitionの上限を超える画像はここで受け入れ不可にする
+	if size > MaxImageSize {
+		return nil, errors.Wrap(ErrImageTooLarge, "image size is "+strconv.FormatInt(size, 10)+" bytes")
+	}
+
+	policy := u.policy()
+
+	detectLabelsOutput, err := u.detectLabels(ctx, s3Object, policy)
+	if err != nil {
+		return nil, wrapRekognitionError(err)
+	}
+
 	// 受け入れ可能なねこ画像かどうかを判定する
-	response := u.isAcceptableCatImage(detectLabelsOutput.Labels)
+	response := policy.Evaluate(detectLabelsOutput.Labels)
+
+	// ねこ画像であっても不適切なコンテンツが含まれている場合は受け入れない
+	// ラベルの判定で受け入れ不可となった画像はモデレーションを行う必要がないのでRekognitionを呼び出さない
+	if response.IsAcceptableCatImage && len(policy.ModerationLabels) > 0 {
+		detectModerationLabelsOutput, err := u.detectModerationLabels(ctx, s3Object, policy)
+		if err != nil {
+			return nil, wrapRekognitionError(err)
+		}
+
+		policy.EvaluateModerationLabels(response, detectModerationLabelsOutput.ModerationLabels)
+	}
+
+	if err := u.evaluateNearDuplicate(ctx, req, policy, response); err != nil {
+		return nil, errors.Wrap(ErrUnexpected, err.Error())
+	}
+
+	rejectionReasonCodes := make([]RejectionReasonCode, 0, len(response.RejectionReasons))
+	for _, reason := range response.RejectionReasons {
+		rejectionReasonCodes = append(rejectionReasonCodes, reason.Code)
+	}
+
+	u.Logger.Info(ctx, "evaluated cat image", logging.Fields{
+		"s3BucketName":         req.TargetS3BucketName,
+		"s3ObjectKey":          req.TargetS3ObjectKey,
+		"imageId":              infrastructure.ImageIdFromS3ObjectKey(req.TargetS3ObjectKey),
+		"isAcceptableCatImage": response.IsAcceptableCatImage,
+		"rejectionReasonCodes": rejectionReasonCodes,
+		"catCount":             response.CatCount,
+	})
+
+	u.recordDecisionMetrics(response)
 
 	return response, nil
 }
@@ -68,6 +177,9 @@ type CopyCatImageToDestinationBucketRequest struct {
 	TriggerBucketName     string
 	DestinationBucketName string
 	TargetS3ObjectKey     string
+	// PerceptualHash には IsAcceptableCatImageResponse.PerceptualHash をそのまま設定する
+	// 設定されている場合はコピーした画像を PerceptualHashIndex に追加する
+	PerceptualHash string
 }
 
 func (
@@ -75,41 +187,78 @@ func (
 ) CopyCatImageToDestinationBucket(
 	ctx context.Context,
 	req *CopyCatImageToDestinationBucketRequest,
-) error {
+) (err error) {
+	ctx, span := tracing.Start(
+		ctx,
+		"catimage.UseCase.CopyCatImageToDestinationBucket",
+		tracing.S3ObjectAttributes(req.DestinationBucketName, catImageKey(req.TargetS3ObjectKey))...,
+	)
+	defer func() { tracing.End(span, err) }()
+
 	copySource := fmt.Sprintf(
 		"%s/%s",
 		req.TriggerBucketName,
 		req.TargetS3ObjectKey,
 	)
 
-	uploadKey := "cat-images/" + strings.ReplaceAll(req.TargetS3ObjectKey, "tmp/", "")
+	uploadKey := catImageKey(req.TargetS3ObjectKey)
 
-	err := u.copyS3Object(ctx, copySource, req.DestinationBucketName, uploadKey)
+	err = u.copyS3Object(ctx, copySource, req.DestinationBucketName, uploadKey)
 	if err != nil {
 		return errors.Wrap(err, "failed to UseCase.copyS3Object")
 	}
 
+	if err := u.addPerceptualHash(ctx, uploadKey, req.PerceptualHash); err != nil {
+		return errors.Wrap(err, "failed to UseCase.addPerceptualHash")
+	}
+
 	return nil
 }
 
+// catImageKey は受け入れ可能なねこ画像のコピー先のKey
+func catImageKey(targetS3ObjectKey string) string {
+	return "cat-images/" + strings.ReplaceAll(targetS3ObjectKey, "tmp/", "")
+}
+
+// recordDecisionMetrics は受け入れ可能な画像の割合、受け入れ不可の理由、検出されたねこの種類をメトリクスとして出力する
+func (u *UseCase) recordDecisionMetrics(response *IsAcceptableCatImageResponse) {
+	if response.IsAcceptableCatImage {
+		u.Metrics.Count("AcceptedCatImages", nil)
+	} else {
+		u.Metrics.Count("RejectedCatImages", nil)
+	}
+
+	for _, reason := range response.RejectionReasons {
+		u.Metrics.Count("RejectionReasons", metrics.Dimensions{"RejectionReason": string(reason.Code)})
+	}
+
+	for _, typeOfCat := range response.TypesOfCats {
+		u.Metrics.Count("DetectedCatBreeds", metrics.Dimensions{"Breed": typeOfCat})
+	}
+}
+
+func (u *UseCase) policy() *Policy {
+	if u.Policy == nil {
+		return DefaultPolicy()
+	}
+
+	return u.Policy
+}
+
 func (u *UseCase) detectLabels(
 	ctx context.Context,
 	s3Object *types.S3Object,
+	policy *Policy,
 ) (*rekognition.DetectLabelsOutput, error) {
 	// 画像解析
 	rekognitionImage := &types.Image{
 		S3Object: s3Object,
 	}
 
-	// 何個までラベルを取得するかの設定、ラベルは信頼度が高い順に並んでいる
-	const maxLabels = int32(10)
-	// 信頼度の閾値、Confidenceがここで設定した値未満の場合、そのラベルはレスポンスに含まれない
-	const minConfidence = float32(85)
-
 	input := &rekognition.DetectLabelsInput{
 		Image:         rekognitionImage,
-		MaxLabels:     aws.Int32(maxLabels),
-		MinConfidence: aws.Float32(minConfidence),
+		MaxLabels:     aws.Int32(policy.MaxLabels),
+		MinConfidence: aws.Float32(policy.MinConfidence),
 	}
 
 	output, err := u.RekognitionClient.DetectLabels(ctx, input)
@@ -120,6 +269,69 @@ func (u *UseCase) detectLabels(
 	return output, nil
 }
 
+func (u *UseCase) detectModerationLabels(
+	ctx context.Context,
+	s3Object *types.S3Object,
+	policy *Policy,
+) (*rekognition.DetectModerationLabelsOutput, error) {
+	input := &rekognition.DetectModerationLabelsInput{
+		Image: &types.Image{
+			S3Object: s3Object,
+		},
+		MinConfidence: aws.Float32(policy.ModerationMinConfidence()),
+	}
+
+	output, err := u.RekognitionClient.DetectModerationLabels(ctx, input)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to RekognitionClient.DetectModerationLabels")
+	}
+
+	return output, nil
+}
+
+// detectImageFormat はS3オブジェクトの先頭の数バイトだけを取得して画像形式を判定する
+// 合わせてレスポンスの Content-Range からS3オブジェクト全体のサイズを返す
+func (u *UseCase) detectImageFormat(ctx context.Context, req *Request) (imageformat.Format, int64, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(req.TargetS3BucketName),
+		Key:    aws.String(req.TargetS3ObjectKey),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", imageformat.HeaderSize-1)),
+	}
+
+	if req.TargetS3ObjectVersionId != "" {
+		input.VersionId = aws.String(req.TargetS3ObjectVersionId)
+	}
+
+	output, err := u.S3Client.GetObject(ctx, input)
+	if err != nil {
+		return imageformat.Unknown, 0, errors.Wrap(err, "failed to S3Client.GetObject")
+	}
+	defer output.Body.Close()
+
+	header := make([]byte, imageformat.HeaderSize)
+
+	n, err := io.ReadFull(output.Body, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return imageformat.Unknown, 0, errors.Wrap(err, "failed to read s3 object body")
+	}
+
+	return imageformat.Detect(header[:n]), objectSize(output), nil
+}
+
+// objectSize は Content-Range（.e.g. "bytes 0-15/1048576"）からS3オブジェクト全体のサイズを返す
+// Content-Range が無い場合は Content-Length を返す
+func objectSize(output *s3.GetObjectOutput) int64 {
+	contentRange := aws.ToString(output.ContentRange)
+
+	if i := strings.LastIndex(contentRange, "/"); i >= 0 {
+		if size, err := strconv.ParseInt(contentRange[i+1:], 10, 64); err == nil {
+			return size
+		}
+	}
+
+	return output.ContentLength
+}
+
 func (u *UseCase) copyS3Object(
 	ctx context.Context,
 	copySource string,
@@ -140,30 +352,15 @@ func (u *UseCase) copyS3Object(
 	return nil
 }
 
-func (u *UseCase) isAcceptableCatImage(labels []types.Label) *IsAcceptableCatImageResponse {
-	response := &IsAcceptableCatImageResponse{
-		IsAcceptableCatImage: false,
-	}
-
-	for _, label := range labels {
-		// ラベルにCatが含まれていて、かつConfidenceが閾値より大きい場合は受け入れ可能なねこの画像と見なす
-		const confidenceThreshold = 90
-		if *label.Name == "Cat" && *label.Confidence > confidenceThreshold {
-			response.IsAcceptableCatImage = true
-		}
-
-		// ねこの種類を判別する為の処理
-		// label.Parents に "Cat" が含まれていれば、そのラベルはねこの種類という事にしている
-		// .e.g. test/images/abyssinian-cat.jpg の場合は {"isAcceptableCatImage": true, "typesOfCats": ["Abyssinian"]}
-		// .e.g. test/images/manx-cat.jpg の場合は {"isAcceptableCatImage": true, "typesOfCats": ["Manx"]}
-		for _, parent := range label.Parents {
-			if *parent.Name == "Cat" {
-				response.TypesOfCats = append(response.TypesOfCats, *label.Name)
-			}
-		}
+// wrapRekognitionError はRekognitionが画像形式を理由に解析出来なかった場合は ErrImageFormatNotSupported にする
+// RekognitionはS3オブジェクトのWebPを解析出来ないので、署名付きURLでアップロードされたWebPはここで受け入れ不可になる
+func wrapRekognitionError(err error) error {
+	var invalidImageFormat *types.InvalidImageFormatException
+	if errors.As(err, &invalidImageFormat) {
+		return errors.Wrap(ErrImageFormatNotSupported, err.Error())
 	}
 
-	return response
+	return errors.Wrap(ErrUnexpected, err.Error())
 }
 
 func (u *UseCase) extractImageExtension(fileName string) string {
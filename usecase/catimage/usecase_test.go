@@ -1,15 +1,21 @@
 package catimage
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
 	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
 	"github.com/keitakn/aws-rekognition-sandbox/mock"
 	"github.com/pkg/errors"
 )
@@ -20,10 +26,70 @@ func TestMain(m *testing.M) {
 	os.Exit(status)
 }
 
+const expectedTriggerBucketName = "trigger-bucket"
+const expectedTargetS3ObjectVersionId = "AAAAA.1234567890123456789abcdefg"
+
+func newGetObjectInput(key string) *s3.GetObjectInput {
+	return &s3.GetObjectInput{
+		Bucket:    aws.String(expectedTriggerBucketName),
+		Key:       aws.String(key),
+		Range:     aws.String("bytes=0-15"),
+		VersionId: aws.String(expectedTargetS3ObjectVersionId),
+	}
+}
+
+func newGetObjectOutput(t *testing.T, imgPath string) *s3.GetObjectOutput {
+	t.Helper()
+
+	img, err := os.ReadFile(imgPath)
+	if err != nil {
+		t.Fatal("Error failed to os.ReadFile", err)
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(img))}
+}
+
+func newS3Object(key string) *types.S3Object {
+	return &types.S3Object{
+		Bucket:  aws.String(expectedTriggerBucketName),
+		Name:    aws.String(key),
+		Version: aws.String(expectedTargetS3ObjectVersionId),
+	}
+}
+
+func newDetectLabelsInput(key string) *rekognition.DetectLabelsInput {
+	// 何個までラベルを取得するかの設定、ラベルは信頼度が高い順に並んでいる
+	const maxLabels = int32(10)
+	// 信頼度の閾値、Confidenceがここで設定した値未満の場合、そのラベルはレスポンスに含まれない
+	const minConfidence = float32(85)
+
+	return &rekognition.DetectLabelsInput{
+		Image:         &types.Image{S3Object: newS3Object(key)},
+		MaxLabels:     aws.Int32(maxLabels),
+		MinConfidence: aws.Float32(minConfidence),
+	}
+}
+
+func newDetectModerationLabelsInput(key string) *rekognition.DetectModerationLabelsInput {
+	// DefaultPolicy のモデレーションの閾値の中で最も低い値
+	const minConfidence = float32(60)
+
+	return &rekognition.DetectModerationLabelsInput{
+		Image:         &types.Image{S3Object: newS3Object(key)},
+		MinConfidence: aws.Float32(minConfidence),
+	}
+}
+
+func newAcceptableCatLabelsOutput() *rekognition.DetectLabelsOutput {
+	return &rekognition.DetectLabelsOutput{
+		Labels: []types.Label{
+			{Confidence: aws.Float32(99.1), Name: aws.String("Cat")},
+		},
+	}
+}
+
 //nolint:funlen
 func TestHandler(t *testing.T) {
-	const expectedTriggerBucketName = "trigger-bucket"
-	const expectedTargetS3ObjectVersionId = "AAAAA.1234567890123456789abcdefg"
 	const catLabelName = "Cat"
 
 	t.Run("acceptable cat images", func(t *testing.T) {
@@ -31,6 +97,7 @@ func TestHandler(t *testing.T) {
 		defer ctrl.Finish()
 
 		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
 		expectedTargetS3ObjectKey := "tmp/sample-cat-image.jpg"
 
 		s3Object := &types.S3Object{
@@ -74,10 +141,24 @@ func TestHandler(t *testing.T) {
 
 		ctx := context.Background()
 
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(expectedTargetS3ObjectKey)).Return(
+			newGetObjectOutput(t, "../../test/images/moko-cat.jpg"),
+			nil,
+		)
+
 		mockRekognitionClient.EXPECT().DetectLabels(ctx, detectLabelsInput).Return(detectLabelsOutput, nil)
 
+		mockRekognitionClient.EXPECT().DetectModerationLabels(
+			ctx,
+			newDetectModerationLabelsInput(expectedTargetS3ObjectKey),
+		).Return(&rekognition.DetectModerationLabelsOutput{}, nil)
+
+		var metricsBuf bytes.Buffer
+
 		u := UseCase{
+			S3Client:          mockS3Client,
 			RekognitionClient: mockRekognitionClient,
+			Metrics:           metrics.New(&metricsBuf, "TestNamespace", nil),
 		}
 
 		req := &Request{
@@ -99,6 +180,13 @@ func TestHandler(t *testing.T) {
 		if reflect.DeepEqual(res, expected) == false {
 			t.Error("\nActually: ", res, "\nExpected: ", expected)
 		}
+
+		expectedMetrics := []string{`"AcceptedCatImages":1`, `"Breed":"ChinchillaSilver"`, `"UploadedImageSize"`}
+		for _, expectedMetric := range expectedMetrics {
+			if !strings.Contains(metricsBuf.String(), expectedMetric) {
+				t.Error("\nActually: ", metricsBuf.String(), "\nExpected: ", expectedMetric)
+			}
+		}
 	})
 
 	t.Run("not an acceptable cat images, because the confidence value is low", func(t *testing.T) {
@@ -106,6 +194,7 @@ func TestHandler(t *testing.T) {
 		defer ctrl.Finish()
 
 		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
 		expectedTargetS3ObjectKey := "tmp/sample-cat-image.jpg"
 
 		s3Object := &types.S3Object{
@@ -142,9 +231,15 @@ func TestHandler(t *testing.T) {
 
 		ctx := context.Background()
 
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(expectedTargetS3ObjectKey)).Return(
+			newGetObjectOutput(t, "../../test/images/moko-cat.jpg"),
+			nil,
+		)
+
 		mockRekognitionClient.EXPECT().DetectLabels(ctx, detectLabelsInput).Return(detectLabelsOutput, nil)
 
 		u := UseCase{
+			S3Client:          mockS3Client,
 			RekognitionClient: mockRekognitionClient,
 		}
 
@@ -161,6 +256,12 @@ func TestHandler(t *testing.T) {
 
 		expected := &IsAcceptableCatImageResponse{
 			IsAcceptableCatImage: false,
+			RejectionReasons: []RejectionReason{
+				{
+					Code:    RejectionReasonBelowConfidenceThreshold,
+					Message: "Cat confidence 90.00 is not greater than 90.00",
+				},
+			},
 		}
 
 		if reflect.DeepEqual(res, expected) == false {
@@ -173,6 +274,7 @@ func TestHandler(t *testing.T) {
 		defer ctrl.Finish()
 
 		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
 		expectedTargetS3ObjectKey := "tmp/sample-dog-image.jpg"
 
 		s3Object := &types.S3Object{
@@ -209,9 +311,15 @@ func TestHandler(t *testing.T) {
 
 		ctx := context.Background()
 
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(expectedTargetS3ObjectKey)).Return(
+			newGetObjectOutput(t, "../../test/images/dog.jpg"),
+			nil,
+		)
+
 		mockRekognitionClient.EXPECT().DetectLabels(ctx, detectLabelsInput).Return(detectLabelsOutput, nil)
 
 		u := UseCase{
+			S3Client:          mockS3Client,
 			RekognitionClient: mockRekognitionClient,
 		}
 
@@ -228,6 +336,9 @@ func TestHandler(t *testing.T) {
 
 		expected := &IsAcceptableCatImageResponse{
 			IsAcceptableCatImage: false,
+			RejectionReasons: []RejectionReason{
+				{Code: RejectionReasonRequiredLabelMissing, Message: "Cat is not detected"},
+			},
 		}
 
 		if reflect.DeepEqual(res, expected) == false {
@@ -240,9 +351,11 @@ func TestHandler(t *testing.T) {
 		defer ctrl.Finish()
 
 		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
 		expectedTargetS3ObjectKey := "tmp/sample-cat-image.gif"
 
 		u := UseCase{
+			S3Client:          mockS3Client,
 			RekognitionClient: mockRekognitionClient,
 		}
 
@@ -266,6 +379,7 @@ func TestHandler(t *testing.T) {
 		defer ctrl.Finish()
 
 		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
 		expectedTargetS3ObjectKey := "tmp/sample-error-image.jpg"
 
 		s3Object := &types.S3Object{
@@ -291,6 +405,11 @@ func TestHandler(t *testing.T) {
 
 		ctx := context.Background()
 
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(expectedTargetS3ObjectKey)).Return(
+			newGetObjectOutput(t, "../../test/images/moko-cat.jpg"),
+			nil,
+		)
+
 		mockRekognitionClient.EXPECT().DetectLabels(
 			ctx,
 			detectLabelsInput,
@@ -300,6 +419,268 @@ func TestHandler(t *testing.T) {
 		)
 
 		u := UseCase{
+			S3Client:          mockS3Client,
+			RekognitionClient: mockRekognitionClient,
+		}
+
+		req := &Request{
+			TargetS3BucketName:      expectedTriggerBucketName,
+			TargetS3ObjectKey:       expectedTargetS3ObjectKey,
+			TargetS3ObjectVersionId: expectedTargetS3ObjectVersionId,
+		}
+
+		_, err := u.IsAcceptableCatImage(ctx, req)
+		expected := ErrUnexpected
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("failure the image format does not match the extension", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		// 拡張子は ".png" だが中身はJPEG
+		expectedTargetS3ObjectKey := "tmp/sample-cat-image.png"
+
+		ctx := context.Background()
+
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(expectedTargetS3ObjectKey)).Return(
+			newGetObjectOutput(t, "../../test/images/moko-cat.jpg"),
+			nil,
+		)
+
+		u := UseCase{
+			S3Client:          mockS3Client,
+			RekognitionClient: mockRekognitionClient,
+		}
+
+		req := &Request{
+			TargetS3BucketName:      expectedTriggerBucketName,
+			TargetS3ObjectKey:       expectedTargetS3ObjectKey,
+			TargetS3ObjectVersionId: expectedTargetS3ObjectVersionId,
+		}
+
+		_, err := u.IsAcceptableCatImage(ctx, req)
+		expected := ErrImageFormatMismatch
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("failure the image exceeds the maximum size", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		expectedTargetS3ObjectKey := "tmp/sample-cat-image.jpg"
+
+		ctx := context.Background()
+
+		getObjectOutput := newGetObjectOutput(t, "../../test/images/moko-cat.jpg")
+		getObjectOutput.ContentRange = aws.String("bytes 0-15/20971520")
+
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(expectedTargetS3ObjectKey)).Return(getObjectOutput, nil)
+
+		u := UseCase{
+			S3Client:          mockS3Client,
+			RekognitionClient: mockRekognitionClient,
+		}
+
+		req := &Request{
+			TargetS3BucketName:      expectedTriggerBucketName,
+			TargetS3ObjectKey:       expectedTargetS3ObjectKey,
+			TargetS3ObjectVersionId: expectedTargetS3ObjectVersionId,
+		}
+
+		_, err := u.IsAcceptableCatImage(ctx, req)
+		expected := ErrImageTooLarge
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("failure the presigned webp image is not supported by rekognition", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		// presignedupload で contentType に image/webp を指定した場合のKey
+		expectedTargetS3ObjectKey := "tmp/aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa.webp"
+
+		ctx := context.Background()
+
+		webpHeader := []byte("RIFF\x24\x00\x00\x00WEBPVP8 ")
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(expectedTargetS3ObjectKey)).Return(
+			&s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(webpHeader))},
+			nil,
+		)
+
+		// RekognitionはS3オブジェクトのWebPを解析出来ない
+		mockRekognitionClient.EXPECT().DetectLabels(ctx, newDetectLabelsInput(expectedTargetS3ObjectKey)).Return(
+			nil,
+			&smithy.OperationError{
+				ServiceID:     "Rekognition",
+				OperationName: "DetectLabels",
+				Err:           &types.InvalidImageFormatException{Message: aws.String("Request has invalid image format")},
+			},
+		)
+
+		u := UseCase{
+			S3Client:          mockS3Client,
+			RekognitionClient: mockRekognitionClient,
+		}
+
+		req := &Request{
+			TargetS3BucketName:      expectedTriggerBucketName,
+			TargetS3ObjectKey:       expectedTargetS3ObjectKey,
+			TargetS3ObjectVersionId: expectedTargetS3ObjectVersionId,
+		}
+
+		_, err := u.IsAcceptableCatImage(ctx, req)
+		expected := ErrImageFormatNotSupported
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+
+		// 再実行せずに受け入れ不可として隔離される
+		rejectionReason, ok := RejectionReasonFromError(err)
+		if !ok || rejectionReason.Code != RejectionReasonImageFormatNotSupported {
+			t.Error("\nActually: ", rejectionReason, "\nExpected: ", RejectionReasonImageFormatNotSupported)
+		}
+	})
+
+	t.Run("failure because an error occurred in s3Client", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		expectedTargetS3ObjectKey := "tmp/sample-error-image.jpg"
+
+		ctx := context.Background()
+
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(expectedTargetS3ObjectKey)).Return(
+			nil,
+			errors.New("failed s3Client getObject"),
+		)
+
+		u := UseCase{
+			S3Client:          mockS3Client,
+			RekognitionClient: mockRekognitionClient,
+		}
+
+		req := &Request{
+			TargetS3BucketName:      expectedTriggerBucketName,
+			TargetS3ObjectKey:       expectedTargetS3ObjectKey,
+			TargetS3ObjectVersionId: expectedTargetS3ObjectVersionId,
+		}
+
+		_, err := u.IsAcceptableCatImage(ctx, req)
+		expected := ErrUnexpected
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("not an acceptable cat images, because the image contains inappropriate content", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		expectedTargetS3ObjectKey := "tmp/sample-violent-cat-image.jpg"
+
+		ctx := context.Background()
+
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(expectedTargetS3ObjectKey)).Return(
+			newGetObjectOutput(t, "../../test/images/moko-cat.jpg"),
+			nil,
+		)
+
+		mockRekognitionClient.EXPECT().DetectLabels(
+			ctx,
+			newDetectLabelsInput(expectedTargetS3ObjectKey),
+		).Return(newAcceptableCatLabelsOutput(), nil)
+
+		moderationLabels := []types.ModerationLabel{
+			// 閾値以下なので受け入れ不可の理由にはならない
+			{Confidence: aws.Float32(60), Name: aws.String("Explicit Nudity"), ParentName: aws.String("")},
+			{Confidence: aws.Float32(88.5), Name: aws.String("Violence"), ParentName: aws.String("")},
+			{Confidence: aws.Float32(88.5), Name: aws.String("Graphic Violence Or Gore"), ParentName: aws.String("Violence")},
+			{
+				Confidence: aws.Float32(72.25),
+				Name:       aws.String("Emaciated Bodies"),
+				ParentName: aws.String("Visually Disturbing"),
+			},
+		}
+
+		mockRekognitionClient.EXPECT().DetectModerationLabels(
+			ctx,
+			newDetectModerationLabelsInput(expectedTargetS3ObjectKey),
+		).Return(&rekognition.DetectModerationLabelsOutput{ModerationLabels: moderationLabels}, nil)
+
+		u := UseCase{
+			S3Client:          mockS3Client,
+			RekognitionClient: mockRekognitionClient,
+		}
+
+		req := &Request{
+			TargetS3BucketName:      expectedTriggerBucketName,
+			TargetS3ObjectKey:       expectedTargetS3ObjectKey,
+			TargetS3ObjectVersionId: expectedTargetS3ObjectVersionId,
+		}
+
+		res, err := u.IsAcceptableCatImage(ctx, req)
+		if err != nil {
+			t.Fatal("Failed IsAcceptableCatImage", err)
+		}
+
+		expected := &IsAcceptableCatImageResponse{
+			IsAcceptableCatImage: false,
+			RejectionReasons: []RejectionReason{
+				{Code: RejectionReasonModeration, Message: "Violence is detected with confidence 88.50"},
+				{Code: RejectionReasonModeration, Message: "Emaciated Bodies is detected with confidence 72.25"},
+			},
+			ModerationLabels: []string{"Violence", "Visually Disturbing"},
+		}
+
+		if reflect.DeepEqual(res, expected) == false {
+			t.Error("\nActually: ", res, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("failure because an error occurred in rekognitionClient detectModerationLabels", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Client := mock.NewMockS3Client(ctrl)
+		expectedTargetS3ObjectKey := "tmp/sample-error-image.jpg"
+
+		ctx := context.Background()
+
+		mockS3Client.EXPECT().GetObject(ctx, newGetObjectInput(expectedTargetS3ObjectKey)).Return(
+			newGetObjectOutput(t, "../../test/images/moko-cat.jpg"),
+			nil,
+		)
+
+		mockRekognitionClient.EXPECT().DetectLabels(
+			ctx,
+			newDetectLabelsInput(expectedTargetS3ObjectKey),
+		).Return(newAcceptableCatLabelsOutput(), nil)
+
+		mockRekognitionClient.EXPECT().DetectModerationLabels(
+			ctx,
+			newDetectModerationLabelsInput(expectedTargetS3ObjectKey),
+		).Return(nil, errors.New("failed rekognitionClient detectModerationLabels"))
+
+		u := UseCase{
+			S3Client:          mockS3Client,
 			RekognitionClient: mockRekognitionClient,
 		}
 
@@ -6,7 +6,10 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/rekognition"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/keitakn/aws-rekognition-sandbox/imageprocessing"
 	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -23,25 +26,43 @@ type ResponseErrorBody struct {
 }
 
 var (
-	ErrBase64Decode = errors.New("failed to base64 decode")
-	ErrUnexpected   = errors.New("unexpected error")
+	ErrBase64Decode       = errors.New("failed to base64 decode")
+	ErrImagePreprocessing = errors.New("failed to preprocess image")
+	ErrUnexpected         = errors.New("unexpected error")
 )
 
 type UseCase struct {
 	RekognitionClient infrastructure.RekognitionClient
+	// Logger が設定されていない場合はログを出力しない
+	Logger *logging.Logger
 }
 
-func (u *UseCase) DetectFaces(ctx context.Context, req Request) (*Response, error) {
+func (u *UseCase) DetectFaces(ctx context.Context, req Request) (res *Response, err error) {
+	ctx, span := tracing.Start(ctx, "detectfaces.UseCase.DetectFaces")
+	defer func() { tracing.End(span, err) }()
+
 	decodedImg, err := base64.StdEncoding.DecodeString(req.Image)
 	if err != nil {
 		return nil, errors.Wrap(ErrBase64Decode, err.Error())
 	}
 
-	detectFacesOutput, err := u.detectFaces(ctx, decodedImg)
+	// Rekognitionの制限を超える画像は縮小した画像で解析する
+	// BoundingBox, Landmarks は画像全体に対する比率なので、元の画像の座標にそのまま適用出来る
+	rekognitionImg, err := imageprocessing.PrepareForRekognition(decodedImg)
+	if err != nil {
+		return nil, errors.Wrap(ErrImagePreprocessing, err.Error())
+	}
+
+	detectFacesOutput, err := u.detectFaces(ctx, rekognitionImg)
 	if err != nil {
 		return nil, errors.Wrap(ErrUnexpected, err.Error())
 	}
 
+	u.Logger.Info(ctx, "detected faces", logging.Fields{
+		"imageSize": len(decodedImg),
+		"faceCount": len(detectFacesOutput.FaceDetails),
+	})
+
 	return &Response{
 		DetectFacesOutput: detectFacesOutput,
 	}, nil
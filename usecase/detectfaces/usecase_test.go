@@ -1,15 +1,23 @@
 package detectfaces
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
+	"image"
+	"image/png"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/service/rekognition"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
 	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/imageformat"
+	"github.com/keitakn/aws-rekognition-sandbox/imageprocessing"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
 	"github.com/keitakn/aws-rekognition-sandbox/mock"
 	"github.com/keitakn/aws-rekognition-sandbox/test"
 )
@@ -57,8 +65,11 @@ func TestHandler(t *testing.T) {
 			Image: base64Img,
 		}
 
+		var logBuf bytes.Buffer
+
 		u := &UseCase{
 			RekognitionClient: mockClient,
+			Logger:            logging.New(&logBuf, logging.LevelInfo),
 		}
 
 		res, err := u.DetectFaces(ctx, *req)
@@ -66,6 +77,11 @@ func TestHandler(t *testing.T) {
 			t.Fatal("Error failed to DetectFaces", err)
 		}
 
+		// 検出した顔の数は出力するが、Base64エンコードされた画像は出力しない
+		if !strings.Contains(logBuf.String(), `"faceCount":1`) || strings.Contains(logBuf.String(), base64Img) {
+			t.Error("\nActually: ", logBuf.String(), "\nExpected: ", `"faceCount":1`)
+		}
+
 		expected := &Response{
 			DetectFacesOutput: expectedDetectFacesOutput,
 		}
@@ -176,4 +192,60 @@ func TestHandler(t *testing.T) {
 			t.Error("\nActually: ", err, "\nExpected: ", expected)
 		}
 	})
+
+	t.Run("Successful the oversized image is downscaled before DetectFaces", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockClient := mock.NewMockRekognitionClient(ctrl)
+
+		const width = 5000
+		const height = 500
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+			t.Fatal("Error failed to png.Encode", err)
+		}
+
+		ctx := context.Background()
+
+		var detectFacesInput *rekognition.DetectFacesInput
+
+		mockClient.EXPECT().DetectFaces(ctx, gomock.Any()).DoAndReturn(
+			func(
+				_ context.Context,
+				input *rekognition.DetectFacesInput,
+				_ ...func(*rekognition.Options),
+			) (*rekognition.DetectFacesOutput, error) {
+				detectFacesInput = input
+
+				return &rekognition.DetectFacesOutput{}, nil
+			},
+		)
+
+		req := &Request{
+			Image: base64.StdEncoding.EncodeToString(buf.Bytes()),
+		}
+
+		u := &UseCase{
+			RekognitionClient: mockClient,
+		}
+
+		if _, err := u.DetectFaces(ctx, *req); err != nil {
+			t.Fatal("Error failed to DetectFaces", err)
+		}
+
+		if imageformat.Detect(detectFacesInput.Image.Bytes) != imageformat.Jpeg {
+			t.Error("\nActually: ", imageformat.Detect(detectFacesInput.Image.Bytes), "\nExpected: ", imageformat.Jpeg)
+		}
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(detectFacesInput.Image.Bytes))
+		if err != nil {
+			t.Fatal("Error failed to image.DecodeConfig", err)
+		}
+
+		if config.Width != imageprocessing.MaxRekognitionImageDimension {
+			t.Error("\nActually: ", config.Width, "\nExpected: ", imageprocessing.MaxRekognitionImageDimension)
+		}
+	})
 }
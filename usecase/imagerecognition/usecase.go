@@ -5,12 +5,19 @@ import (
 	"context"
 	"encoding/base64"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/imageformat"
+	"github.com/keitakn/aws-rekognition-sandbox/imageprocessing"
 	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/logging"
+	"github.com/keitakn/aws-rekognition-sandbox/metrics"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -20,47 +27,84 @@ type RequestBody struct {
 }
 
 type Response struct {
-	Labels []types.Label `json:"labels"`
+	// ImageId は GET /images/{id} で判定結果を確認する為のID
+	ImageId string        `json:"imageId"`
+	Labels  []types.Label `json:"labels"`
 }
 
 type UseCase struct {
 	RekognitionClient infrastructure.RekognitionClient
 	S3Uploader        infrastructure.S3Uploader
 	UniqueIdGenerator infrastructure.UniqueIdGenerator
+	// ImageRecordRepository が設定されている場合はアップロードした画像の処理状況を保存する
+	ImageRecordRepository infrastructure.ImageRecordRepository
+	// Logger が設定されていない場合はログを出力しない
+	Logger *logging.Logger
+	// Metrics が設定されていない場合はメトリクスを出力しない
+	Metrics *metrics.Recorder
 }
 
 var (
-	ErrBase64Decode     = errors.New("failed to base64 decode")
-	ErrGenerateUniqueId = errors.New("failed to generate uniqueId")
-	ErrUploadToS3       = errors.New("failed to upload to s3")
-	ErrRekognition      = errors.New("failed to rekognition detectLabels")
+	ErrBase64Decode          = errors.New("failed to base64 decode")
+	ErrNotAllowedImageFormat = errors.New("not allowed image format")
+	ErrImagePreprocessing    = errors.New("failed to preprocess image")
+	ErrGenerateUniqueId      = errors.New("failed to generate uniqueId")
+	ErrUploadToS3            = errors.New("failed to upload to s3")
+	ErrSaveImageRecord       = errors.New("failed to save image record")
+	ErrRekognition           = errors.New("failed to rekognition detectLabels")
 )
 
+// ImageRecognition はアップロードした画像のラベルを返す
+// アップロードした後に ErrRekognition になった場合も画像は isacceptablecatimage で判定されるので、ImageId だけを設定した Response を返す
 func (
 	u *UseCase,
 ) ImageRecognition(
 	ctx context.Context,
 	req RequestBody,
-) (*Response, error) {
+) (res *Response, err error) {
+	ctx, span := tracing.Start(ctx, "imagerecognition.UseCase.ImageRecognition")
+	defer func() { tracing.End(span, err) }()
+
 	decodedImg, err := base64.StdEncoding.DecodeString(req.Image)
 	if err != nil {
 		return nil, errors.Wrap(ErrBase64Decode, err.Error())
 	}
 
+	// クライアントから送られてきた拡張子は信用せず、画像の内容から形式を判定する
+	format := imageformat.Detect(decodedImg)
+	if !u.isAllowedImageFormat(format) {
+		return nil, errors.Wrap(ErrNotAllowedImageFormat, "image format is "+string(format))
+	}
+
+	// Rekognitionの制限を超える画像は縮小した画像で解析する、S3には元の画像をアップロードする
+	rekognitionImg, err := imageprocessing.PrepareForRekognition(decodedImg)
+	if err != nil {
+		return nil, errors.Wrap(ErrImagePreprocessing, err.Error())
+	}
+
 	uuid, err := u.UniqueIdGenerator.Generate()
 	if err != nil {
 		return nil, errors.Wrap(ErrGenerateUniqueId, err.Error())
 	}
 
+	logger := u.Logger.With(logging.Fields{"imageId": uuid})
+
 	buffer := new(bytes.Buffer)
 	buffer.Write(decodedImg)
 
-	uploadKey := "tmp/" + uuid + req.ImageExtension
+	uploadKey := "tmp/" + uuid + u.decideImageExtension(req.ImageExtension, format)
+
+	// アップロードすると isacceptablecatimage が判定を始めるので、判定中・判定結果の記録を上書きしないように先に保存する
+	// アップロードに失敗した場合はIDをレスポンスで返さないので、残った記録が参照される事は無い
+	if err := u.saveUploadedImageRecord(ctx, uuid, uploadKey); err != nil {
+		return nil, errors.Wrap(ErrSaveImageRecord, err.Error())
+	}
+
 	err = u.uploadToS3(
 		ctx,
 		os.Getenv("TRIGGER_BUCKET_NAME"),
 		buffer,
-		u.decideS3ContentType(req.ImageExtension),
+		format.ContentType(),
 		uploadKey,
 	)
 
@@ -68,16 +112,50 @@ func (
 		return nil, errors.Wrap(ErrUploadToS3, err.Error())
 	}
 
-	detectLabelsOutput, err := u.detectLabels(ctx, decodedImg)
+	logger.Info(ctx, "uploaded image", logging.Fields{
+		"s3ObjectKey": uploadKey,
+		"imageFormat": string(format),
+		"imageSize":   len(decodedImg),
+	})
+
+	u.Metrics.Put("UploadedImageSize", float64(len(decodedImg)), metrics.UnitBytes, nil)
+
+	detectLabelsOutput, err := u.detectLabels(ctx, rekognitionImg)
 	if err != nil {
-		return nil, errors.Wrap(ErrRekognition, err.Error())
+		return &Response{ImageId: uuid}, errors.Wrap(ErrRekognition, err.Error())
 	}
 
+	logger.Info(ctx, "detected labels", logging.Fields{"labelCount": len(detectLabelsOutput.Labels)})
+
 	return &Response{
-		Labels: detectLabelsOutput.Labels,
+		ImageId: uuid,
+		Labels:  detectLabelsOutput.Labels,
 	}, nil
 }
 
+// saveUploadedImageRecord はアップロードした画像が isacceptablecatimage の判定を待っている事を記録する
+func (u *UseCase) saveUploadedImageRecord(ctx context.Context, imageId string, key string) error {
+	if u.ImageRecordRepository == nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	record := &infrastructure.ImageRecord{
+		ImageId:     imageId,
+		Status:      infrastructure.ImageRecordStatusUploaded,
+		S3ObjectKey: key,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := u.ImageRecordRepository.Save(ctx, record); err != nil {
+		return errors.Wrap(err, "failed to ImageRecordRepository.Save")
+	}
+
+	return nil
+}
+
 func (u *UseCase) uploadToS3(
 	ctx context.Context,
 	bucket string,
@@ -90,6 +168,7 @@ func (u *UseCase) uploadToS3(
 		Body:        body,
 		ContentType: aws.String(contentType),
 		Key:         aws.String(key),
+		Metadata:    tracing.InjectS3Metadata(ctx, nil),
 	}
 
 	_, err := u.S3Uploader.Upload(ctx, input)
@@ -131,17 +210,26 @@ func (
 	return output, nil
 }
 
-func (u *UseCase) decideS3ContentType(ext string) string {
-	contentType := ""
+func (u *UseCase) isAllowedImageFormat(format imageformat.Format) bool {
+	// 許可されている画像形式
+	allowedImageFormatList := [...]imageformat.Format{imageformat.Jpeg, imageformat.Png, imageformat.Webp}
+
+	for _, v := range allowedImageFormatList {
+		if format == v {
+			return true
+		}
+	}
+
+	return false
+}
 
-	switch ext {
-	case ".png":
-		contentType = "image/png"
-	case ".webp":
-		contentType = "image/webp"
-	default:
-		contentType = "image/jpeg"
+// decideImageExtension はS3のKeyに利用する拡張子を決定する
+// 指定された拡張子が画像の内容と一致しない場合は画像の内容から判定した拡張子に補正する
+// .e.g. 内容がJPEGの画像に ".png" が指定された場合は ".jpg" になる
+func (u *UseCase) decideImageExtension(ext string, format imageformat.Format) string {
+	if imageformat.FromExtension(ext) == format {
+		return strings.ToLower(ext)
 	}
 
-	return contentType
+	return format.Extension()
 }
@@ -3,6 +3,7 @@ package imagerecognition
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"os"
 	"testing"
@@ -13,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
 	"github.com/keitakn/aws-rekognition-sandbox/mock"
 	"github.com/keitakn/aws-rekognition-sandbox/test"
 )
@@ -291,10 +293,163 @@ func TestHandler(t *testing.T) {
 			ImageExtension: ".jpg",
 		}
 
-		_, err = u.ImageRecognition(ctx, req)
+		res, err := u.ImageRecognition(ctx, req)
 		expected := ErrRekognition
 		if !errors.Is(err, expected) {
 			t.Error("\nActually: ", err, "\nExpected: ", expected)
 		}
+
+		// アップロード済みの画像は判定されるので、判定結果を確認出来るようにIDは返す
+		if res == nil || res.ImageId != mockUuid {
+			t.Error("\nActually: ", res, "\nExpected: ", mockUuid)
+		}
+	})
+
+	t.Run("Successful the image extension is corrected by the image content", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+
+		base64Img, err := test.EncodeImageToBase64("../../test/images/moko-cat.jpg")
+		if err != nil {
+			t.Fatal("Error failed to encodeImageToBase64", err)
+		}
+
+		decodedImg, err := test.DecodeImageFromBase64(base64Img)
+		if err != nil {
+			t.Fatal("Error failed to decodeImageFromBase64", err)
+		}
+
+		ctx := context.Background()
+
+		mockRekognitionClient.EXPECT().DetectLabels(ctx, gomock.Any()).Return(&rekognition.DetectLabelsOutput{}, nil)
+
+		mockS3Uploader := mock.NewMockS3Uploader(ctrl)
+
+		buffer := new(bytes.Buffer)
+		buffer.Write(decodedImg)
+
+		// 拡張子に ".png" が指定されているが、画像の内容はJPEGなので ".jpg" としてアップロードされる
+		key := "tmp/" + mockUuid + ".jpg"
+
+		s3PutObjectInput := &s3.PutObjectInput{
+			Bucket:      aws.String(os.Getenv("TRIGGER_BUCKET_NAME")),
+			Body:        buffer,
+			ContentType: aws.String("image/jpeg"),
+			Key:         aws.String(key),
+		}
+
+		s3UploadOutput := &manager.UploadOutput{
+			Location: "https://exmple.s3.ap-northeast-1.amazonaws.com/" + key,
+		}
+
+		mockS3Uploader.EXPECT().Upload(ctx, s3PutObjectInput).Return(s3UploadOutput, nil)
+
+		mockUniqueIdGenerator := mock.NewMockUniqueIdGenerator(ctrl)
+		mockUniqueIdGenerator.EXPECT().Generate().Return(mockUuid, nil)
+
+		u := UseCase{
+			RekognitionClient: mockRekognitionClient,
+			S3Uploader:        mockS3Uploader,
+			UniqueIdGenerator: mockUniqueIdGenerator,
+		}
+
+		req := RequestBody{
+			Image:          base64Img,
+			ImageExtension: ".png",
+		}
+
+		if _, err := u.ImageRecognition(ctx, req); err != nil {
+			t.Fatal("Error failed to ImageRecognition", err)
+		}
+	})
+
+	t.Run("Failure not allowed image format", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockS3Uploader := mock.NewMockS3Uploader(ctrl)
+		mockUniqueIdGenerator := mock.NewMockUniqueIdGenerator(ctrl)
+
+		u := UseCase{
+			RekognitionClient: mockRekognitionClient,
+			S3Uploader:        mockS3Uploader,
+			UniqueIdGenerator: mockUniqueIdGenerator,
+		}
+
+		// 拡張子は ".jpg" だが中身は画像ではないファイル
+		req := RequestBody{
+			Image:          base64.StdEncoding.EncodeToString([]byte("this is not an image")),
+			ImageExtension: ".jpg",
+		}
+
+		ctx := context.Background()
+
+		_, err := u.ImageRecognition(ctx, req)
+		expected := ErrNotAllowedImageFormat
+		if !errors.Is(err, expected) {
+			t.Error("\nActually: ", err, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Successful the uploaded image is recorded before the upload", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		base64Img, err := test.EncodeImageToBase64("../../test/images/moko-cat.jpg")
+		if err != nil {
+			t.Fatal("Error failed to encodeImageToBase64", err)
+		}
+
+		ctx := context.Background()
+
+		mockRekognitionClient := mock.NewMockRekognitionClient(ctrl)
+		mockRekognitionClient.EXPECT().DetectLabels(ctx, gomock.Any()).Return(&rekognition.DetectLabelsOutput{}, nil)
+
+		mockS3Uploader := mock.NewMockS3Uploader(ctrl)
+		uploadCall := mockS3Uploader.EXPECT().Upload(ctx, gomock.Any()).Return(&manager.UploadOutput{}, nil)
+
+		mockUniqueIdGenerator := mock.NewMockUniqueIdGenerator(ctrl)
+		mockUniqueIdGenerator.EXPECT().Generate().Return(mockUuid, nil)
+
+		mockImageRecordRepository := mock.NewMockImageRecordRepository(ctrl)
+		saveCall := mockImageRecordRepository.EXPECT().Save(ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, record *infrastructure.ImageRecord) error {
+				if record.ImageId != mockUuid ||
+					record.Status != infrastructure.ImageRecordStatusUploaded ||
+					record.S3ObjectKey != "tmp/"+mockUuid+".jpg" ||
+					record.CreatedAt.IsZero() {
+					t.Error("\nActually: ", record)
+				}
+
+				return nil
+			},
+		)
+
+		// アップロードした時点で判定が始まるので、判定結果を uploaded で上書きしないように先に保存する
+		gomock.InOrder(saveCall, uploadCall)
+
+		u := UseCase{
+			RekognitionClient:     mockRekognitionClient,
+			S3Uploader:            mockS3Uploader,
+			UniqueIdGenerator:     mockUniqueIdGenerator,
+			ImageRecordRepository: mockImageRecordRepository,
+		}
+
+		req := RequestBody{
+			Image:          base64Img,
+			ImageExtension: ".jpg",
+		}
+
+		res, err := u.ImageRecognition(ctx, req)
+		if err != nil {
+			t.Fatal("Error failed to ImageRecognition", err)
+		}
+
+		if res.ImageId != mockUuid {
+			t.Error("\nActually: ", res.ImageId, "\nExpected: ", mockUuid)
+		}
 	})
 }
@@ -0,0 +1,39 @@
+package imagestatus
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/pkg/errors"
+)
+
+type UseCase struct {
+	ImageRecordRepository infrastructure.ImageRecordRepository
+}
+
+var (
+	ErrInvalidImageId   = errors.New("invalid image id")
+	ErrImageNotFound    = errors.New("image not found")
+	ErrFindImageRecord  = errors.New("failed to find image record")
+	imageIdFormatRegexp = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+)
+
+// FindImageRecord は imagerecognition, presignedupload で発行した ImageId の処理状況を返す
+// ImageId はファイル名の一部として扱われるので、パストラバーサル等を防ぐ為に利用出来る文字を制限している
+func (u *UseCase) FindImageRecord(ctx context.Context, imageId string) (*infrastructure.ImageRecord, error) {
+	if !imageIdFormatRegexp.MatchString(imageId) {
+		return nil, errors.Wrap(ErrInvalidImageId, "image id is "+imageId)
+	}
+
+	record, err := u.ImageRecordRepository.FindById(ctx, imageId)
+	if err != nil {
+		if errors.Is(err, infrastructure.ErrImageRecordNotFound) {
+			return nil, errors.Wrap(ErrImageNotFound, "image id is "+imageId)
+		}
+
+		return nil, errors.Wrap(ErrFindImageRecord, err.Error())
+	}
+
+	return record, nil
+}
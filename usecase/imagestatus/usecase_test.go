@@ -0,0 +1,95 @@
+package imagestatus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+	"github.com/pkg/errors"
+)
+
+//nolint:funlen
+func TestFindImageRecord(t *testing.T) {
+	const imageId = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+
+	t.Run("Successful find the image record", func(t *testing.T) {
+		ctx := context.Background()
+
+		now := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+
+		expected := &infrastructure.ImageRecord{
+			ImageId:     imageId,
+			Status:      infrastructure.ImageRecordStatusUploaded,
+			S3ObjectKey: "tmp/" + imageId + ".jpg",
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+
+		repository := infrastructure.NewMemoryImageRecordRepository()
+		if err := repository.Save(ctx, expected); err != nil {
+			t.Fatal("Error failed to Save", err)
+		}
+
+		u := UseCase{ImageRecordRepository: repository}
+
+		res, err := u.FindImageRecord(ctx, imageId)
+		if err != nil {
+			t.Fatal("Error failed to FindImageRecord", err)
+		}
+
+		if reflect.DeepEqual(res, expected) == false {
+			t.Error("\nActually: ", res, "\nExpected: ", expected)
+		}
+	})
+
+	t.Run("Failure image record is not found", func(t *testing.T) {
+		u := UseCase{ImageRecordRepository: infrastructure.NewMemoryImageRecordRepository()}
+
+		_, err := u.FindImageRecord(context.Background(), imageId)
+		if !errors.Is(err, ErrImageNotFound) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrImageNotFound)
+		}
+	})
+
+	invalidImageIds := []string{"", "../secret", "a/b", "image.json"}
+
+	for _, invalidImageId := range invalidImageIds {
+		invalidImageId := invalidImageId
+
+		t.Run("Failure invalid image id "+invalidImageId, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			// ImageId が不正な場合はリポジトリを参照しない
+			mockImageRecordRepository := mock.NewMockImageRecordRepository(ctrl)
+
+			u := UseCase{ImageRecordRepository: mockImageRecordRepository}
+
+			_, err := u.FindImageRecord(context.Background(), invalidImageId)
+			if !errors.Is(err, ErrInvalidImageId) {
+				t.Error("\nActually: ", err, "\nExpected: ", ErrInvalidImageId)
+			}
+		})
+	}
+
+	t.Run("Failure find the image record", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockImageRecordRepository := mock.NewMockImageRecordRepository(ctrl)
+		mockImageRecordRepository.EXPECT().FindById(ctx, imageId).Return(nil, errors.New("failed s3Client getObject"))
+
+		u := UseCase{ImageRecordRepository: mockImageRecordRepository}
+
+		_, err := u.FindImageRecord(ctx, imageId)
+		if !errors.Is(err, ErrFindImageRecord) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrFindImageRecord)
+		}
+	})
+}
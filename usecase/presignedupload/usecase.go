@@ -0,0 +1,193 @@
+package presignedupload
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/keitakn/aws-rekognition-sandbox/imageformat"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/tracing"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultExpires は署名付きURLの有効期限
+	DefaultExpires = 15 * time.Minute
+	// DefaultMaxContentLength はアップロード出来る画像の最大サイズ
+	// isacceptablecatimage で受け入れ可能な最大サイズ（catimage.MaxImageSize）に合わせている
+	DefaultMaxContentLength = 15 * 1024 * 1024
+)
+
+type Request struct {
+	ContentType   string `json:"contentType"`
+	ContentLength int64  `json:"contentLength"`
+}
+
+type Response struct {
+	// ImageId はアップロードした画像を後から参照する為のID
+	ImageId     string `json:"imageId"`
+	S3ObjectKey string `json:"s3ObjectKey"`
+	UploadUrl   string `json:"uploadUrl"`
+	Method      string `json:"method"`
+	// Headers は署名に含まれているので、アップロードの際に必ずこの値で送る必要があるヘッダー（Content-Type, Content-Length）
+	Headers   map[string]string `json:"headers"`
+	ExpiresIn int               `json:"expiresIn"`
+}
+
+type UseCase struct {
+	S3Presigner       infrastructure.S3Presigner
+	UniqueIdGenerator infrastructure.UniqueIdGenerator
+	// ImageRecordRepository が設定されている場合はアップロードされる画像の処理状況を保存する
+	ImageRecordRepository infrastructure.ImageRecordRepository
+	// Expires が設定されていない場合は DefaultExpires を利用する
+	Expires time.Duration
+	// MaxContentLength が設定されていない場合は DefaultMaxContentLength を利用する
+	MaxContentLength int64
+}
+
+var (
+	ErrNotAllowedContentType = errors.New("not allowed content type")
+	ErrInvalidContentLength  = errors.New("invalid content length")
+	ErrGenerateUniqueId      = errors.New("failed to generate uniqueId")
+	ErrSaveImageRecord       = errors.New("failed to save image record")
+	ErrPresign               = errors.New("failed to presign put object")
+)
+
+// CreatePresignedUploadUrl は tmp/ に画像を直接アップロードする為の署名付きURLを発行する
+// アップロードされた画像は isacceptablecatimage のS3トリガーで判定される
+// Content-Type と Content-Length は署名に含めるので、指定した値と異なる形式・サイズではアップロード出来ない
+func (
+	u *UseCase,
+) CreatePresignedUploadUrl(
+	ctx context.Context,
+	req Request,
+) (*Response, error) {
+	format := imageformat.FromContentType(req.ContentType)
+	if !u.isAllowedImageFormat(format) {
+		return nil, errors.Wrap(ErrNotAllowedContentType, "content type is "+req.ContentType)
+	}
+
+	if req.ContentLength <= 0 || req.ContentLength > u.maxContentLength() {
+		return nil, errors.Wrap(
+			ErrInvalidContentLength,
+			"content length must be between 1 and "+strconv.FormatInt(u.maxContentLength(), 10),
+		)
+	}
+
+	uuid, err := u.UniqueIdGenerator.Generate()
+	if err != nil {
+		return nil, errors.Wrap(ErrGenerateUniqueId, err.Error())
+	}
+
+	key := "tmp/" + uuid + format.Extension()
+
+	// imagerecognition と同じく、レスポンスの ImageId で判定前から /images/{id} を参照出来るように先に保存する
+	// 署名付きURLを発行出来なかった場合はIDをレスポンスで返さないので、残った記録が参照される事は無い
+	if err := u.saveUploadedImageRecord(ctx, uuid, key); err != nil {
+		return nil, errors.Wrap(ErrSaveImageRecord, err.Error())
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(os.Getenv("TRIGGER_BUCKET_NAME")),
+		Key:         aws.String(key),
+		ContentType: aws.String(format.ContentType()),
+		// Content-Length を署名に含めて、申告されたサイズ以外の画像をアップロード出来ないようにする
+		ContentLength: req.ContentLength,
+		// メタデータも署名に含まれるので、トレースしている場合は Headers に x-amz-meta-traceparent が追加される
+		Metadata: tracing.InjectS3Metadata(ctx, nil),
+	}
+
+	presigned, err := u.S3Presigner.PresignPutObject(
+		ctx,
+		input,
+		s3.WithPresignExpires(u.expires()),
+		infrastructure.WithPresignContentLength(req.ContentLength),
+	)
+	if err != nil {
+		return nil, errors.Wrap(ErrPresign, err.Error())
+	}
+
+	return &Response{
+		ImageId:     uuid,
+		S3ObjectKey: key,
+		UploadUrl:   presigned.URL,
+		Method:      presigned.Method,
+		Headers:     u.extractRequiredHeaders(presigned.SignedHeader),
+		ExpiresIn:   int(u.expires().Seconds()),
+	}, nil
+}
+
+// saveUploadedImageRecord は署名付きURLでアップロードされる画像が isacceptablecatimage の判定を待っている事を記録する
+// アップロードされなかった場合も uploaded のまま残る
+func (u *UseCase) saveUploadedImageRecord(ctx context.Context, imageId string, key string) error {
+	if u.ImageRecordRepository == nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	record := &infrastructure.ImageRecord{
+		ImageId:     imageId,
+		Status:      infrastructure.ImageRecordStatusUploaded,
+		S3ObjectKey: key,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := u.ImageRecordRepository.Save(ctx, record); err != nil {
+		return errors.Wrap(err, "failed to ImageRecordRepository.Save")
+	}
+
+	return nil
+}
+
+func (u *UseCase) expires() time.Duration {
+	if u.Expires == 0 {
+		return DefaultExpires
+	}
+
+	return u.Expires
+}
+
+func (u *UseCase) maxContentLength() int64 {
+	if u.MaxContentLength == 0 {
+		return DefaultMaxContentLength
+	}
+
+	return u.MaxContentLength
+}
+
+// extractRequiredHeaders は署名に含まれているヘッダーの中でクライアントが送る必要があるものを返す
+// Host はHTTPクライアントが自動で設定するので除外する
+func (u *UseCase) extractRequiredHeaders(signedHeader http.Header) map[string]string {
+	headers := map[string]string{}
+
+	for name := range signedHeader {
+		canonicalName := http.CanonicalHeaderKey(name)
+		if canonicalName == "Host" {
+			continue
+		}
+
+		headers[canonicalName] = signedHeader.Get(name)
+	}
+
+	return headers
+}
+
+func (u *UseCase) isAllowedImageFormat(format imageformat.Format) bool {
+	// isacceptablecatimage で許可されている画像形式
+	allowedImageFormatList := [...]imageformat.Format{imageformat.Jpeg, imageformat.Png, imageformat.Webp}
+
+	for _, v := range allowedImageFormatList {
+		if format == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,245 @@
+package presignedupload
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/keitakn/aws-rekognition-sandbox/infrastructure"
+	"github.com/keitakn/aws-rekognition-sandbox/mock"
+)
+
+const mockUuid = "adc9ba0c-8ac1-4a7b-a3a7-2e0e3a7c3b7a"
+
+//nolint:funlen
+func TestCreatePresignedUploadUrl(t *testing.T) {
+	t.Run("Successful create the presigned url", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		expectedKey := "tmp/" + mockUuid + ".jpg"
+		expectedUrl := "https://example.s3.ap-northeast-1.amazonaws.com/" + expectedKey + "?X-Amz-Signature=xxx"
+
+		mockUniqueIdGenerator := mock.NewMockUniqueIdGenerator(ctrl)
+		mockUniqueIdGenerator.EXPECT().Generate().Return(mockUuid, nil)
+
+		mockS3Presigner := mock.NewMockS3Presigner(ctrl)
+		mockS3Presigner.EXPECT().PresignPutObject(ctx, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(
+				_ context.Context,
+				input *s3.PutObjectInput,
+				optFns ...func(*s3.PresignOptions),
+			) (*v4.PresignedHTTPRequest, error) {
+				if *input.Bucket != os.Getenv("TRIGGER_BUCKET_NAME") || *input.Key != expectedKey ||
+					*input.ContentType != "image/jpeg" {
+					t.Error("\nActually: ", input)
+				}
+
+				var opts s3.PresignOptions
+				for _, fn := range optFns {
+					fn(&opts)
+				}
+
+				if opts.Expires != 5*time.Minute {
+					t.Error("\nActually: ", opts.Expires, "\nExpected: ", 5*time.Minute)
+				}
+
+				return &v4.PresignedHTTPRequest{
+					URL:    expectedUrl,
+					Method: http.MethodPut,
+					SignedHeader: http.Header{
+						"Content-Type": []string{"image/jpeg"},
+						"Host":         []string{"example.s3.ap-northeast-1.amazonaws.com"},
+					},
+				}, nil
+			},
+		)
+
+		repository := infrastructure.NewMemoryImageRecordRepository()
+
+		u := &UseCase{
+			S3Presigner:           mockS3Presigner,
+			UniqueIdGenerator:     mockUniqueIdGenerator,
+			ImageRecordRepository: repository,
+			Expires:               5 * time.Minute,
+		}
+
+		res, err := u.CreatePresignedUploadUrl(ctx, Request{ContentType: "image/jpeg", ContentLength: 571639})
+		if err != nil {
+			t.Fatal("Error failed to CreatePresignedUploadUrl", err)
+		}
+
+		expected := &Response{
+			ImageId:     mockUuid,
+			S3ObjectKey: expectedKey,
+			UploadUrl:   expectedUrl,
+			Method:      http.MethodPut,
+			Headers:     map[string]string{"Content-Type": "image/jpeg"},
+			ExpiresIn:   300,
+		}
+
+		if reflect.DeepEqual(res, expected) == false {
+			t.Error("\nActually: ", res, "\nExpected: ", expected)
+		}
+
+		// アップロードされる前から /images/{id} で参照出来る
+		record, err := repository.FindById(ctx, mockUuid)
+		if err != nil {
+			t.Fatal("Error failed to FindById", err)
+		}
+
+		if record.Status != infrastructure.ImageRecordStatusUploaded || record.S3ObjectKey != expectedKey {
+			t.Error("\nActually: ", record, "\nExpected: ", infrastructure.ImageRecordStatusUploaded, expectedKey)
+		}
+	})
+
+	t.Run("Successful sign the content length", func(t *testing.T) {
+		t.Setenv("TRIGGER_BUCKET_NAME", "trigger-bucket")
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockUniqueIdGenerator := mock.NewMockUniqueIdGenerator(ctrl)
+		mockUniqueIdGenerator.EXPECT().Generate().Return(mockUuid, nil)
+
+		s3Client := s3.New(s3.Options{
+			Region:      "ap-northeast-1",
+			Credentials: credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "SECRET", ""),
+		})
+
+		u := &UseCase{
+			S3Presigner:       s3.NewPresignClient(s3Client),
+			UniqueIdGenerator: mockUniqueIdGenerator,
+		}
+
+		res, err := u.CreatePresignedUploadUrl(
+			context.Background(),
+			Request{ContentType: "image/jpeg", ContentLength: 571639},
+		)
+		if err != nil {
+			t.Fatal("Error failed to CreatePresignedUploadUrl", err)
+		}
+
+		uploadUrl, err := url.Parse(res.UploadUrl)
+		if err != nil {
+			t.Fatal("Error failed to url.Parse", err)
+		}
+
+		signedHeaders := strings.Split(uploadUrl.Query().Get("X-Amz-SignedHeaders"), ";")
+
+		hasContentLength := false
+		for _, h := range signedHeaders {
+			if h == "content-length" {
+				hasContentLength = true
+			}
+		}
+
+		if !hasContentLength {
+			t.Error("\nActually: ", signedHeaders, "\nExpected: ", "content-length")
+		}
+
+		if res.Headers["Content-Length"] != "571639" {
+			t.Error("\nActually: ", res.Headers, "\nExpected: ", "Content-Length: 571639")
+		}
+	})
+
+	failureTests := []struct {
+		name     string
+		req      Request
+		expected error
+	}{
+		{
+			name:     "not allowed content type",
+			req:      Request{ContentType: "image/gif", ContentLength: 1024},
+			expected: ErrNotAllowedContentType,
+		},
+		{
+			name:     "content length is empty",
+			req:      Request{ContentType: "image/png"},
+			expected: ErrInvalidContentLength,
+		},
+		{
+			name:     "content length exceeds the maximum",
+			req:      Request{ContentType: "image/png", ContentLength: DefaultMaxContentLength + 1},
+			expected: ErrInvalidContentLength,
+		},
+	}
+
+	for _, tt := range failureTests {
+		tt := tt
+		t.Run("Failure "+tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			u := &UseCase{
+				S3Presigner:       mock.NewMockS3Presigner(ctrl),
+				UniqueIdGenerator: mock.NewMockUniqueIdGenerator(ctrl),
+			}
+
+			_, err := u.CreatePresignedUploadUrl(context.Background(), tt.req)
+			if !errors.Is(err, tt.expected) {
+				t.Error("\nActually: ", err, "\nExpected: ", tt.expected)
+			}
+		})
+	}
+
+	t.Run("Failure save the image record returned an error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockUniqueIdGenerator := mock.NewMockUniqueIdGenerator(ctrl)
+		mockUniqueIdGenerator.EXPECT().Generate().Return(mockUuid, nil)
+
+		mockImageRecordRepository := mock.NewMockImageRecordRepository(ctrl)
+		mockImageRecordRepository.EXPECT().Save(ctx, gomock.Any()).Return(errors.New("save error"))
+
+		// 記録を保存出来なかった場合は署名付きURLを発行しない
+		u := &UseCase{
+			S3Presigner:           mock.NewMockS3Presigner(ctrl),
+			UniqueIdGenerator:     mockUniqueIdGenerator,
+			ImageRecordRepository: mockImageRecordRepository,
+		}
+
+		_, err := u.CreatePresignedUploadUrl(ctx, Request{ContentType: "image/png", ContentLength: 1024})
+		if !errors.Is(err, ErrSaveImageRecord) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrSaveImageRecord)
+		}
+	})
+
+	t.Run("Failure presign returned an error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		mockUniqueIdGenerator := mock.NewMockUniqueIdGenerator(ctrl)
+		mockUniqueIdGenerator.EXPECT().Generate().Return(mockUuid, nil)
+
+		mockS3Presigner := mock.NewMockS3Presigner(ctrl)
+		mockS3Presigner.EXPECT().PresignPutObject(ctx, gomock.Any(), gomock.Any()).Return(nil, errors.New("presign error"))
+
+		u := &UseCase{
+			S3Presigner:       mockS3Presigner,
+			UniqueIdGenerator: mockUniqueIdGenerator,
+		}
+
+		_, err := u.CreatePresignedUploadUrl(ctx, Request{ContentType: "image/webp", ContentLength: 1024})
+		if !errors.Is(err, ErrPresign) {
+			t.Error("\nActually: ", err, "\nExpected: ", ErrPresign)
+		}
+	})
+}